@@ -0,0 +1,293 @@
+// Package bundle writes a chart and every image it references into a single
+// OCI image layout archive, and loads such archives into a registry.
+package bundle
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Media types of a Helm chart stored as an OCI artifact.
+const (
+	MediaTypeHelmConfig = "application/vnd.cncf.helm.config.v1+json"
+	MediaTypeHelmChart  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// Annotations on index.json entries. AnnotationImageName holds the image
+// reference as the chart spells it, AnnotationRefName the tag (or, for the
+// chart, "<name>:<version>").
+const (
+	AnnotationImageName = "io.containerd.image.name"
+	AnnotationRefName   = "org.opencontainers.image.ref.name"
+)
+
+const layoutFile = `{"imageLayoutVersion":"1.0.0"}`
+
+// WriteOptions controls how a bundle is written.
+type WriteOptions struct {
+	// Platforms limits multi-platform images to the matching platforms. An
+	// empty list keeps every platform.
+	Platforms []registry.Platform
+	// Source is the registry client images are read from.
+	Source *registry.Client
+}
+
+// Write writes an OCI image layout tar to w holding chart, as a Helm OCI
+// artifact, and every distinct image. It returns
+// the layout's index. Any image that cannot be fetched fails the bundle,
+// since a partial bundle is useless at a disconnected site.
+func Write(ctx context.Context, w io.Writer, chart *Chart, images []scan.ImageFinding, options WriteOptions) (*registry.Index, error) {
+	writer := &layoutWriter{tar: tar.NewWriter(w), written: map[string]bool{}, options: options}
+
+	if err := writer.writeFile("oci-layout", []byte(layoutFile)); err != nil {
+		return nil, err
+	}
+
+	index := &registry.Index{SchemaVersion: 2, MediaType: registry.MediaTypeOCIIndex}
+
+	chartDescriptor, err := writer.addChart(chart)
+	if err != nil {
+		return nil, err
+	}
+	index.Manifests = append(index.Manifests, chartDescriptor)
+
+	seen := map[string]bool{}
+	var names []string
+	for _, image := range images {
+		if !seen[image.Name] {
+			seen[image.Name] = true
+			names = append(names, image.Name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		reference, err := registry.ParseReference(name)
+		if err != nil {
+			return nil, err
+		}
+		descriptor, err := writer.addImage(ctx, reference)
+		if err != nil {
+			return nil, fmt.Errorf("bundle %s: %w", name, err)
+		}
+		descriptor.Annotations = map[string]string{
+			AnnotationImageName: name,
+			AnnotationRefName:   reference.Identifier(),
+		}
+		index.Manifests = append(index.Manifests, descriptor)
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return nil, fmt.Errorf("encode index.json: %w", err)
+	}
+	if err := writer.writeFile("index.json", data); err != nil {
+		return nil, err
+	}
+	if err := writer.tar.Close(); err != nil {
+		return nil, fmt.Errorf("finish bundle: %w", err)
+	}
+	return index, nil
+}
+
+// layoutWriter streams an OCI image layout into a tar archive, writing each
+// blob only once.
+type layoutWriter struct {
+	tar     *tar.Writer
+	written map[string]bool
+	options WriteOptions
+}
+
+func (w *layoutWriter) writeFile(name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	if _, err := w.tar.Write(data); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+func (w *layoutWriter) writeBlob(digest string, data []byte) error {
+	if w.written[digest] {
+		return nil
+	}
+	w.written[digest] = true
+	return w.writeFile(blobPath(digest), data)
+}
+
+// copyBlob streams a registry blob into the archive, verifying its digest
+// on the way.
+func (w *layoutWriter) copyBlob(ctx context.Context, reference registry.Reference, blob registry.Descriptor) error {
+	if w.written[blob.Digest] {
+		return nil
+	}
+	algorithm, _, _ := strings.Cut(blob.Digest, ":")
+	if algorithm != "sha256" {
+		return fmt.Errorf("blob %s: unsupported digest algorithm", blob.Digest)
+	}
+
+	content, err := w.options.Source.GetBlob(ctx, reference, blob.Digest)
+	if err != nil {
+		return fmt.Errorf("fetch blob %s: %w", blob.Digest, err)
+	}
+	defer content.Close()
+
+	header := &tar.Header{Name: blobPath(blob.Digest), Mode: 0o644, Size: blob.Size, Typeflag: tar.TypeReg}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("write blob %s: %w", blob.Digest, err)
+	}
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(w.tar, hash), content, blob.Size); err != nil {
+		return fmt.Errorf("copy blob %s: %w", blob.Digest, err)
+	}
+	if got := "sha256:" + hex.EncodeToString(hash.Sum(nil)); got != blob.Digest {
+		return fmt.Errorf("blob %s: digest mismatch, got %s", blob.Digest, got)
+	}
+	w.written[blob.Digest] = true
+	return nil
+}
+
+// addImage writes the manifest reference points at and everything it
+// references, and returns its descriptor for index.json.
+func (w *layoutWriter) addImage(ctx context.Context, reference registry.Reference) (registry.Descriptor, error) {
+	data, digest, mediaType, err := w.options.Source.GetManifest(ctx, reference)
+	if err != nil {
+		return registry.Descriptor{}, err
+	}
+
+	// Trimming an index changes its digest, so images pinned by digest
+	// are always bundled whole.
+	if registry.IsIndex(mediaType) && len(w.options.Platforms) > 0 && reference.Digest == "" {
+		data, err = filterIndex(data, w.options.Platforms)
+		if err != nil {
+			return registry.Descriptor{}, err
+		}
+		digest = registry.Digest(data)
+	}
+
+	if err := w.addContent(ctx, reference, data, mediaType); err != nil {
+		return registry.Descriptor{}, err
+	}
+	if err := w.writeBlob(digest, data); err != nil {
+		return registry.Descriptor{}, err
+	}
+	return registry.Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}, nil
+}
+
+func (w *layoutWriter) addContent(ctx context.Context, reference registry.Reference, data []byte, mediaType string) error {
+	if registry.IsIndex(mediaType) {
+		var index registry.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("parse index: %w", err)
+		}
+		for _, descriptor := range index.Manifests {
+			child := reference
+			child.Tag, child.Digest = "", descriptor.Digest
+			childData, _, childMediaType, err := w.options.Source.GetManifest(ctx, child)
+			if err != nil {
+				return fmt.Errorf("fetch %s: %w", child, err)
+			}
+			if err := w.addContent(ctx, child, childData, childMediaType); err != nil {
+				return err
+			}
+			if err := w.writeBlob(descriptor.Digest, childData); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var manifest registry.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("parse manifest: %w", err)
+	}
+	for _, blob := range append([]registry.Descriptor{manifest.Config}, manifest.Layers...) {
+		if err := w.copyBlob(ctx, reference, blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addChart writes chart as a Helm OCI artifact.
+func (w *layoutWriter) addChart(chart *Chart) (registry.Descriptor, error) {
+	config, err := json.Marshal(chart.Metadata)
+	if err != nil {
+		return registry.Descriptor{}, fmt.Errorf("encode chart metadata: %w", err)
+	}
+	manifest := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		Config:        registry.Descriptor{MediaType: MediaTypeHelmConfig, Digest: registry.Digest(config), Size: int64(len(config))},
+		Layers: []registry.Descriptor{
+			{MediaType: MediaTypeHelmChart, Digest: registry.Digest(chart.Archive), Size: int64(len(chart.Archive))},
+		},
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return registry.Descriptor{}, fmt.Errorf("encode chart manifest: %w", err)
+	}
+
+	for _, content := range [][]byte{config, chart.Archive, data} {
+		if err := w.writeBlob(registry.Digest(content), content); err != nil {
+			return registry.Descriptor{}, err
+		}
+	}
+
+	return registry.Descriptor{
+		MediaType:    registry.MediaTypeOCIManifest,
+		ArtifactType: MediaTypeHelmConfig,
+		Digest:       registry.Digest(data),
+		Size:         int64(len(data)),
+		Annotations:  map[string]string{AnnotationRefName: chart.Name() + ":" + chart.Version()},
+	}, nil
+}
+
+// filterIndex returns index data reduced to the manifests matching one of
+// platforms.
+func filterIndex(data []byte, platforms []registry.Platform) ([]byte, error) {
+	var index registry.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parse index: %w", err)
+	}
+
+	var kept []registry.Descriptor
+	for _, descriptor := range index.Manifests {
+		if descriptor.Platform == nil {
+			continue
+		}
+		for _, platform := range platforms {
+			if descriptor.Platform.Satisfies(platform) {
+				kept = append(kept, descriptor)
+				break
+			}
+		}
+	}
+	if len(kept) == 0 {
+		var wanted []string
+		for _, platform := range platforms {
+			wanted = append(wanted, platform.String())
+		}
+		return nil, fmt.Errorf("no manifest for %s", strings.Join(wanted, ", "))
+	}
+
+	index.Manifests = kept
+	return json.Marshal(index)
+}
+
+func blobPath(digest string) string {
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	return "blobs/" + algorithm + "/" + encoded
+}
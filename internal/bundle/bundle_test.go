@@ -0,0 +1,149 @@
+package bundle
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tonur/heft/internal/mirror"
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+)
+
+func writeTestChart(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "chart-src")
+	if err := os.MkdirAll(filepath.Join(dir, "templates"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"Chart.yaml":                "apiVersion: v2\nname: demo\nversion: 0.1.0\nappVersion: \"1.0\"\n",
+		"values.yaml":               "image: example/app:v1\n",
+		"templates/deployment.yaml": "kind: Deployment\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadChartPackagesDirectory(t *testing.T) {
+	chart, err := LoadChart(writeTestChart(t))
+	if err != nil {
+		t.Fatalf("LoadChart: %v", err)
+	}
+	if chart.Name() != "demo" || chart.Version() != "0.1.0" || chart.Metadata["appVersion"] != "1.0" {
+		t.Fatalf("unexpected metadata: %v", chart.Metadata)
+	}
+
+	packaged := filepath.Join(t.TempDir(), "demo-0.1.0.tgz")
+	if err := os.WriteFile(packaged, chart.Archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadChart(packaged)
+	if err != nil {
+		t.Fatalf("LoadChart(tgz): %v", err)
+	}
+	if reloaded.Name() != "demo" || string(reloaded.Archive) != string(chart.Archive) {
+		t.Fatalf("expected packaged chart to load unchanged, got %v", reloaded.Metadata)
+	}
+}
+
+func TestWriteAndLoadRoundTrip(t *testing.T) {
+	source := registrytest.New(t)
+	target := registrytest.New(t)
+
+	amd64 := source.AddImage("org/app", "", []byte(`{"os":"linux","architecture":"amd64"}`), []byte("layer-amd64"), []byte("shared"))
+	arm64 := source.AddImage("org/app", "", []byte(`{"os":"linux","architecture":"arm64"}`), []byte("layer-arm64"), []byte("shared"))
+	source.AddIndex("org/app", "v1", map[string]registry.Platform{
+		amd64: {OS: "linux", Architecture: "amd64"},
+		arm64: {OS: "linux", Architecture: "arm64"},
+	})
+	source.AddImage("org/tool", "2.0", []byte(`{"os":"linux","architecture":"amd64"}`), []byte("tool-layer"))
+
+	chart, err := LoadChart(writeTestChart(t))
+	if err != nil {
+		t.Fatalf("LoadChart: %v", err)
+	}
+	images := []scan.ImageFinding{
+		{Name: source.Host() + "/org/app:v1"},
+		{Name: source.Host() + "/org/tool:2.0"},
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	platform, _ := registry.ParsePlatform("linux/arm64")
+	index, err := Write(context.Background(), file, chart, images, WriteOptions{
+		Platforms: []registry.Platform{platform},
+		Source:    &registry.Client{},
+	})
+	file.Close()
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(index.Manifests) != 3 || index.Manifests[0].ArtifactType != MediaTypeHelmConfig {
+		t.Fatalf("unexpected index: %+v", index.Manifests)
+	}
+
+	layout, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer layout.Close()
+	if _, ok := layout.blobs[registry.Digest([]byte("layer-amd64"))]; ok {
+		t.Fatalf("expected amd64 layer to be left out for --platform linux/arm64")
+	}
+
+	mapping, _ := mirror.NewMapping(mirror.StrategyFlatten, "")
+	options := mirror.Options{To: target.Host() + "/offline", Mapping: mapping, Concurrency: 2, Target: &registry.Client{}}
+	report, err := Load(context.Background(), layout, options)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if report.Summary.Copied != 3 || report.Summary.Failed != 0 {
+		t.Fatalf("unexpected summary: %+v (%+v)", report.Summary, report.Images)
+	}
+	if _, ok := target.Manifest("offline/app", "v1"); !ok {
+		t.Fatalf("expected app index in target")
+	}
+	if _, ok := target.Manifest("offline/app", arm64); !ok {
+		t.Fatalf("expected arm64 manifest in target")
+	}
+	if _, ok := target.Manifest("offline/tool", "2.0"); !ok {
+		t.Fatalf("expected tool image in target")
+	}
+	if !target.HasBlob("offline/charts/demo", registry.Digest(chart.Archive)) {
+		t.Fatalf("expected chart archive in offline/charts/demo")
+	}
+	if _, ok := target.Manifest("offline/charts/demo", "0.1.0"); !ok {
+		t.Fatalf("expected chart tagged 0.1.0")
+	}
+
+	report, err = Load(context.Background(), layout, options)
+	if err != nil {
+		t.Fatalf("second Load: %v", err)
+	}
+	if report.Summary.Skipped != 3 {
+		t.Fatalf("expected second load to skip everything, got %+v", report.Summary)
+	}
+}
+
+func TestWriteFailsOnMissingImage(t *testing.T) {
+	source := registrytest.New(t)
+	chart, err := LoadChart(writeTestChart(t))
+	if err != nil {
+		t.Fatalf("LoadChart: %v", err)
+	}
+	_, err = Write(context.Background(), io.Discard, chart, []scan.ImageFinding{{Name: source.Host() + "/org/missing:v1"}}, WriteOptions{Source: &registry.Client{}})
+	if err == nil {
+		t.Fatalf("expected error for missing image")
+	}
+}
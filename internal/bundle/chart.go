@@ -0,0 +1,154 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Chart is a packaged Helm chart archive with its Chart.yaml metadata.
+type Chart struct {
+	Archive  []byte
+	Metadata map[string]interface{}
+}
+
+// Name returns the chart name from Chart.yaml.
+func (c *Chart) Name() string {
+	name, _ := c.Metadata["name"].(string)
+	return name
+}
+
+// Version returns the chart version from Chart.yaml.
+func (c *Chart) Version() string {
+	version, _ := c.Metadata["version"].(string)
+	return version
+}
+
+// LoadChart reads the chart at path, which is either a packaged .tgz or a
+// chart directory. Directories are packaged the way "helm package" lays out
+// an archive: every file under a top-level directory named after the chart.
+func LoadChart(path string) (*Chart, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var archive []byte
+	if info.IsDir() {
+		archive, err = packageChart(path)
+	} else {
+		archive, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("package chart %q: %w", path, err)
+	}
+
+	metadata, err := archiveMetadata(archive)
+	if err != nil {
+		return nil, fmt.Errorf("read chart %q: %w", path, err)
+	}
+	chart := &Chart{Archive: archive, Metadata: metadata}
+	if chart.Name() == "" || chart.Version() == "" {
+		return nil, fmt.Errorf("read chart %q: Chart.yaml must set name and version", path)
+	}
+	return chart, nil
+}
+
+func packageChart(root string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(root, "Chart.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var metadata struct {
+		Name string `yaml:"name"`
+	}
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("parse Chart.yaml: %w", err)
+	}
+	if metadata.Name == "" {
+		return nil, fmt.Errorf("Chart.yaml has no name")
+	}
+
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	tw := tar.NewWriter(gz)
+	err = filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:     path.Join(metadata.Name, filepath.ToSlash(relative)),
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// archiveMetadata returns the top-level Chart.yaml of a packaged chart.
+func archiveMetadata(archive []byte) (map[string]interface{}, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no Chart.yaml in archive")
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(strings.TrimPrefix(header.Name, "./"), "/")
+		if len(parts) != 2 || parts[1] != "Chart.yaml" {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		var metadata map[string]interface{}
+		if err := yaml.Unmarshal(data, &metadata); err != nil {
+			return nil, fmt.Errorf("parse Chart.yaml: %w", err)
+		}
+		return metadata, nil
+	}
+}
@@ -0,0 +1,228 @@
+package bundle
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tonur/heft/internal/mirror"
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Layout is a bundle archive opened for reading. Blobs are read straight
+// from the archive, so loading a bundle needs no extra disk space. It
+// implements mirror.Source.
+type Layout struct {
+	Index registry.Index
+
+	file       *os.File
+	blobs      map[string]blobSection
+	mediaTypes map[string]string
+}
+
+var _ mirror.Source = (*Layout)(nil)
+
+type blobSection struct {
+	offset int64
+	size   int64
+}
+
+// Open opens the bundle archive at path. Callers must Close the layout.
+func Open(path string) (*Layout, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	layout := &Layout{file: file, blobs: map[string]blobSection{}, mediaTypes: map[string]string{}}
+	if err := layout.read(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("read bundle %q: %w", path, err)
+	}
+	return layout, nil
+}
+
+// Close closes the underlying archive.
+func (l *Layout) Close() error {
+	return l.file.Close()
+}
+
+// read indexes the archive. The tar reader consumes exactly the header
+// blocks of each entry, so the file offset after Next is where the entry's
+// content starts.
+func (l *Layout) read() error {
+	var indexData []byte
+	tr := tar.NewReader(l.file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(header.Name, "./")
+		switch {
+		case name == "index.json":
+			if indexData, err = io.ReadAll(tr); err != nil {
+				return err
+			}
+		case strings.HasPrefix(name, "blobs/"):
+			algorithm, encoded, ok := strings.Cut(strings.TrimPrefix(name, "blobs/"), "/")
+			if !ok {
+				continue
+			}
+			offset, err := l.file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			l.blobs[algorithm+":"+encoded] = blobSection{offset: offset, size: header.Size}
+		}
+	}
+
+	if indexData == nil {
+		return fmt.Errorf("no index.json, not an OCI image layout")
+	}
+	if err := json.Unmarshal(indexData, &l.Index); err != nil {
+		return fmt.Errorf("parse index.json: %w", err)
+	}
+	return l.recordMediaTypes(l.Index.Manifests)
+}
+
+// recordMediaTypes remembers the media type of every manifest reachable
+// from descriptors, since blobs themselves do not carry one.
+func (l *Layout) recordMediaTypes(descriptors []registry.Descriptor) error {
+	for _, descriptor := range descriptors {
+		l.mediaTypes[descriptor.Digest] = descriptor.MediaType
+		if !registry.IsIndex(descriptor.MediaType) {
+			continue
+		}
+		data, err := l.readBlob(descriptor.Digest)
+		if err != nil {
+			return err
+		}
+		var index registry.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("parse index %s: %w", descriptor.Digest, err)
+		}
+		if err := l.recordMediaTypes(index.Manifests); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Layout) readBlob(digest string) ([]byte, error) {
+	section, ok := l.blobs[digest]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not in bundle", digest)
+	}
+	data := make([]byte, section.size)
+	if _, err := l.file.ReadAt(data, section.offset); err != nil {
+		return nil, fmt.Errorf("read blob %s: %w", digest, err)
+	}
+	if got := registry.Digest(data); got != digest {
+		return nil, fmt.Errorf("blob %s: digest mismatch, got %s", digest, got)
+	}
+	return data, nil
+}
+
+// GetManifest returns the manifest reference points at: by digest, or by
+// the image name recorded in index.json.
+func (l *Layout) GetManifest(ctx context.Context, reference registry.Reference) (data []byte, digest, mediaType string, err error) {
+	digest = reference.Digest
+	if digest == "" {
+		for _, descriptor := range l.Index.Manifests {
+			named, err := registry.ParseReference(descriptor.Annotations[AnnotationImageName])
+			if err == nil && named == reference {
+				digest = descriptor.Digest
+				break
+			}
+		}
+		if digest == "" {
+			return nil, "", "", fmt.Errorf("image %s not in bundle", reference)
+		}
+	}
+
+	data, err = l.readBlob(digest)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return data, digest, l.mediaTypes[digest], nil
+}
+
+// GetBlob opens the blob with digest. The reference is ignored; a layout
+// has a single blob store.
+func (l *Layout) GetBlob(ctx context.Context, reference registry.Reference, digest string) (io.ReadCloser, error) {
+	section, ok := l.blobs[digest]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not in bundle", digest)
+	}
+	return io.NopCloser(io.NewSectionReader(l.file, section.offset, section.size)), nil
+}
+
+// Load pushes every image in layout to options.To, named by
+// options.Mapping, and the chart to <To>/charts/<name>:<version> so it can
+// be installed with helm from there. Like mirror.Run, failures are
+// recorded per entry and a re-run skips what is already in place.
+func Load(ctx context.Context, layout *Layout, options mirror.Options) (*mirror.Report, error) {
+	var images []scan.ImageFinding
+	var charts []registry.Descriptor
+	for _, descriptor := range layout.Index.Manifests {
+		if descriptor.ArtifactType == MediaTypeHelmConfig {
+			charts = append(charts, descriptor)
+			continue
+		}
+		if name := descriptor.Annotations[AnnotationImageName]; name != "" {
+			images = append(images, scan.ImageFinding{Name: name})
+		}
+	}
+
+	options.Source = layout
+	report, err := mirror.Run(ctx, images, options)
+	if err != nil {
+		return report, err
+	}
+
+	results := report.Images
+	for _, descriptor := range charts {
+		results = append(results, loadChart(ctx, layout, descriptor, options))
+	}
+	return mirror.NewReport(results), ctx.Err()
+}
+
+func loadChart(ctx context.Context, layout *Layout, descriptor registry.Descriptor, options mirror.Options) mirror.ImageResult {
+	name := descriptor.Annotations[AnnotationRefName]
+	result := mirror.ImageResult{Source: "chart " + name, Status: mirror.StatusPlanned}
+
+	target, err := registry.ParseReference(strings.TrimRight(options.To, "/") + "/charts/" + name)
+	if err != nil {
+		result.Status, result.Error = mirror.StatusFailed, err.Error()
+		return result
+	}
+	result.Target = target.String()
+	if options.DryRun {
+		return result
+	}
+
+	source := registry.Reference{Digest: descriptor.Digest}
+	digest, skipped, err := mirror.Copy(ctx, layout, options.Target, source, target)
+	if err != nil {
+		result.Status, result.Error = mirror.StatusFailed, err.Error()
+		return result
+	}
+	result.Digest = digest
+	result.Status = mirror.StatusCopied
+	if skipped {
+		result.Status = mirror.StatusSkipped
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/tonur/heft/internal/bundle"
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// bundleSummary is printed after a bundle has been written.
+type bundleSummary struct {
+	Bundle string              `yaml:"bundle"`
+	Chart  string              `yaml:"chart"`
+	Images []bundleSummaryItem `yaml:"images"`
+}
+
+type bundleSummaryItem struct {
+	Name   string `yaml:"name"`
+	Digest string `yaml:"digest"`
+}
+
+// newBundleCommand constructs the bundle subcommand, which writes a chart
+// and its images to an OCI image layout archive, and its load subcommand.
+func newBundleCommand() *cobra.Command {
+	bundleCommand := &cobra.Command{
+		Use:   "bundle <chart-ref> -o <bundle.tar>",
+		Short: "Write a Helm chart and all of its images to one OCI layout archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			output, _ := command.Flags().GetString("output")
+			platformValues, _ := command.Flags().GetStringArray("platform")
+
+			if output == "" {
+				return fmt.Errorf("--output is required")
+			}
+			var platforms []registry.Platform
+			for _, value := range platformValues {
+				platform, err := registry.ParsePlatform(value)
+				if err != nil {
+					return err
+				}
+				platforms = append(platforms, platform)
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			// Fetch remote charts once and scan the same copy that goes into
+			// the bundle.
+			chartPath, cleanup, err := scan.FetchChart(ctx, arguments[0])
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			chart, err := bundle.LoadChart(chartPath)
+			if err != nil {
+				return err
+			}
+
+			result, err := scanFunction(ctx, chartPath, scanOptionsFromFlags(command))
+			if err != nil {
+				return err
+			}
+
+			file, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("create bundle: %w", err)
+			}
+			index, err := bundle.Write(ctx, file, chart, result.Images, bundle.WriteOptions{
+				Platforms: platforms,
+				Source:    newCLIRegistryClient(),
+			})
+			if closeErr := file.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("write bundle: %w", closeErr)
+			}
+			if err != nil {
+				os.Remove(output)
+				return err
+			}
+
+			summary := bundleSummary{Bundle: output, Chart: chart.Name() + ":" + chart.Version()}
+			for _, descriptor := range index.Manifests {
+				if name := descriptor.Annotations[bundle.AnnotationImageName]; name != "" {
+					summary.Images = append(summary.Images, bundleSummaryItem{Name: name, Digest: descriptor.Digest})
+				}
+			}
+			encoder := yaml.NewEncoder(os.Stdout)
+			defer encoder.Close()
+			if err := encoder.Encode(summary); err != nil {
+				return fmt.Errorf("encode summary: %w", err)
+			}
+			return nil
+		},
+	}
+
+	addScanFlags(bundleCommand, scan.ConfidenceMedium)
+	bundleCommand.Flags().StringP("output", "o", "", "path of the bundle archive to write")
+	bundleCommand.Flags().StringArray("platform", nil, "only bundle this platform of multi-platform images, e.g. linux/amd64 (repeatable, default all)")
+
+	bundleCommand.AddCommand(newBundleLoadCommand())
+	return bundleCommand
+}
+
+// newBundleLoadCommand constructs "bundle load", which pushes the contents
+// of a bundle archive into a registry.
+func newBundleLoadCommand() *cobra.Command {
+	loadCommand := &cobra.Command{
+		Use:   "load <bundle.tar> --to <registry>/<prefix>",
+		Short: "Push the chart and images in a bundle to a registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			options, err := mirrorOptionsFromFlags(command)
+			if err != nil {
+				return err
+			}
+
+			layout, err := bundle.Open(arguments[0])
+			if err != nil {
+				return err
+			}
+			defer layout.Close()
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			report, err := bundle.Load(ctx, layout, options)
+			return writeMirrorReport(report, err)
+		},
+	}
+
+	addMirrorFlags(loadCommand)
+	loadCommand.Flags().Duration("timeout", 0, "abort after this duration, e.g. 2m (0 disables the timeout)")
+	return loadCommand
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestBundleWritesAndLoads verifies that bundle writes the scanned images
+// and chart to an archive and that bundle load pushes them to a registry.
+func TestBundleWritesAndLoads(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	source := registrytest.New(t)
+	target := registrytest.New(t)
+	source.AddImage("org/app", "v1", []byte(`{"os":"linux","architecture":"amd64"}`), []byte("layer"))
+
+	chartDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: demo\nversion: 1.2.3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotOptions scan.Options
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotOptions = scannerOptions(t, chartRef, options)
+		return &scan.ScanResult{Images: []scan.ImageFinding{{Name: source.Host() + "/org/app:v1"}}}, nil
+	}
+
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	output := filepath.Join(t.TempDir(), "bundle.tar")
+	command := newRootCommand()
+	command.SetArgs([]string{"bundle", chartDir, "-o", output, "--platform", "linux/amd64"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("bundle returned error: %v", err)
+	}
+	if gotOptions.ChartPath != chartDir || gotOptions.MinConfidence != scan.ConfidenceMedium {
+		t.Fatalf("unexpected scan options: %+v", gotOptions)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"bundle", "load", output, "--to", target.Host() + "/airgap"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("bundle load returned error: %v", err)
+	}
+	if _, ok := target.Manifest("airgap/org/app", "v1"); !ok {
+		t.Fatalf("expected image in target registry")
+	}
+	if _, ok := target.Manifest("airgap/charts/demo", "1.2.3"); !ok {
+		t.Fatalf("expected chart in target registry")
+	}
+}
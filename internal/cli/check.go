@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tonur/heft/internal/policy"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// newCheckCommand constructs the check subcommand, which scans a chart and
+// evaluates the images against a policy file.
+func newCheckCommand() *cobra.Command {
+	checkCommand := &cobra.Command{
+		Use:   "check <chart-ref>",
+		Short: "Check a Helm chart's images against a policy",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			loaded, threshold, err := policyFromFlags(ctx, command)
+			if err != nil {
+				return err
+			}
+
+			result, err := scanFunction(ctx, arguments[0], scanOptionsFromFlags(command))
+			if err != nil {
+				return err
+			}
+			violations, err := loaded.Check(ctx, result)
+			if err != nil {
+				return err
+			}
+			return policy.Report(os.Stdout, violations, threshold)
+		},
+	}
+
+	addScanFlags(checkCommand, scan.ConfidenceLow)
+	addPolicyFlags(checkCommand, policy.DefaultFile)
+	return checkCommand
+}
+
+// addPolicyFlags registers --policy, defaulting to defaultFile, --rego and
+// --fail-on.
+func addPolicyFlags(command *cobra.Command, defaultFile string) {
+	command.Flags().String("policy", defaultFile, "policy file to evaluate images against")
+	command.Flags().StringArray("rego", nil, "Rego file or directory whose deny, violation and warn rules are evaluated against the scan result (repeatable)")
+	command.Flags().String("fail-on", "", "lowest violation severity that fails the command (info|warning|error|none, default: the policy's failOn)")
+}
+
+// policyFromFlags loads the policy file and any --rego modules, and
+// resolves the fail-on threshold, with --fail-on taking precedence over the
+// policy's failOn. Without a policy file only the Rego modules are used.
+func policyFromFlags(ctx context.Context, command *cobra.Command) (*policy.Policy, policy.Severity, error) {
+	file, _ := command.Flags().GetString("policy")
+	regoPaths, _ := command.Flags().GetStringArray("rego")
+
+	loaded := &policy.Policy{FailOn: policy.SeverityError}
+	if usePolicyFile(command, file, regoPaths) {
+		var err error
+		if loaded, err = policy.Load(file); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(regoPaths) > 0 {
+		if err := loaded.AddRego(ctx, regoPaths); err != nil {
+			return nil, "", err
+		}
+	}
+
+	threshold := loaded.FailOn
+	if failOn, _ := command.Flags().GetString("fail-on"); failOn != "" {
+		var err error
+		if threshold, err = policy.ParseSeverity(failOn); err != nil {
+			return nil, "", err
+		}
+	}
+	return loaded, threshold, nil
+}
+
+// usePolicyFile reports whether file should be loaded. A default policy
+// file that does not exist is skipped when Rego modules were given.
+func usePolicyFile(command *cobra.Command, file string, regoPaths []string) bool {
+	if file == "" {
+		return false
+	}
+	if command.Flags().Changed("policy") || len(regoPaths) == 0 {
+		return true
+	}
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// policyRequested reports whether any policy flag is set on command.
+func policyRequested(command *cobra.Command) bool {
+	file, _ := command.Flags().GetString("policy")
+	regoPaths, _ := command.Flags().GetStringArray("rego")
+	return file != "" || len(regoPaths) > 0
+}
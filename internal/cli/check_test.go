@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestCheckAndScanPolicyFailOnSeverity verifies that check and scan
+// --policy fail on violations at the configured severity, and that
+// --fail-on overrides the policy's threshold.
+func TestCheckAndScanPolicyFailOnSeverity(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		return &scan.ScanResult{Images: []scan.ImageFinding{
+			{Name: "ghcr.io/org/app:latest", Confidence: scan.ConfidenceHigh, File: "values.yaml", Line: 4},
+		}}, nil
+	}
+
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	document := "rules:\n  - name: no-latest\n    severity: warning\n    deny:\n      tags: [latest]\n"
+	if err := os.WriteFile(policyFile, []byte(document), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"check", "my-chart", "--policy", policyFile})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("expected warnings to pass with the default failOn error, got %v", err)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"check", "my-chart", "--policy", policyFile, "--fail-on", "warning"})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "1 violation(s)") {
+		t.Fatalf("expected policy failure, got %v", err)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--policy", policyFile, "--fail-on", "info"})
+	if err := command.Execute(); err == nil {
+		t.Fatalf("expected scan --policy to fail")
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"check", "my-chart", "--policy", filepath.Join(t.TempDir(), "missing.yaml")})
+	if err := command.Execute(); err == nil {
+		t.Fatalf("expected error for a missing policy file")
+	}
+}
+
+// TestCheckRegoWithoutPolicyFile verifies that --rego works on its own when
+// the default policy file does not exist.
+func TestCheckRegoWithoutPolicyFile(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		return &scan.ScanResult{Images: []scan.ImageFinding{{Name: "docker.io/library/nginx:1", Confidence: scan.ConfidenceHigh}}}, nil
+	}
+
+	module := filepath.Join(t.TempDir(), "deny.rego")
+	document := "package heft\n\ndeny contains msg if {\n\tsome image in input.images\n\tmsg := sprintf(\"%s is denied\", [image.name])\n}\n"
+	if err := os.WriteFile(module, []byte(document), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+
+	command := newRootCommand()
+	command.SetArgs([]string{"check", "my-chart", "--rego", module})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "1 violation(s) at or above error") {
+		t.Fatalf("expected rego deny to fail the check, got %v", err)
+	}
+}
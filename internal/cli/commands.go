@@ -1,94 +1,191 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 
+	"github.com/tonur/heft/internal/policy"
+	"github.com/tonur/heft/internal/registry"
 	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
 )
 
-// scanFunction is the function used by the CLI to run a scan.
-// It is a variable to allow tests to inject a fake implementation.
-var scanFunction = scan.Scan
+// scanFunction is the function used by the CLI to scan chartRef with
+// options. It is a variable to allow tests to inject a fake implementation.
+var scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+	return heft.New(options...).Scan(ctx, chartRef)
+}
+
+// scanReleasesFunction scans the releases of a helmfile. It is a variable
+// to allow tests to inject a fake implementation.
+var scanReleasesFunction = func(ctx context.Context, releases []scan.Release, options []heft.Option) (*scan.ScanResult, error) {
+	return heft.New(options...).ScanReleases(ctx, releases)
+}
 
-// Execute is the entry point for the heft CLI.
+// Execute is the entry point for the heft CLI. An interrupt or termination
+// signal cancels the running command so helm subprocesses are stopped and
+// temporary chart directories are cleaned up before exiting.
 func Execute() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	command := newRootCommand()
+	command.SetContext(ctx)
 	if err := executeCommand(command); err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			if exitErr.message != "" {
+				fmt.Fprintln(os.Stderr, "error:", exitErr.message)
+			}
+			exitFunction(exitErr.code)
+			return
+		}
 		fmt.Fprintln(os.Stderr, "error:", err)
 		exitFunction(1)
 	}
 }
 
+// findPlugins finds the detector plugins. It is a variable so tests can
+// stub it.
+var findPlugins = heft.FindDetectorPlugins
+
+// pluginDetectors are the detector plugins loaded for the command. Scans
+// run them after the built-in detectors unless --detectors says otherwise.
+var pluginDetectors []scan.Detector
+
+// pluginsLoaded records that loadPlugins has run.
+var pluginsLoaded bool
+
+// loadPlugins loads the detector plugins listed in the config file and
+// found on PATH, once, and registers them so --detectors can name them.
+// Plugins that fail to load are skipped and logged.
+func loadPlugins(ctx context.Context) {
+	if pluginsLoaded {
+		return
+	}
+	pluginsLoaded = true
+	detectors, errs := findPlugins(ctx)
+	for _, err := range errs {
+		logger.Warn("plugin not loaded", "error", err)
+	}
+	for _, detector := range detectors {
+		if err := scan.RegisterDetector(detector); err != nil {
+			logger.Warn("plugin not loaded", "plugin", detector.Name(), "error", err)
+			continue
+		}
+		pluginDetectors = append(pluginDetectors, detector)
+	}
+}
+
+// prepareDetectors loads the detector plugins for commands that run
+// detectors, those with a --detectors flag, and then resolves the names
+// given to the flag, which may name plugins. Other commands never start
+// plugins.
+func prepareDetectors(command *cobra.Command) error {
+	flag := command.Flags().Lookup("detectors")
+	if flag == nil {
+		return nil
+	}
+	loadPlugins(command.Context())
+	return flag.Value.(*detectorsFlag).resolve()
+}
+
+// exitCodeError makes Execute exit with code instead of 1. Commands return
+// it for outcomes that are not failures but that scripts need to tell
+// apart, such as a diff finding changes; an empty message prints nothing.
+type exitCodeError struct {
+	code    int
+	message string
+}
+
+func (e *exitCodeError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.message
+}
+
 // newRootCommand constructs the root heft command with the scan subcommand
 // wired to call scanFunction.
 func newRootCommand() *cobra.Command {
 	heftCommand := &cobra.Command{
 		Use:   "heft",
 		Short: "Scan Helm charts for container images",
+		PersistentPreRunE: func(command *cobra.Command, arguments []string) error {
+			if err := configureLogging(command); err != nil {
+				return err
+			}
+			return prepareDetectors(command)
+		},
 	}
+	addLogFlags(heftCommand)
 
 	// Define the scan subcommand.
 	scanCommand := &cobra.Command{
-		Use:   "scan <chart-ref>",
+		Use:   "scan <chart-ref> | --helmfile <file>",
 		Short: "Scan a Helm chart for container images",
-		Args:  cobra.ExactArgs(1),
+		Args: func(command *cobra.Command, arguments []string) error {
+			if command.Flags().Changed("helmfile") {
+				return cobra.NoArgs(command, arguments)
+			}
+			return cobra.ExactArgs(1)(command, arguments)
+		},
 		RunE: func(command *cobra.Command, arguments []string) error {
-			chartRef := arguments[0]
-
-			minConfidenceString, _ := command.Flags().GetString("min-confidence")
-			noHelmDeps, _ := command.Flags().GetBool("no-helm-deps")
-			includeOptionalDeps, _ := command.Flags().GetBool("include-optional-deps")
-			verbose, _ := command.Flags().GetBool("verbose")
-			setVals, _ := command.Flags().GetStringArray("set")
-			setStringVals, _ := command.Flags().GetStringArray("set-string")
-			valuesFiles, _ := command.Flags().GetStringArray("values")
-			fValues, _ := command.Flags().GetStringArray("f")
-
-			// Combine -f and --values inputs.
-			valuesFiles = append(valuesFiles, fValues...)
-
-			// Map min-confidence string to Confidence type.
-			minConfidence := scan.ConfidenceLow
-			switch minConfidenceString {
-			case string(scan.ConfidenceHigh):
-				minConfidence = scan.ConfidenceHigh
-			case string(scan.ConfidenceMedium):
-				minConfidence = scan.ConfidenceMedium
-			case string(scan.ConfidenceLow):
-				minConfidence = scan.ConfidenceLow
+			helmfilePath, _ := command.Flags().GetString("helmfile")
+			environment, _ := command.Flags().GetString("environment")
+			resolveDigests, _ := command.Flags().GetBool("resolve-digests")
+			resolvePlatforms, _ := command.Flags().GetBool("platforms")
+			requiredPlatforms, _ := command.Flags().GetStringArray("require-platform")
+			failOnDetectorError, _ := command.Flags().GetBool("fail-on-detector-error")
+
+			// Reject malformed platforms before spending time on a scan.
+			for _, platform := range requiredPlatforms {
+				if _, err := registry.ParsePlatform(platform); err != nil {
+					return err
+				}
 			}
 
-			// Build combined Helm values flags in the same format
-			// expected by scan.Options ("--set=key=val" style).
-			var helmValues []string
-			for _, v := range setVals {
-				helmValues = append(helmValues, "--set="+v)
+			chartRef := helmfilePath
+			if len(arguments) > 0 {
+				chartRef = arguments[0]
 			}
-			for _, v := range setStringVals {
-				helmValues = append(helmValues, "--set-string="+v)
+			options := scanOptionsFromFlags(command)
+			if resolveDigests {
+				options = append(options, heft.WithDigests())
 			}
-
-			var helmValuesFiles []string
-			for _, vf := range valuesFiles {
-				helmValuesFiles = append(helmValuesFiles, "--values="+vf)
+			if resolvePlatforms || len(requiredPlatforms) > 0 {
+				options = append(options, heft.WithPlatforms())
 			}
 
-			options := scan.Options{
-				ChartPath:           chartRef,
-				Values:              helmValues,
-				ValuesFiles:         helmValuesFiles,
-				HelmBin:             "helm",
-				DisableHelmDeps:     noHelmDeps,
-				IncludeOptionalDeps: includeOptionalDeps,
-				MinConfidence:       minConfidence,
-				Verbose:             verbose,
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			var loadedPolicy *policy.Policy
+			var failOn policy.Severity
+			if policyRequested(command) {
+				var err error
+				if loadedPolicy, failOn, err = policyFromFlags(ctx, command); err != nil {
+					return err
+				}
 			}
 
-			result, err := scanFunction(options)
+			var result *scan.ScanResult
+			var err error
+			if helmfilePath != "" {
+				result, err = scanHelmfile(ctx, helmfilePath, environment, options)
+			} else {
+				result, err = scanFunction(ctx, chartRef, options)
+			}
 			if err != nil {
 				return err
 			}
@@ -98,22 +195,176 @@ func newRootCommand() *cobra.Command {
 			if err := encoder.Encode(result); err != nil {
 				return fmt.Errorf("encode result: %w", err)
 			}
+
+			if len(requiredPlatforms) > 0 {
+				if err := scan.CheckPlatforms(result.Images, requiredPlatforms); err != nil {
+					return err
+				}
+			}
+			if loadedPolicy != nil {
+				violations, err := loadedPolicy.Check(ctx, result)
+				if err != nil {
+					return err
+				}
+				if err := policy.Report(os.Stderr, violations, failOn); err != nil {
+					return err
+				}
+			}
+			if failOnDetectorError {
+				if errs := result.DetectorErrors(); len(errs) > 0 {
+					return fmt.Errorf("%d detector(s) failed:\n  %s", len(errs), strings.Join(errs, "\n  "))
+				}
+			}
 			return nil
 		},
 	}
 
-	scanCommand.Flags().String("min-confidence", string(scan.ConfidenceLow), "minimum image confidence to include (low|medium|high)")
-	scanCommand.Flags().Bool("no-helm-deps", false, "disable automatic 'helm dependency build'")
-	scanCommand.Flags().Bool("include-optional-deps", false, "include optional chart dependencies when scanning")
-	scanCommand.Flags().BoolP("verbose", "v", false, "enable verbose logging")
-	scanCommand.Flags().StringArray("set", nil, "set Helm values (key=val, repeatable)")
-	scanCommand.Flags().StringArray("set-string", nil, "set Helm string values (key=val, repeatable)")
-	scanCommand.Flags().StringArrayP("values", "f", nil, "values file (repeatable)")
+	addScanFlags(scanCommand, scan.ConfidenceLow)
+	scanCommand.Flags().Bool("resolve-digests", false, "resolve each image tag to its manifest digest in the registry")
+	scanCommand.Flags().Bool("platforms", false, "list the OS/architecture platforms each image supports")
+	scanCommand.Flags().StringArray("require-platform", nil, "fail if any image lacks this platform, e.g. linux/arm64 (repeatable, implies --platforms)")
+	scanCommand.Flags().Bool("fail-on-detector-error", false, "fail if any detector fails on the chart, e.g. when helm cannot render it")
+	scanCommand.Flags().String("helmfile", "", "scan every release in this helmfile instead of a chart")
+	scanCommand.Flags().String("environment", "", "helmfile environment whose values to use (default \"default\")")
+	addPolicyFlags(scanCommand, "")
 
 	heftCommand.AddCommand(scanCommand)
+	heftCommand.AddCommand(newMirrorCommand())
+	heftCommand.AddCommand(newBundleCommand())
+	heftCommand.AddCommand(newValuesRewriteCommand())
+	heftCommand.AddCommand(newCheckCommand())
+	heftCommand.AddCommand(newDiffCommand())
+	heftCommand.AddCommand(newLockCommand())
+	heftCommand.AddCommand(newVerifyLockCommand())
+	heftCommand.AddCommand(newOutdatedCommand())
+	heftCommand.AddCommand(newVulnsCommand())
+	heftCommand.AddCommand(newVerifySignaturesCommand())
 	return heftCommand
 }
 
+// scanHelmfile scans the releases of the helmfile at path in environment.
+func scanHelmfile(ctx context.Context, path, environment string, options []heft.Option) (*scan.ScanResult, error) {
+	releases, warnings, err := heft.Helmfile(path, environment)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		logger.Warn(warning, "helmfile", path)
+	}
+	logger.Debug("loaded helmfile", "helmfile", path, "environment", environment, "releases", len(releases))
+	return scanReleasesFunction(ctx, releases, options)
+}
+
+// addScanFlags registers the flags that control how a chart is scanned on
+// command, so that every command built on the scan pipeline accepts them.
+func addScanFlags(command *cobra.Command, defaultMinConfidence scan.Confidence) {
+	command.Flags().String("min-confidence", string(defaultMinConfidence), "minimum image confidence to include (low|medium|high)")
+	command.Flags().Bool("no-helm-deps", false, "disable automatic 'helm dependency build'")
+	command.Flags().Bool("include-optional-deps", false, "include optional chart dependencies when scanning")
+	command.Flags().BoolP("verbose", "v", false, "enable verbose logging")
+	command.Flags().StringArray("set", nil, "set Helm values (key=val, repeatable)")
+	command.Flags().StringArray("set-string", nil, "set Helm string values (key=val, repeatable)")
+	command.Flags().StringArrayP("values", "f", nil, "values file (repeatable)")
+	command.Flags().Duration("timeout", 0, "abort after this duration, e.g. 2m (0 disables the timeout)")
+	command.Flags().Int("concurrency", scan.DefaultConcurrency, "number of detectors, subcharts and images processed in parallel")
+	command.Flags().Var(&detectorsFlag{}, "detectors", "comma-separated detectors to run on charts, in order (default rendered,static,regex and any plugins)")
+}
+
+// detectorsFlag is the --detectors flag. Names are resolved against the
+// detector registry by prepareDetectors once plugins are loaded, so
+// unknown names are reported before any scan starts.
+type detectorsFlag struct {
+	names     []string
+	detectors []scan.Detector
+}
+
+func (f *detectorsFlag) String() string { return strings.Join(f.names, ",") }
+func (f *detectorsFlag) Type() string   { return "strings" }
+
+func (f *detectorsFlag) Set(value string) error {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no detectors given")
+	}
+	f.names = names
+	return nil
+}
+
+// resolve looks up the detectors the flag names, if it was given.
+func (f *detectorsFlag) resolve() error {
+	if f.names == nil {
+		return nil
+	}
+	detectors, err := scan.LookupDetectors(f.names)
+	if err != nil {
+		return fmt.Errorf("invalid --detectors: %w", err)
+	}
+	f.detectors = detectors
+	return nil
+}
+
+// scanOptionsFromFlags builds the scanner options for the flags registered
+// by addScanFlags.
+func scanOptionsFromFlags(command *cobra.Command) []heft.Option {
+	minConfidence, _ := command.Flags().GetString("min-confidence")
+	noHelmDeps, _ := command.Flags().GetBool("no-helm-deps")
+	includeOptionalDeps, _ := command.Flags().GetBool("include-optional-deps")
+	verbose, _ := command.Flags().GetBool("verbose")
+	concurrency, _ := command.Flags().GetInt("concurrency")
+	setValues, _ := command.Flags().GetStringArray("set")
+	setStringValues, _ := command.Flags().GetStringArray("set-string")
+	valuesFiles, _ := command.Flags().GetStringArray("values")
+
+	options := []heft.Option{
+		heft.WithMinConfidence(scan.Confidence(minConfidence)),
+		heft.WithSet(setValues...),
+		heft.WithSetString(setStringValues...),
+		heft.WithValuesFiles(valuesFiles...),
+		heft.WithLogger(logger),
+		heft.WithConcurrency(concurrency),
+	}
+	if noHelmDeps {
+		options = append(options, heft.WithoutHelmDependencies())
+	}
+	if includeOptionalDeps {
+		options = append(options, heft.WithOptionalDependencies())
+	}
+	if verbose {
+		options = append(options, heft.WithVerbose())
+	}
+
+	var detectors []scan.Detector
+	if flag := command.Flags().Lookup("detectors"); flag != nil {
+		detectors = flag.Value.(*detectorsFlag).detectors
+	}
+	if detectors == nil && len(pluginDetectors) > 0 {
+		detectors = append(scan.DefaultDetectors(), pluginDetectors...)
+	}
+	if detectors != nil {
+		options = append(options, heft.WithDetectors(detectors...))
+	}
+	return options
+}
+
+// commandContext returns the command's context bounded by its --timeout
+// flag, if set.
+func commandContext(command *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := command.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout, _ := command.Flags().GetDuration("timeout")
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
 // exitFunction is used by Execute to terminate the process. It is a
 // variable so tests can stub it and observe exit behavior.
 var exitFunction = os.Exit
@@ -123,3 +374,25 @@ var exitFunction = os.Exit
 var executeCommand = func(command *cobra.Command) error {
 	return command.Execute()
 }
+
+// writeOutput encodes value to w as YAML or JSON, the two formats commands
+// with machine-readable output accept through --format.
+func writeOutput(w io.Writer, format string, value any) error {
+	switch format {
+	case "yaml", "":
+		encoder := yaml.NewEncoder(w)
+		defer encoder.Close()
+		if err := encoder.Encode(value); err != nil {
+			return fmt.Errorf("encode result: %w", err)
+		}
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err != nil {
+			return fmt.Errorf("encode result: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid --format %q (want yaml or json)", format)
+	}
+	return nil
+}
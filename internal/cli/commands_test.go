@@ -2,14 +2,37 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+	"unsafe"
 
 	"github.com/spf13/cobra"
 
 	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
 )
 
+// scannerOptions returns the scan options a heft.Scanner built with
+// options would scan chartRef with, so tests can check what commands make
+// of their flags.
+func scannerOptions(t *testing.T, chartRef string, options []heft.Option) scan.Options {
+	t.Helper()
+	field := reflect.ValueOf(heft.New(options...)).Elem().FieldByName("options")
+	if !field.IsValid() || field.Type() != reflect.TypeOf(scan.Options{}) {
+		t.Fatalf("heft.Scanner does not keep its scan.Options in an options field")
+	}
+	scanOptions := *(*scan.Options)(unsafe.Pointer(field.UnsafeAddr()))
+	scanOptions.ChartPath = chartRef
+	return scanOptions
+}
+
 // buildTestRoot constructs a Cobra root/scan command wired similarly to
 // Execute, but replaces the scan RunE with a stub so we can assert flag
 // parsing without invoking the real scanner.
@@ -33,6 +56,10 @@ func buildTestRoot(runScan func(command *cobra.Command, arguments []string) erro
 	scanCommand.Flags().StringArray("set", nil, "set Helm values (key=val, repeatable)")
 	scanCommand.Flags().StringArray("set-string", nil, "set Helm string values (key=val, repeatable)")
 	scanCommand.Flags().StringArrayP("values", "f", nil, "values file (repeatable)")
+	scanCommand.Flags().Bool("resolve-digests", false, "resolve each image tag to its manifest digest in the registry")
+	scanCommand.Flags().Bool("platforms", false, "list the OS/architecture platforms each image supports")
+	scanCommand.Flags().StringArray("require-platform", nil, "fail if any image lacks this platform, e.g. linux/arm64 (repeatable, implies --platforms)")
+	scanCommand.Flags().Duration("timeout", 0, "abort the scan after this duration, e.g. 2m (0 disables the timeout)")
 
 	rootCommand.AddCommand(scanCommand)
 	return rootCommand
@@ -124,8 +151,8 @@ func TestNewRootCommandWiresScanOptions(t *testing.T) {
 	defer func() { scanFunction = old }()
 
 	var gotOptions scan.Options
-	scanFunction = func(opts scan.Options) (*scan.ScanResult, error) {
-		gotOptions = opts
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotOptions = scannerOptions(t, chartRef, options)
 		return &scan.ScanResult{}, nil
 	}
 
@@ -139,6 +166,7 @@ func TestNewRootCommandWiresScanOptions(t *testing.T) {
 		"--set", "foo=bar",
 		"--set-string", "baz=qux",
 		"-f", "values.yaml",
+		"--resolve-digests",
 	})
 
 	if err := command.Execute(); err != nil {
@@ -160,6 +188,15 @@ func TestNewRootCommandWiresScanOptions(t *testing.T) {
 	if !gotOptions.Verbose {
 		t.Fatalf("expected Verbose=true")
 	}
+	if !gotOptions.ResolveDigests {
+		t.Fatalf("expected ResolveDigests=true")
+	}
+	if !reflect.DeepEqual(gotOptions.Values, []string{"--set=foo=bar", "--set-string=baz=qux"}) {
+		t.Fatalf("values = %v", gotOptions.Values)
+	}
+	if !reflect.DeepEqual(gotOptions.ValuesFiles, []string{"--values=values.yaml"}) {
+		t.Fatalf("values files = %v", gotOptions.ValuesFiles)
+	}
 }
 
 func TestScanRepeatableFlags(t *testing.T) {
@@ -211,3 +248,294 @@ func TestScanRepeatableFlags(t *testing.T) {
 		t.Fatalf("expected values to contain all files in order, got %v", gotValues)
 	}
 }
+
+// TestScanTimeoutSetsContextDeadline verifies that --timeout bounds the
+// context passed to scanFunction, and that no deadline is set by default.
+func TestScanTimeoutSetsContextDeadline(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	var gotDeadline time.Time
+	var hasDeadline bool
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotDeadline, hasDeadline = ctx.Deadline()
+		return &scan.ScanResult{}, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	if hasDeadline {
+		t.Fatalf("expected no deadline without --timeout, got %v", gotDeadline)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--timeout=90s"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	if !hasDeadline {
+		t.Fatalf("expected a deadline with --timeout=90s")
+	}
+	if remaining := time.Until(gotDeadline); remaining <= 0 || remaining > 90*time.Second {
+		t.Fatalf("unexpected time until deadline: %v", remaining)
+	}
+}
+
+// TestScanRequirePlatformFailsOnMissingPlatform verifies that
+// --require-platform enables platform resolution and fails the command when
+// an image lacks the platform.
+func TestScanRequirePlatformFailsOnMissingPlatform(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	var gotOptions scan.Options
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotOptions = scannerOptions(t, chartRef, options)
+		return &scan.ScanResult{Images: []scan.ImageFinding{
+			{Name: "example.com/app:v1", Platforms: []string{"linux/amd64"}},
+		}}, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--require-platform", "linux/arm64"})
+	err := command.Execute()
+	if err == nil || !strings.Contains(err.Error(), "missing linux/arm64") {
+		t.Fatalf("expected missing platform error, got %v", err)
+	}
+	if !gotOptions.ResolvePlatforms {
+		t.Fatalf("expected --require-platform to enable ResolvePlatforms")
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--require-platform", "linux/amd64"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("expected success when platform is present, got %v", err)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--require-platform", "arm64"})
+	if err := command.Execute(); err == nil {
+		t.Fatalf("expected error for malformed platform")
+	}
+}
+
+func TestScanHelmfileScansReleases(t *testing.T) {
+	old := scanReleasesFunction
+	defer func() { scanReleasesFunction = old }()
+
+	directory := t.TempDir()
+	path := filepath.Join(directory, "helmfile.yaml")
+	content := "environments:\n  prod: {}\n---\nreleases:\n  - name: web\n    namespace: {{ .Environment.Name }}\n    chart: oci://ghcr.io/org/web\n    version: 1.0.0\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotReleases []scan.Release
+	var gotOptions scan.Options
+	scanReleasesFunction = func(ctx context.Context, releases []scan.Release, options []heft.Option) (*scan.ScanResult, error) {
+		gotReleases, gotOptions = releases, scannerOptions(t, "", options)
+		return &scan.ScanResult{}, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"scan", "--helmfile", path, "--environment", "prod", "--set", "a=b"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	if len(gotReleases) != 1 || gotReleases[0].Chart != "oci://ghcr.io/org/web:1.0.0" || gotReleases[0].Namespace != "prod" {
+		t.Fatalf("releases = %+v", gotReleases)
+	}
+	if !reflect.DeepEqual(gotOptions.Values, []string{"--set=a=b"}) {
+		t.Fatalf("values = %v", gotOptions.Values)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "--helmfile", path, "my-chart"})
+	command.SetOut(&bytes.Buffer{})
+	command.SetErr(&bytes.Buffer{})
+	if err := command.Execute(); err == nil {
+		t.Fatal("expected an error for a chart reference with --helmfile")
+	}
+}
+
+func TestScanDetectorsFlag(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	var gotOptions scan.Options
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotOptions = scannerOptions(t, chartRef, options)
+		return &scan.ScanResult{}, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--detectors=static, regex", "--concurrency=2"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	var names []string
+	for _, detector := range gotOptions.Detectors {
+		names = append(names, detector.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"static", "regex"}) {
+		t.Fatalf("detectors = %v", names)
+	}
+	if gotOptions.Concurrency != 2 {
+		t.Fatalf("concurrency = %d, want 2", gotOptions.Concurrency)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--detectors=bogus"})
+	command.SetOut(&bytes.Buffer{})
+	command.SetErr(&bytes.Buffer{})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), `unknown detector "bogus"`) {
+		t.Fatalf("Execute() error = %v, want unknown detector", err)
+	}
+}
+
+// pluginDetector stands in for a detector plugin.
+type pluginDetector struct{ name string }
+
+func (d pluginDetector) Name() string                { return d.name }
+func (d pluginDetector) Confidence() scan.Confidence { return scan.ConfidenceMedium }
+func (d pluginDetector) Detect(ctx context.Context, chart scan.Chart) ([]scan.ImageFinding, error) {
+	return nil, nil
+}
+
+// TestPluginsLoadOnlyForDetectorCommands verifies that plugins are not
+// started for commands that run no detectors, and that scans load them
+// before resolving --detectors.
+func TestPluginsLoadOnlyForDetectorCommands(t *testing.T) {
+	oldFind, oldLoaded, oldDetectors, oldScan := findPlugins, pluginsLoaded, pluginDetectors, scanFunction
+	defer func() {
+		findPlugins, pluginsLoaded, pluginDetectors, scanFunction = oldFind, oldLoaded, oldDetectors, oldScan
+	}()
+
+	finds := 0
+	findPlugins = func(ctx context.Context) ([]scan.Detector, []error) {
+		finds++
+		return []scan.Detector{pluginDetector{name: "cli-test-plugin"}}, nil
+	}
+	pluginsLoaded, pluginDetectors = false, nil
+	var gotOptions scan.Options
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotOptions = scannerOptions(t, chartRef, options)
+		return &scan.ScanResult{}, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"help"})
+	command.SetOut(&bytes.Buffer{})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	if finds != 0 {
+		t.Fatalf("help looked up plugins %d time(s)", finds)
+	}
+
+	for range 2 {
+		command = newRootCommand()
+		command.SetArgs([]string{"scan", "my-chart", "--detectors=static,cli-test-plugin"})
+		if err := command.Execute(); err != nil {
+			t.Fatalf("Execute() returned error: %v", err)
+		}
+	}
+	if finds != 1 {
+		t.Fatalf("plugins looked up %d time(s), want 1", finds)
+	}
+	var names []string
+	for _, detector := range gotOptions.Detectors {
+		names = append(names, detector.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"static", "cli-test-plugin"}) {
+		t.Fatalf("detectors = %v", names)
+	}
+}
+
+// TestScanRejectsNegativeConcurrency runs the real scanner, which refuses
+// the option before touching the chart.
+func TestScanRejectsNegativeConcurrency(t *testing.T) {
+	command := newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--concurrency=-1"})
+	command.SetOut(&bytes.Buffer{})
+	command.SetErr(&bytes.Buffer{})
+	if err := command.Execute(); !errors.Is(err, heft.ErrInvalidOption) {
+		t.Fatalf("Execute() error = %v, want %v", err, heft.ErrInvalidOption)
+	}
+}
+
+func TestScanLogFlags(t *testing.T) {
+	old, oldOutput, oldLogger := scanFunction, logOutput, logger
+	defer func() { scanFunction, logOutput, logger = old, oldOutput, oldLogger }()
+
+	var logged bytes.Buffer
+	logOutput = &logged
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		scannerOptions(t, chartRef, options).Logger.Debug("detector finished", "chart", chartRef, "detector", "static")
+		return &scan.ScanResult{}, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--log-format=json", "--verbose"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(logged.Bytes(), &record); err != nil {
+		t.Fatalf("log is not JSON: %v: %s", err, logged.String())
+	}
+	if record["level"] != "DEBUG" || record["chart"] != "my-chart" || record["detector"] != "static" {
+		t.Fatalf("unexpected log record: %v", record)
+	}
+
+	logged.Reset()
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--verbose", "--log-level=warn"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	if logged.Len() != 0 {
+		t.Fatalf("debug record logged at warn level: %s", logged.String())
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--log-level=loud"})
+	command.SetOut(&bytes.Buffer{})
+	command.SetErr(&bytes.Buffer{})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "invalid --log-level") {
+		t.Fatalf("Execute() error = %v, want invalid --log-level", err)
+	}
+}
+
+func TestScanFailOnDetectorError(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		return &scan.ScanResult{
+			Images: []scan.ImageFinding{{Name: "nginx:1.27", Confidence: scan.ConfidenceMedium}},
+			Diagnostics: &scan.Diagnostics{Detectors: []scan.DetectorDiagnostic{
+				{Name: "rendered", Status: scan.DetectorFailed, Error: "helm template failed"},
+				{Name: "static", Status: scan.DetectorOK, Images: 1},
+			}},
+		}, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() without --fail-on-detector-error returned error: %v", err)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"scan", "my-chart", "--fail-on-detector-error"})
+	command.SetOut(&bytes.Buffer{})
+	command.SetErr(&bytes.Buffer{})
+	err := command.Execute()
+	if err == nil || !strings.Contains(err.Error(), "rendered: helm template failed") {
+		t.Fatalf("Execute() error = %v, want the rendered detector failure", err)
+	}
+}
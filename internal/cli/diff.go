@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tonur/heft/internal/diff"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// diffExitCode is the exit status of 'heft diff' when the images differ,
+// following diff(1): 0 for no changes, 1 for errors.
+const diffExitCode = 2
+
+// newDiffCommand constructs the diff subcommand, which scans two chart
+// references with the same options and reports how their images differ.
+func newDiffCommand() *cobra.Command {
+	diffCommand := &cobra.Command{
+		Use:   "diff <old-chart-ref> <new-chart-ref>",
+		Short: "Compare the images of two Helm charts or chart versions",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			resolveDigests, _ := command.Flags().GetBool("resolve-digests")
+			format, _ := command.Flags().GetString("format")
+			if format != "yaml" && format != "json" {
+				return fmt.Errorf("invalid --format %q (want yaml or json)", format)
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			var results [2]*scan.ScanResult
+			for i, chartRef := range arguments {
+				options := scanOptionsFromFlags(command)
+				if resolveDigests {
+					options = append(options, heft.WithDigests())
+				}
+				result, err := scanFunction(ctx, chartRef, options)
+				if err != nil {
+					return fmt.Errorf("scan %s: %w", chartRef, err)
+				}
+				results[i] = result
+			}
+
+			difference := diff.Images(results[0].Images, results[1].Images)
+			fmt.Fprint(os.Stderr, "heft: diff: ")
+			difference.WriteSummary(os.Stderr)
+			logger.Info("compared charts", "added", len(difference.Added), "removed", len(difference.Removed), "changed", len(difference.Changed), "unchanged", difference.Unchanged)
+			if err := writeOutput(os.Stdout, format, difference); err != nil {
+				return err
+			}
+			if !difference.Empty() {
+				command.SilenceErrors = true
+				command.SilenceUsage = true
+				return &exitCodeError{code: diffExitCode}
+			}
+			return nil
+		},
+	}
+
+	addScanFlags(diffCommand, scan.ConfidenceLow)
+	diffCommand.Flags().Bool("resolve-digests", false, "resolve tags to digests so images retagged in place are reported as changed")
+	diffCommand.Flags().String("format", "yaml", "output format for the diff (yaml|json)")
+	return diffCommand
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestDiffReturnsExitCodeOnChanges verifies that diff scans both references
+// and returns an exitCodeError only when the images differ.
+func TestDiffReturnsExitCodeOnChanges(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	images := map[string][]scan.ImageFinding{
+		"chart-1": {{Name: "nginx:1.25"}},
+		"chart-2": {{Name: "nginx:1.26"}},
+	}
+	var scanned []string
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		scanned = append(scanned, chartRef)
+		return &scan.ScanResult{Images: images[chartRef]}, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"diff", "chart-1", "chart-2", "--format", "json"})
+	err := command.Execute()
+	var exitErr *exitCodeError
+	if !errors.As(err, &exitErr) || exitErr.code != diffExitCode {
+		t.Fatalf("expected exit code %d, got %v", diffExitCode, err)
+	}
+	if len(scanned) != 2 || scanned[0] != "chart-1" || scanned[1] != "chart-2" {
+		t.Fatalf("expected both charts to be scanned in order, got %v", scanned)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"diff", "chart-1", "chart-1"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("expected no error for identical charts, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/spf13/cobra"
@@ -38,3 +39,29 @@ func TestExecuteUsesExitFunctionOnError(t *testing.T) {
 		t.Fatalf("expected exit code 1, got %d", gotCode)
 	}
 }
+
+// TestExecuteUsesExitCodeError verifies that Execute exits with the code
+// carried by an exitCodeError.
+func TestExecuteUsesExitCodeError(t *testing.T) {
+	oldExit := exitFunction
+	oldExecute := executeCommand
+	defer func() {
+		exitFunction = oldExit
+		executeCommand = oldExecute
+	}()
+
+	executeCommand = func(command *cobra.Command) error {
+		return fmt.Errorf("diff: %w", &exitCodeError{code: 2})
+	}
+
+	gotCode := -1
+	exitFunction = func(code int) {
+		gotCode = code
+	}
+
+	Execute()
+
+	if gotCode != 2 {
+		t.Fatalf("expected exit code 2, got %d", gotCode)
+	}
+}
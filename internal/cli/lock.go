@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tonur/heft/internal/diff"
+	"github.com/tonur/heft/internal/lock"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// newLockCommand constructs the lock subcommand, which records a chart's
+// images in a lock file.
+func newLockCommand() *cobra.Command {
+	lockCommand := &cobra.Command{
+		Use:   "lock <chart-ref>",
+		Short: "Record a Helm chart's images in a lock file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			output, _ := command.Flags().GetString("output")
+			verbose, _ := command.Flags().GetBool("verbose")
+
+			lockOptions, err := lockOptionsFromFlags(command)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			options, err := scannerOptionsFromLock(ctx, lockOptions, verbose)
+			if err != nil {
+				return err
+			}
+
+			result, err := scanFunction(ctx, arguments[0], options)
+			if err != nil {
+				return err
+			}
+			file := lock.New(arguments[0], lockOptions, result)
+			if err := file.Write(output); err != nil {
+				return err
+			}
+			logger.Info("wrote lock", "images", len(file.Images), "file", output)
+			return nil
+		},
+	}
+
+	addScanFlags(lockCommand, scan.ConfidenceLow)
+	lockCommand.Flags().Bool("resolve-digests", false, "record each image's manifest digest, so retagged images fail verification")
+	lockCommand.Flags().StringP("output", "o", lock.DefaultFile, "lock file to write")
+	return lockCommand
+}
+
+// newVerifyLockCommand constructs the verify-lock subcommand, which rescans
+// the chart in a lock file with the recorded options and fails if its
+// images changed.
+func newVerifyLockCommand() *cobra.Command {
+	verifyCommand := &cobra.Command{
+		Use:   "verify-lock [chart-ref]",
+		Short: "Fail if a Helm chart's images differ from its lock file",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			path, _ := command.Flags().GetString("lock")
+			verbose, _ := command.Flags().GetBool("verbose")
+
+			file, err := lock.Read(path)
+			if err != nil {
+				return err
+			}
+			chartRef := file.Ref
+			if len(arguments) > 0 {
+				chartRef = arguments[0]
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			options, err := scannerOptionsFromLock(ctx, file.Options, verbose)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+
+			result, err := scanFunction(ctx, chartRef, options)
+			if err != nil {
+				return err
+			}
+
+			difference := diff.Images(file.Findings(), result.Images)
+			if !difference.Empty() {
+				fmt.Fprint(os.Stderr, "heft: verify-lock: ")
+				difference.WriteSummary(os.Stderr)
+				return fmt.Errorf("images differ from %s; run 'heft lock' to update it", path)
+			}
+			if file.Chart != nil && result.Chart != nil && file.Chart.Version != result.Chart.Version {
+				logger.Warn("chart version changed with the same images", "file", path, "from", file.Chart.Version, "to", result.Chart.Version)
+			}
+			logger.Info("images match lock", "images", len(file.Images), "file", path)
+			return nil
+		},
+	}
+
+	verifyCommand.Flags().String("lock", lock.DefaultFile, "lock file to verify")
+	verifyCommand.Flags().BoolP("verbose", "v", false, "enable verbose logging")
+	verifyCommand.Flags().Duration("timeout", 0, "abort after this duration, e.g. 2m (0 disables the timeout)")
+	return verifyCommand
+}
+
+// lockOptionsFromFlags records the scan flags registered by addScanFlags,
+// and --resolve-digests, as lock options.
+func lockOptionsFromFlags(command *cobra.Command) (lock.Options, error) {
+	minConfidence, _ := command.Flags().GetString("min-confidence")
+	set, _ := command.Flags().GetStringArray("set")
+	setString, _ := command.Flags().GetStringArray("set-string")
+	values, _ := command.Flags().GetStringArray("values")
+	includeOptionalDeps, _ := command.Flags().GetBool("include-optional-deps")
+	noHelmDeps, _ := command.Flags().GetBool("no-helm-deps")
+	resolveDigests, _ := command.Flags().GetBool("resolve-digests")
+	concurrency, _ := command.Flags().GetInt("concurrency")
+
+	confidence := scan.Confidence(minConfidence)
+	switch confidence {
+	case scan.ConfidenceHigh, scan.ConfidenceMedium, scan.ConfidenceLow:
+	default:
+		return lock.Options{}, fmt.Errorf("invalid --min-confidence %q (want high, medium or low)", minConfidence)
+	}
+	var detectors []string
+	if flag := command.Flags().Lookup("detectors"); flag != nil {
+		detectors = flag.Value.(*detectorsFlag).names
+	}
+	// Plugins that run by default are recorded by name, so verify-lock
+	// runs them too and catches drift in their findings.
+	if detectors == nil && len(pluginDetectors) > 0 {
+		for _, detector := range append(scan.DefaultDetectors(), pluginDetectors...) {
+			detectors = append(detectors, detector.Name())
+		}
+	}
+	return lock.Options{
+		MinConfidence:       confidence,
+		Set:                 set,
+		SetString:           setString,
+		Values:              values,
+		IncludeOptionalDeps: includeOptionalDeps,
+		NoHelmDeps:          noHelmDeps,
+		ResolveDigests:      resolveDigests,
+		Detectors:           detectors,
+		Concurrency:         concurrency,
+	}, nil
+}
+
+// scannerOptionsFromLock returns the scanner options recorded in a lock
+// file, logging at debug level if verbose is set. Plugins are loaded only
+// if the lock names a detector that is not registered.
+func scannerOptionsFromLock(ctx context.Context, options lock.Options, verbose bool) ([]heft.Option, error) {
+	minConfidence := options.MinConfidence
+	if minConfidence == "" {
+		minConfidence = scan.ConfidenceLow
+	}
+	scannerOptions := []heft.Option{
+		heft.WithMinConfidence(minConfidence),
+		heft.WithSet(options.Set...),
+		heft.WithSetString(options.SetString...),
+		heft.WithValuesFiles(options.Values...),
+		heft.WithLogger(logger),
+		heft.WithConcurrency(options.Concurrency),
+	}
+	if options.Detectors != nil {
+		detectors, err := scan.LookupDetectors(options.Detectors)
+		if err != nil {
+			loadPlugins(ctx)
+			detectors, err = scan.LookupDetectors(options.Detectors)
+		}
+		if err != nil {
+			return nil, err
+		}
+		scannerOptions = append(scannerOptions, heft.WithDetectors(detectors...))
+	}
+	if options.NoHelmDeps {
+		scannerOptions = append(scannerOptions, heft.WithoutHelmDependencies())
+	}
+	if options.IncludeOptionalDeps {
+		scannerOptions = append(scannerOptions, heft.WithOptionalDependencies())
+	}
+	if options.ResolveDigests {
+		scannerOptions = append(scannerOptions, heft.WithDigests())
+	}
+	if verbose {
+		scannerOptions = append(scannerOptions, heft.WithVerbose())
+	}
+	return scannerOptions, nil
+}
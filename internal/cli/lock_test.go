@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tonur/heft/internal/lock"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestVerifyLockDetectsImageChanges verifies that verify-lock rescans the
+// locked chart with the recorded options and fails once its images change.
+func TestVerifyLockDetectsImageChanges(t *testing.T) {
+	old, oldOutput, oldLogger := scanFunction, logOutput, logger
+	defer func() { scanFunction, logOutput, logger = old, oldOutput, oldLogger }()
+
+	var logged bytes.Buffer
+	logOutput = &logged
+
+	images := []scan.ImageFinding{{Name: "nginx:1.25"}}
+	var gotOptions scan.Options
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotOptions = scannerOptions(t, chartRef, options)
+		return &scan.ScanResult{Images: images}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "heft.lock.yaml")
+	command := newRootCommand()
+	command.SetArgs([]string{"lock", "./charts/demo", "--set", "replicas=2", "--detectors=static", "--concurrency=2", "-o", path, "--log-level=info"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("lock returned error: %v", err)
+	}
+	if !strings.Contains(logged.String(), `msg="wrote lock" images=1 file=`+path) {
+		t.Fatalf("expected a log record for the lock file, got %q", logged.String())
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"verify-lock", "--lock", path})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("verify-lock returned error for unchanged images: %v", err)
+	}
+	if gotOptions.ChartPath != "./charts/demo" || len(gotOptions.Values) != 1 || gotOptions.Values[0] != "--set=replicas=2" {
+		t.Fatalf("expected the locked ref and options to be rescanned, got %+v", gotOptions)
+	}
+	if len(gotOptions.Detectors) != 1 || gotOptions.Detectors[0].Name() != "static" || gotOptions.Concurrency != 2 {
+		t.Fatalf("expected the locked detectors and concurrency to be rescanned with, got %+v", gotOptions)
+	}
+
+	images = []scan.ImageFinding{{Name: "nginx:1.26"}}
+	command = newRootCommand()
+	command.SetArgs([]string{"verify-lock", "--lock", path})
+	err := command.Execute()
+	if err == nil || !strings.Contains(err.Error(), "images differ") {
+		t.Fatalf("expected verify-lock to fail on changed images, got %v", err)
+	}
+}
+
+func TestLockRejectsInvalidMinConfidence(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		t.Fatal("scanned with an invalid --min-confidence")
+		return nil, nil
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"lock", "./charts/demo", "--min-confidence=bogus", "-o", filepath.Join(t.TempDir(), "heft.lock.yaml")})
+	command.SetOut(&bytes.Buffer{})
+	command.SetErr(&bytes.Buffer{})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "invalid --min-confidence") {
+		t.Fatalf("Execute() error = %v, want invalid --min-confidence", err)
+	}
+}
+
+// TestLockRecordsPlugins verifies that lock records the plugins a scan
+// runs by default, and that verify-lock loads plugins only when the lock
+// names one that is not registered.
+func TestLockRecordsPlugins(t *testing.T) {
+	oldFind, oldLoaded, oldDetectors, oldScan := findPlugins, pluginsLoaded, pluginDetectors, scanFunction
+	defer func() {
+		findPlugins, pluginsLoaded, pluginDetectors, scanFunction = oldFind, oldLoaded, oldDetectors, oldScan
+	}()
+
+	// Registered detectors outlive the test, so each run needs new names.
+	lockPlugin := fmt.Sprintf("lock-test-plugin-%d", time.Now().UnixNano())
+	verifyPlugin := fmt.Sprintf("verify-lock-test-plugin-%d", time.Now().UnixNano())
+	plugins := []scan.Detector{pluginDetector{name: lockPlugin}}
+	finds := 0
+	findPlugins = func(ctx context.Context) ([]scan.Detector, []error) {
+		finds++
+		return plugins, nil
+	}
+	pluginsLoaded, pluginDetectors = false, nil
+	var gotOptions scan.Options
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotOptions = scannerOptions(t, chartRef, options)
+		return &scan.ScanResult{Images: []scan.ImageFinding{{Name: "nginx:1.25"}}}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "heft.lock.yaml")
+	command := newRootCommand()
+	command.SetArgs([]string{"lock", "./charts/demo", "-o", path})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("lock returned error: %v", err)
+	}
+	file, err := lock.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"rendered", "static", "regex", lockPlugin}; !reflect.DeepEqual(file.Options.Detectors, want) {
+		t.Fatalf("locked detectors = %v, want %v", file.Options.Detectors, want)
+	}
+
+	// A later verify-lock runs in a new process, with plugins not yet
+	// loaded, and must load the one the lock names.
+	file.Options.Detectors = []string{"static", verifyPlugin}
+	if err := file.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	plugins = []scan.Detector{pluginDetector{name: verifyPlugin}}
+	pluginsLoaded, pluginDetectors, finds = false, nil, 0
+	command = newRootCommand()
+	command.SetArgs([]string{"verify-lock", "--lock", path})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("verify-lock returned error: %v", err)
+	}
+	if finds != 1 {
+		t.Fatalf("verify-lock looked up plugins %d time(s), want 1", finds)
+	}
+	var names []string
+	for _, detector := range gotOptions.Detectors {
+		names = append(names, detector.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"static", verifyPlugin}) {
+		t.Fatalf("verify-lock detectors = %v", names)
+	}
+}
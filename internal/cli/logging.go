@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// logOutput receives the CLI's log. It is a variable so tests can capture
+// it.
+var logOutput io.Writer = os.Stderr
+
+// logger is the CLI's logger, configured from --log-level and --log-format
+// before a command runs. Until then it logs warnings as text.
+var logger = slog.New(slog.NewTextHandler(logOutput, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+// addLogFlags registers the logging flags on the root command, for every
+// subcommand.
+func addLogFlags(command *cobra.Command) {
+	command.PersistentFlags().String("log-level", "", "log level (debug|info|warn|error); defaults to warn, or debug with --verbose")
+	command.PersistentFlags().String("log-format", "text", "log format (text|json)")
+}
+
+// configureLogging sets logger from command's logging flags. --verbose
+// means --log-level debug unless a level is given.
+func configureLogging(command *cobra.Command) error {
+	levelName, _ := command.Flags().GetString("log-level")
+	format, _ := command.Flags().GetString("log-format")
+	verbose, _ := command.Flags().GetBool("verbose")
+
+	level := slog.LevelWarn
+	switch {
+	case levelName != "":
+		if err := level.UnmarshalText([]byte(levelName)); err != nil {
+			return fmt.Errorf("invalid --log-level %q (want debug, info, warn or error)", levelName)
+		}
+	case verbose:
+		level = slog.LevelDebug
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(logOutput, handlerOptions))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(logOutput, handlerOptions))
+	default:
+		return fmt.Errorf("invalid --log-format %q (want text or json)", format)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/tonur/heft/internal/mirror"
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// newMirrorCommand constructs the mirror subcommand, which scans a chart
+// and copies every image it finds into another registry.
+func newMirrorCommand() *cobra.Command {
+	mirrorCommand := &cobra.Command{
+		Use:   "mirror <chart-ref> --to <registry>/<prefix>",
+		Short: "Copy the images of a Helm chart into another registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			options, err := mirrorOptionsFromFlags(command)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			result, err := scanFunction(ctx, arguments[0], scanOptionsFromFlags(command))
+			if err != nil {
+				return err
+			}
+
+			options.Source = options.Target
+			report, err := mirror.Run(ctx, result.Images, options)
+			return writeMirrorReport(report, err)
+		},
+	}
+
+	// Regex guesses are too noisy to copy by default, so mirror only takes
+	// images heft is confident about unless told otherwise.
+	addScanFlags(mirrorCommand, scan.ConfidenceMedium)
+	addMirrorFlags(mirrorCommand)
+	return mirrorCommand
+}
+
+// addMirrorFlags registers the flags that control where and how images are
+// pushed to a target registry.
+func addMirrorFlags(command *cobra.Command) {
+	command.Flags().String("to", "", "target registry and optional path prefix, e.g. registry.internal/mirror")
+	command.Flags().String("mapping", mirror.StrategyKeepPath, "how target repositories are named (keep-path|flatten|template)")
+	command.Flags().String("template", "", "Go template for --mapping=template, e.g. '{{.Registry}}/{{.Repository}}'")
+	command.Flags().Bool("dry-run", false, "print the planned copies without contacting any registry")
+	// Commands that also scan share the scan's --concurrency flag.
+	if command.Flags().Lookup("concurrency") == nil {
+		command.Flags().Int("concurrency", 4, "number of images copied in parallel")
+	}
+}
+
+// mirrorOptionsFromFlags builds mirror.Options from the flags registered by
+// addMirrorFlags. Target is a registry client using the Docker CLI
+// credentials; callers set Source.
+func mirrorOptionsFromFlags(command *cobra.Command) (mirror.Options, error) {
+	to, _ := command.Flags().GetString("to")
+	strategy, _ := command.Flags().GetString("mapping")
+	templateText, _ := command.Flags().GetString("template")
+	dryRun, _ := command.Flags().GetBool("dry-run")
+	concurrency, _ := command.Flags().GetInt("concurrency")
+
+	if to == "" {
+		return mirror.Options{}, fmt.Errorf("--to is required")
+	}
+	mapping, err := mirror.NewMapping(strategy, templateText)
+	if err != nil {
+		return mirror.Options{}, err
+	}
+
+	return mirror.Options{
+		To:          to,
+		Mapping:     mapping,
+		Concurrency: concurrency,
+		DryRun:      dryRun,
+		Target:      newCLIRegistryClient(),
+	}, nil
+}
+
+// newCLIRegistryClient returns a registry client with the Docker CLI
+// credentials, falling back to anonymous access when they cannot be read.
+func newCLIRegistryClient() *registry.Client {
+	client, err := registry.NewClient()
+	if err != nil {
+		logger.Warn("continuing without stored registry credentials", "error", err)
+	}
+	return client
+}
+
+// writeMirrorReport prints report, if any, and turns runErr or failed
+// images into the command's error.
+func writeMirrorReport(report *mirror.Report, runErr error) error {
+	if report != nil {
+		encoder := yaml.NewEncoder(os.Stdout)
+		defer encoder.Close()
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("encode report: %w", err)
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if report.Summary.Failed > 0 {
+		return fmt.Errorf("%d of %d image(s) failed to mirror; re-run to resume", report.Summary.Failed, report.Summary.Total)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestMirrorCopiesScannedImages verifies that mirror scans with the scan
+// flags, defaults to medium confidence and copies the images it finds.
+func TestMirrorCopiesScannedImages(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	source := registrytest.New(t)
+	target := registrytest.New(t)
+	source.AddImage("org/app", "v1", []byte(`{"os":"linux","architecture":"amd64"}`), []byte("layer"))
+
+	var gotOptions scan.Options
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotOptions = scannerOptions(t, chartRef, options)
+		return &scan.ScanResult{Images: []scan.ImageFinding{{Name: source.Host() + "/org/app:v1"}}}, nil
+	}
+
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	command := newRootCommand()
+	command.SetArgs([]string{"mirror", "my-chart", "--to", target.Host() + "/mirror", "--mapping", "flatten", "--set", "a=b"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	if gotOptions.ChartPath != "my-chart" || gotOptions.MinConfidence != scan.ConfidenceMedium {
+		t.Fatalf("unexpected scan options: %+v", gotOptions)
+	}
+	if len(gotOptions.Values) != 1 || gotOptions.Values[0] != "--set=a=b" {
+		t.Fatalf("unexpected values: %v", gotOptions.Values)
+	}
+	if _, ok := target.Manifest("mirror/app", "v1"); !ok {
+		t.Fatalf("expected image to be mirrored to mirror/app:v1")
+	}
+}
+
+// TestMirrorFailsWhenImagesFail verifies the command reports an error when
+// any image could not be copied, and requires --to.
+func TestMirrorFailsWhenImagesFail(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	source := registrytest.New(t)
+	target := registrytest.New(t)
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		return &scan.ScanResult{Images: []scan.ImageFinding{{Name: source.Host() + "/org/missing:v1"}}}, nil
+	}
+
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	command := newRootCommand()
+	command.SetArgs([]string{"mirror", "my-chart", "--to", target.Host()})
+	err := command.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 image(s) failed") {
+		t.Fatalf("expected failure summary error, got %v", err)
+	}
+
+	command = newRootCommand()
+	command.SetArgs([]string{"mirror", "my-chart"})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "--to is required") {
+		t.Fatalf("expected --to error, got %v", err)
+	}
+}
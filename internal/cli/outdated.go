@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tonur/heft/internal/outdated"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// newOutdatedCommand constructs the outdated subcommand, which scans a
+// chart and lists newer versions of its images from their registries.
+func newOutdatedCommand() *cobra.Command {
+	outdatedCommand := &cobra.Command{
+		Use:   "outdated <chart-ref>",
+		Short: "List newer patch, minor and major versions of a Helm chart's images",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			tagFilter, _ := command.Flags().GetString("tag-filter")
+			includePrerelease, _ := command.Flags().GetBool("include-prerelease")
+			format, _ := command.Flags().GetString("format")
+			if format != "yaml" && format != "json" {
+				return fmt.Errorf("invalid --format %q (want yaml or json)", format)
+			}
+
+			options := outdated.Options{IncludePrerelease: includePrerelease}
+			if tagFilter != "" {
+				filter, err := regexp.Compile(tagFilter)
+				if err != nil {
+					return fmt.Errorf("invalid --tag-filter: %w", err)
+				}
+				options.TagFilter = filter
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			result, err := scanFunction(ctx, arguments[0], scanOptionsFromFlags(command))
+			if err != nil {
+				return err
+			}
+
+			options.Client = newCLIRegistryClient()
+			report := outdated.Check(ctx, result.Images, options)
+			for _, image := range report.Images {
+				if image.Error != "" {
+					logger.Warn("could not list tags", "image", image.Image, "error", image.Error)
+				}
+			}
+			if err := writeOutput(os.Stdout, format, report); err != nil {
+				return err
+			}
+			summary := report.Summary
+			fmt.Fprintf(os.Stderr, "heft: outdated: %d of %d image(s) have newer versions (%d skipped, %d failed)\n", summary.Outdated, summary.Images, summary.Skipped, summary.Failed)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return nil
+		},
+	}
+
+	addScanFlags(outdatedCommand, scan.ConfidenceMedium)
+	outdatedCommand.Flags().String("tag-filter", "", "only consider tags matching this regular expression")
+	outdatedCommand.Flags().Bool("include-prerelease", false, "consider prerelease tags such as 1.3.0-rc.1")
+	outdatedCommand.Flags().String("format", "yaml", "output format for the report (yaml|json)")
+	return outdatedCommand
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/tonur/heft/internal/outdated"
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestOutdatedPrintsJSONReport verifies that outdated checks the scanned
+// images against the registry and prints the report as JSON.
+func TestOutdatedPrintsJSONReport(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	server := registrytest.New(t)
+	for _, tag := range []string{"1.0.0", "1.0.1", "1.1.0-beta.1"} {
+		server.AddImage("org/app", tag, []byte(`{}`))
+	}
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		return &scan.ScanResult{Images: []scan.ImageFinding{{Name: server.Host() + "/org/app:1.0.0"}}}, nil
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	command := newRootCommand()
+	command.SetArgs([]string{"outdated", "./chart", "--format", "json"})
+	err = command.Execute()
+	os.Stdout = stdout
+	writer.Close()
+	if err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+
+	var report outdated.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, data)
+	}
+	if len(report.Images) != 1 || report.Images[0].Patch != "1.0.1" || report.Images[0].Minor != "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
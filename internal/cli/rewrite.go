@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/tonur/heft/internal/mirror"
+	"github.com/tonur/heft/internal/rewrite"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// newValuesRewriteCommand constructs the values-rewrite subcommand, which
+// writes values pointing a chart's images at a mirror and verifies them by
+// rendering the chart.
+func newValuesRewriteCommand() *cobra.Command {
+	rewriteCommand := &cobra.Command{
+		Use:   "values-rewrite <chart-ref> --registry <registry>/<prefix>",
+		Short: "Generate Helm values that pull a chart's images from a mirror",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			registryPrefix, _ := command.Flags().GetString("registry")
+			strategy, _ := command.Flags().GetString("mapping")
+			templateText, _ := command.Flags().GetString("template")
+			output, _ := command.Flags().GetString("output")
+			noVerify, _ := command.Flags().GetBool("no-verify")
+			valuesFiles, _ := command.Flags().GetStringArray("values")
+
+			if registryPrefix == "" {
+				return fmt.Errorf("--registry is required")
+			}
+			mapping, err := mirror.NewMapping(strategy, templateText)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			chartPath, cleanup, err := scan.FetchChart(ctx, arguments[0])
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			result, err := rewrite.Values(chartPath, rewrite.Options{Registry: registryPrefix, Mapping: mapping, ValuesFiles: valuesFiles})
+			if err != nil {
+				return err
+			}
+			data, err := yaml.Marshal(result.Values)
+			if err != nil {
+				return fmt.Errorf("encode values: %w", err)
+			}
+
+			valuesPath := output
+			if output == "" {
+				os.Stdout.Write(data)
+				// The check below renders the chart with the values, so
+				// they need to be in a file either way.
+				directory, err := os.MkdirTemp("", "heft-values-*")
+				if err != nil {
+					return fmt.Errorf("create temp dir: %w", err)
+				}
+				defer os.RemoveAll(directory)
+				valuesPath = filepath.Join(directory, "values.yaml")
+			}
+			if err := os.WriteFile(valuesPath, data, 0o644); err != nil {
+				return fmt.Errorf("write values: %w", err)
+			}
+			logger.Info("rewrote values", "keys", len(result.Changes), "file", valuesPath)
+
+			if noVerify {
+				return nil
+			}
+
+			options := append(scanOptionsFromFlags(command), heft.WithValuesFiles(valuesPath))
+			scanned, err := scanFunction(ctx, chartPath, options)
+			if err != nil {
+				return fmt.Errorf("render with rewritten values: %w", err)
+			}
+
+			rendered := 0
+			for _, image := range scanned.Images {
+				if image.Source == scan.SourceRendered {
+					rendered++
+				}
+			}
+			if rendered == 0 {
+				logger.Warn("chart rendered no images; rewritten values were not verified", "chart", arguments[0])
+				return nil
+			}
+			if remaining := rewrite.Verify(scanned.Images, registryPrefix); len(remaining) > 0 {
+				return fmt.Errorf("%d rendered image(s) still point outside %s:\n  %s", len(remaining), registryPrefix, strings.Join(remaining, "\n  "))
+			}
+			logger.Info("verified rewritten values", "images", rendered, "registry", registryPrefix)
+			return nil
+		},
+	}
+
+	addScanFlags(rewriteCommand, scan.ConfidenceLow)
+	rewriteCommand.Flags().String("registry", "", "mirror registry and optional path prefix, as passed to 'heft mirror --to'")
+	rewriteCommand.Flags().String("mapping", mirror.StrategyKeepPath, "how mirrored repositories are named, as passed to 'heft mirror' (keep-path|flatten|template)")
+	rewriteCommand.Flags().String("template", "", "Go template for --mapping=template")
+	rewriteCommand.Flags().StringP("output", "o", "", "write the values to this file instead of stdout")
+	rewriteCommand.Flags().Bool("no-verify", false, "skip re-rendering the chart to check the rewritten values")
+	return rewriteCommand
+}
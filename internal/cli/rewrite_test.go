@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestValuesRewriteWritesAndVerifiesValues verifies that values-rewrite
+// writes override values, renders with them, and fails when a rendered
+// image still points at the original registry.
+func TestValuesRewriteWritesAndVerifiesValues(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	chartDir := t.TempDir()
+	for name, content := range map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+		"values.yaml": "image:\n  repository: ghcr.io/org/app\n  tag: v1\n",
+	} {
+		if err := os.WriteFile(filepath.Join(chartDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var gotValuesFiles []string
+	renderedImages := []scan.ImageFinding{{Name: "mirror.internal/org/app:v1", Source: scan.SourceRendered}}
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		gotValuesFiles = scannerOptions(t, chartRef, options).ValuesFiles
+		return &scan.ScanResult{Images: renderedImages}, nil
+	}
+
+	output := filepath.Join(t.TempDir(), "mirror-values.yaml")
+	command := newRootCommand()
+	command.SetArgs([]string{"values-rewrite", chartDir, "--registry", "mirror.internal", "-o", output})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "repository: mirror.internal/org/app") {
+		t.Fatalf("unexpected values:\n%s", data)
+	}
+	if len(gotValuesFiles) != 1 || gotValuesFiles[0] != "--values="+output {
+		t.Fatalf("expected render with rewritten values, got %v", gotValuesFiles)
+	}
+
+	renderedImages = append(renderedImages, scan.ImageFinding{Name: "docker.io/library/busybox:1.36", Source: scan.SourceRendered})
+	command = newRootCommand()
+	command.SetArgs([]string{"values-rewrite", chartDir, "--registry", "mirror.internal", "-o", output})
+	err = command.Execute()
+	if err == nil || !strings.Contains(err.Error(), "docker.io/library/busybox:1.36") {
+		t.Fatalf("expected verification error naming busybox, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/internal/signature"
+)
+
+// newVerifySignaturesCommand constructs the verify-signatures subcommand,
+// which checks the cosign signatures of a chart's images with a public
+// key.
+func newVerifySignaturesCommand() *cobra.Command {
+	verifyCommand := &cobra.Command{
+		Use:   "verify-signatures <chart-ref> --key <cosign.pub>",
+		Short: "Verify the cosign signatures of a Helm chart's images",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			keyPath, _ := command.Flags().GetString("key")
+			format, _ := command.Flags().GetString("format")
+			if keyPath == "" {
+				return fmt.Errorf("--key is required")
+			}
+			if format != "yaml" && format != "json" {
+				return fmt.Errorf("invalid --format %q (want yaml or json)", format)
+			}
+			key, err := signature.LoadPublicKey(keyPath)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			result, err := scanFunction(ctx, arguments[0], scanOptionsFromFlags(command))
+			if err != nil {
+				return err
+			}
+
+			report := signature.Verify(ctx, result.Images, signature.Options{Key: key, Client: newCLIRegistryClient()})
+			if err := writeOutput(os.Stdout, format, report); err != nil {
+				return err
+			}
+			summary := report.Summary
+			fmt.Fprintf(os.Stderr, "heft: verify-signatures: %d signed, %d unsigned, %d invalid, %d failed\n", summary.Signed, summary.Unsigned, summary.Invalid, summary.Failed)
+			if notSigned := summary.Images - summary.Signed; notSigned > 0 {
+				return fmt.Errorf("%d of %d image(s) are not signed with %s", notSigned, summary.Images, keyPath)
+			}
+			return nil
+		},
+	}
+
+	addScanFlags(verifyCommand, scan.ConfidenceMedium)
+	verifyCommand.Flags().String("key", "", "cosign public key (PEM) to verify signatures with")
+	verifyCommand.Flags().String("format", "yaml", "output format for the report (yaml|json)")
+	return verifyCommand
+}
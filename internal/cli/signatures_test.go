@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestVerifySignaturesFailsOnUnsignedImages verifies that the command
+// fails when a scanned image has no signature.
+func TestVerifySignaturesFailsOnUnsignedImages(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+
+	server := registrytest.New(t)
+	server.AddImage("org/app", "v1", []byte(`{}`))
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		return &scan.ScanResult{Images: []scan.ImageFinding{{Name: server.Host() + "/org/app:v1"}}}, nil
+	}
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	command := newRootCommand()
+	command.SetArgs([]string{"verify-signatures", "./chart", "--key", keyPath})
+	err = command.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 image(s) are not signed") {
+		t.Fatalf("expected an unsigned image error, got %v", err)
+	}
+}
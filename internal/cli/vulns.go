@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/internal/vulns"
+)
+
+// newVulnsCommand constructs the vulns subcommand, which matches the OS
+// packages of a chart's images against a local advisory database.
+func newVulnsCommand() *cobra.Command {
+	vulnsCommand := &cobra.Command{
+		Use:   "vulns <chart-ref> --db <path>",
+		Short: "Match a Helm chart's images against a local vulnerability database",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, arguments []string) error {
+			databasePath, _ := command.Flags().GetString("db")
+			sbomFlags, _ := command.Flags().GetStringArray("sbom")
+			platformFlag, _ := command.Flags().GetString("platform")
+			noPull, _ := command.Flags().GetBool("no-pull")
+			failOnFlag, _ := command.Flags().GetString("fail-on")
+			format, _ := command.Flags().GetString("format")
+
+			if databasePath == "" {
+				return fmt.Errorf("--db is required")
+			}
+			if format != "yaml" && format != "json" {
+				return fmt.Errorf("invalid --format %q (want yaml or json)", format)
+			}
+			failOn, err := vulns.ParseSeverity(failOnFlag)
+			if err != nil {
+				return fmt.Errorf("--fail-on: %w", err)
+			}
+			platform, err := registry.ParsePlatform(platformFlag)
+			if err != nil {
+				return err
+			}
+			sboms := map[string]string{}
+			for _, value := range sbomFlags {
+				image, path, ok := strings.Cut(value, "=")
+				if !ok || image == "" || path == "" {
+					return fmt.Errorf("invalid --sbom %q (want image=path)", value)
+				}
+				sboms[image] = path
+			}
+
+			database, err := vulns.LoadDatabase(databasePath)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(command)
+			defer cancel()
+
+			result, err := scanFunction(ctx, arguments[0], scanOptionsFromFlags(command))
+			if err != nil {
+				return err
+			}
+
+			options := vulns.Options{Database: database, Platform: platform, SBOMs: sboms, NoPull: noPull}
+			if !noPull {
+				options.Client = newCLIRegistryClient()
+			}
+			report := vulns.Check(ctx, result.Images, options)
+			for _, image := range report.Images {
+				if image.Error != "" {
+					logger.Warn("could not check image", "image", image.Image, "error", image.Error)
+				}
+			}
+			if err := writeOutput(os.Stdout, format, report); err != nil {
+				return err
+			}
+
+			summary := report.Summary
+			fmt.Fprintf(os.Stderr, "heft: vulns: %d vulnerabilities (%d critical, %d high, %d medium, %d low, %d unknown) in %d image(s), %d not checked\n",
+				summary.Vulnerabilities, summary.BySeverity[vulns.SeverityCritical], summary.BySeverity[vulns.SeverityHigh],
+				summary.BySeverity[vulns.SeverityMedium], summary.BySeverity[vulns.SeverityLow], summary.BySeverity[vulns.SeverityUnknown],
+				summary.Images, summary.Failed)
+			if failing := report.Failing(failOn); failing > 0 {
+				return fmt.Errorf("%d vulnerabilities at or above %s", failing, failOn)
+			}
+			return nil
+		},
+	}
+
+	addScanFlags(vulnsCommand, scan.ConfidenceMedium)
+	vulnsCommand.Flags().String("db", "", "OSV advisory database: a JSON file, an OSV .zip export or a directory of them")
+	vulnsCommand.Flags().StringArray("sbom", nil, "read an image's packages from a CycloneDX or SPDX JSON SBOM instead of its layers, as image=path (repeatable)")
+	vulnsCommand.Flags().String("platform", "linux/amd64", "platform of multi-platform images to check")
+	vulnsCommand.Flags().Bool("no-pull", false, "do not pull image layers; only images given with --sbom are checked")
+	vulnsCommand.Flags().String("fail-on", string(vulns.SeverityNone), "lowest severity that fails the command (unknown|low|medium|high|critical|none)")
+	vulnsCommand.Flags().String("format", "yaml", "output format for the report (yaml|json)")
+	return vulnsCommand
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+	"github.com/tonur/heft/pkg/heft"
+)
+
+// TestVulnsFailsAtThreshold verifies that vulns reads packages from a
+// given SBOM without pulling and fails once a vulnerability reaches
+// --fail-on.
+func TestVulnsFailsAtThreshold(t *testing.T) {
+	old := scanFunction
+	defer func() { scanFunction = old }()
+	scanFunction = func(ctx context.Context, chartRef string, options []heft.Option) (*scan.ScanResult, error) {
+		return &scan.ScanResult{Images: []scan.ImageFinding{{Name: "registry.invalid/app:v1"}}}, nil
+	}
+
+	directory := t.TempDir()
+	database := filepath.Join(directory, "osv.json")
+	sbom := filepath.Join(directory, "sbom.json")
+	for path, content := range map[string]string{
+		database: `{"id": "ALPINE-CVE-2024-0001", "database_specific": {"severity": "HIGH"}, "affected": [{
+		  "package": {"ecosystem": "Alpine:v3.19", "name": "openssl"},
+		  "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.1.4-r1"}]}]}]}`,
+		sbom: `{"components": [{"purl": "pkg:apk/alpine/libssl3@3.1.4-r0?upstream=openssl&distro=alpine-3.19.1"}]}`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	arguments := []string{"vulns", "./chart", "--db", database, "--sbom", "registry.invalid/app:v1=" + sbom, "--no-pull"}
+	command := newRootCommand()
+	command.SetArgs(append(arguments, "--fail-on", "critical"))
+	if err := command.Execute(); err != nil {
+		t.Fatalf("expected no failure below critical, got %v", err)
+	}
+
+	command = newRootCommand()
+	command.SetArgs(append(arguments, "--fail-on", "high"))
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "1 vulnerabilities at or above high") {
+		t.Fatalf("expected failure at high, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+// Package diff compares the images found in two scans of a chart.
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Change is an image whose repository is in both scans with a different
+// tag or digest.
+type Change struct {
+	Repository string `yaml:"repository" json:"repository"`
+	From       string `yaml:"from" json:"from"`
+	To         string `yaml:"to" json:"to"`
+	FromDigest string `yaml:"fromDigest,omitempty" json:"fromDigest,omitempty"`
+	ToDigest   string `yaml:"toDigest,omitempty" json:"toDigest,omitempty"`
+}
+
+// Result is the difference between two image sets.
+type Result struct {
+	Added     []string `yaml:"added" json:"added"`
+	Removed   []string `yaml:"removed" json:"removed"`
+	Changed   []Change `yaml:"changed" json:"changed"`
+	Unchanged int      `yaml:"unchanged" json:"unchanged"`
+}
+
+// Empty reports whether the two image sets are the same.
+func (r *Result) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0
+}
+
+// WriteSummary writes a human-readable summary of r to w.
+func (r *Result) WriteSummary(w io.Writer) {
+	fmt.Fprintf(w, "%d added, %d removed, %d changed, %d unchanged\n", len(r.Added), len(r.Removed), len(r.Changed), r.Unchanged)
+	for _, name := range r.Added {
+		fmt.Fprintf(w, "  + %s\n", name)
+	}
+	for _, name := range r.Removed {
+		fmt.Fprintf(w, "  - %s\n", name)
+	}
+	for _, change := range r.Changed {
+		fmt.Fprintf(w, "  ~ %s: %s -> %s\n", change.Repository, version(change.From, change.FromDigest), version(change.To, change.ToDigest))
+	}
+}
+
+// image is a finding keyed for comparison.
+type image struct {
+	name       string
+	repository string
+	tag        string
+	digest     string
+}
+
+func (i image) identity() string {
+	return i.tag + "@" + i.digest
+}
+
+// Images compares the images of an old and a new scan. Images are matched
+// by fully qualified repository; a repository present on both sides once
+// with a different tag or digest is reported as changed. Digests are
+// compared when known, either pinned in the image name or resolved from
+// the registry.
+func Images(old, new []scan.ImageFinding) *Result {
+	oldImages, newImages := group(old), group(new)
+
+	var repositories []string
+	for repository := range oldImages {
+		repositories = append(repositories, repository)
+	}
+	for repository := range newImages {
+		if _, ok := oldImages[repository]; !ok {
+			repositories = append(repositories, repository)
+		}
+	}
+	sort.Strings(repositories)
+
+	result := &Result{Added: []string{}, Removed: []string{}, Changed: []Change{}}
+	for _, repository := range repositories {
+		removed, added, unchanged := subtract(oldImages[repository], newImages[repository])
+		result.Unchanged += unchanged
+		if len(removed) == 1 && len(added) == 1 {
+			result.Changed = append(result.Changed, Change{
+				Repository: repository,
+				From:       removed[0].name,
+				To:         added[0].name,
+				FromDigest: removed[0].digest,
+				ToDigest:   added[0].digest,
+			})
+			continue
+		}
+		for _, image := range removed {
+			result.Removed = append(result.Removed, image.name)
+		}
+		for _, image := range added {
+			result.Added = append(result.Added, image.name)
+		}
+	}
+	return result
+}
+
+func group(findings []scan.ImageFinding) map[string][]image {
+	groups := map[string][]image{}
+	for _, finding := range findings {
+		entry := image{name: finding.Name, repository: finding.Name, digest: finding.Digest}
+		if reference, err := registry.ParseReference(finding.Name); err == nil {
+			entry.repository = reference.Name()
+			entry.tag = reference.Tag
+			if reference.Tag == "" && reference.Digest == "" {
+				entry.tag = registry.DefaultTag
+			}
+			if reference.Digest != "" {
+				entry.digest = reference.Digest
+			}
+		}
+		groups[entry.repository] = append(groups[entry.repository], entry)
+	}
+	return groups
+}
+
+// subtract returns the images only in old, only in new, and the number in
+// both.
+func subtract(old, new []image) (removed, added []image, unchanged int) {
+	newIdentities := map[string]bool{}
+	for _, image := range new {
+		newIdentities[image.identity()] = true
+	}
+	oldIdentities := map[string]bool{}
+	for _, image := range old {
+		oldIdentities[image.identity()] = true
+		if newIdentities[image.identity()] {
+			unchanged++
+		} else {
+			removed = append(removed, image)
+		}
+	}
+	for _, image := range new {
+		if !oldIdentities[image.identity()] {
+			added = append(added, image)
+		}
+	}
+	return removed, added, unchanged
+}
+
+func version(name, digest string) string {
+	if reference, err := registry.ParseReference(name); err == nil {
+		switch {
+		case reference.Tag != "" && digest != "" && reference.Digest == "":
+			return reference.Tag + "@" + shortDigest(digest)
+		case reference.Digest != "" && reference.Tag != "":
+			return reference.Tag + "@" + shortDigest(reference.Digest)
+		case reference.Digest != "":
+			return shortDigest(reference.Digest)
+		case reference.Tag != "":
+			return reference.Tag
+		}
+		return registry.DefaultTag
+	}
+	return name
+}
+
+func shortDigest(digest string) string {
+	if len(digest) > len("sha256:")+12 {
+		return digest[:len("sha256:")+12]
+	}
+	return digest
+}
@@ -0,0 +1,64 @@
+package diff
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+func findings(names ...string) []scan.ImageFinding {
+	var images []scan.ImageFinding
+	for _, name := range names {
+		images = append(images, scan.ImageFinding{Name: name})
+	}
+	return images
+}
+
+// TestImagesReportsAddedRemovedAndChanged verifies that images are matched
+// by normalized repository and that a new tag is reported as a change.
+func TestImagesReportsAddedRemovedAndChanged(t *testing.T) {
+	result := Images(
+		findings("nginx:1.25", "docker.io/bitnami/redis:7.2.3", "quay.io/org/old:v1"),
+		findings("docker.io/library/nginx:1.25", "bitnami/redis:7.2.4", "ghcr.io/org/new:v2"),
+	)
+
+	if !reflect.DeepEqual(result.Added, []string{"ghcr.io/org/new:v2"}) {
+		t.Fatalf("unexpected added: %v", result.Added)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"quay.io/org/old:v1"}) {
+		t.Fatalf("unexpected removed: %v", result.Removed)
+	}
+	want := []Change{{Repository: "docker.io/bitnami/redis", From: "docker.io/bitnami/redis:7.2.3", To: "bitnami/redis:7.2.4"}}
+	if !reflect.DeepEqual(result.Changed, want) {
+		t.Fatalf("unexpected changed: %+v", result.Changed)
+	}
+	if result.Unchanged != 1 || result.Empty() {
+		t.Fatalf("expected one unchanged image and a non-empty result, got %+v", result)
+	}
+
+	var summary bytes.Buffer
+	result.WriteSummary(&summary)
+	for _, line := range []string{"1 added, 1 removed, 1 changed, 1 unchanged", "+ ghcr.io/org/new:v2", "- quay.io/org/old:v1", "~ docker.io/bitnami/redis: 7.2.3 -> 7.2.4"} {
+		if !strings.Contains(summary.String(), line) {
+			t.Fatalf("summary missing %q:\n%s", line, summary.String())
+		}
+	}
+}
+
+// TestImagesComparesDigests verifies that an image retagged in place is a
+// change once digests are known, and that identical digests are not.
+func TestImagesComparesDigests(t *testing.T) {
+	old := []scan.ImageFinding{{Name: "ghcr.io/org/app:v1", Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaa"}}
+	retagged := []scan.ImageFinding{{Name: "ghcr.io/org/app:v1", Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbb"}}
+
+	result := Images(old, retagged)
+	if len(result.Changed) != 1 || result.Changed[0].ToDigest != "sha256:bbbbbbbbbbbbbbbbbbbbbbbb" {
+		t.Fatalf("expected a digest change, got %+v", result)
+	}
+	if result := Images(old, old); !result.Empty() || result.Unchanged != 1 {
+		t.Fatalf("expected no changes, got %+v", result)
+	}
+}
@@ -0,0 +1,296 @@
+// Package helmfile reads the releases of a helmfile.yaml, with their
+// repositories and per-environment values, so they can be scanned like
+// any other set of releases.
+package helmfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+// DefaultEnvironment is the environment used when none is given.
+const DefaultEnvironment = "default"
+
+// ReleaseKind labels the releases of a helmfile in scan results.
+const ReleaseKind = "helmfile"
+
+// Helmfile is a loaded helmfile: its releases for one environment, and
+// warnings about the parts heft does not support.
+type Helmfile struct {
+	Path        string
+	Environment string
+	Releases    []scan.Release
+	Warnings    []string
+}
+
+// state is one document of a helmfile.
+type state struct {
+	Environments map[string]environment `yaml:"environments"`
+	Repositories []repository           `yaml:"repositories"`
+	Releases     []release              `yaml:"releases"`
+	Bases        []string               `yaml:"bases"`
+}
+
+type environment struct {
+	Values  []any    `yaml:"values"`
+	Secrets []string `yaml:"secrets"`
+}
+
+type repository struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	OCI  bool   `yaml:"oci"`
+}
+
+type release struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace"`
+	Chart     string            `yaml:"chart"`
+	Version   string            `yaml:"version"`
+	Installed *bool             `yaml:"installed"`
+	Condition string            `yaml:"condition"`
+	Values    []any             `yaml:"values"`
+	Set       []setValue        `yaml:"set"`
+	Secrets   []any             `yaml:"secrets"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+type setValue struct {
+	Name  string `yaml:"name"`
+	Value any    `yaml:"value"`
+}
+
+// Load reads the helmfile at path for environment, which defaults to
+// DefaultEnvironment. Documents separated by "---" are rendered as Go
+// templates in two passes: first to find the environments, then, with the
+// selected environment's values, to read repositories and releases.
+// Releases that are not installed, or whose condition is false, are left
+// out.
+func Load(path, environmentName string) (*Helmfile, error) {
+	if environmentName == "" {
+		environmentName = DefaultEnvironment
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read helmfile: %w", err)
+	}
+	helmfile := &Helmfile{Path: path, Environment: environmentName}
+	directory := filepath.Dir(path)
+	documents := splitDocuments(data)
+
+	// The environments may themselves be templated, but cannot depend on
+	// their own values; documents that only render with them are skipped.
+	environments := map[string]environment{}
+	for _, document := range documents {
+		rendered, err := render(path, document, templateData(environmentName, nil, nil), false)
+		if err != nil {
+			continue
+		}
+		var parsed state
+		if yaml.Unmarshal(rendered, &parsed) != nil {
+			continue
+		}
+		for name, env := range parsed.Environments {
+			environments[name] = env
+		}
+	}
+	env, ok := environments[environmentName]
+	if !ok && environmentName != DefaultEnvironment {
+		return nil, fmt.Errorf("helmfile %s: environment %q is not defined", path, environmentName)
+	}
+	if len(env.Secrets) > 0 {
+		helmfile.warn("environment %q: secrets are not supported and are ignored", environmentName)
+	}
+	values := map[string]any{}
+	for _, entry := range env.Values {
+		layer, err := loadValues(directory, entry, templateData(environmentName, values, nil))
+		if err != nil {
+			return nil, fmt.Errorf("helmfile %s: environment %q: %w", path, environmentName, err)
+		}
+		mergeValues(values, layer)
+	}
+
+	repositories := map[string]repository{}
+	var releases []release
+	for i, document := range documents {
+		rendered, err := render(path, document, templateData(environmentName, values, nil), true)
+		if err != nil {
+			return nil, fmt.Errorf("helmfile %s: %w", path, err)
+		}
+		var parsed state
+		if err := yaml.Unmarshal(rendered, &parsed); err != nil {
+			return nil, fmt.Errorf("helmfile %s: document %d: %w", path, i+1, err)
+		}
+		if len(parsed.Bases) > 0 {
+			helmfile.warn("bases are not supported and are ignored")
+		}
+		for _, repo := range parsed.Repositories {
+			repositories[repo.Name] = repo
+		}
+		releases = append(releases, parsed.Releases...)
+	}
+
+	for _, r := range releases {
+		if r.Installed != nil && !*r.Installed {
+			continue
+		}
+		if r.Condition != "" && !conditionEnabled(values, r.Condition) {
+			continue
+		}
+		resolved, err := helmfile.resolveRelease(directory, r, repositories, environmentName, values)
+		if err != nil {
+			return nil, fmt.Errorf("helmfile %s: release %q: %w", path, r.Name, err)
+		}
+		helmfile.Releases = append(helmfile.Releases, resolved)
+	}
+	if len(helmfile.Releases) == 0 {
+		return nil, fmt.Errorf("helmfile %s: no releases in environment %q", path, environmentName)
+	}
+	return helmfile, nil
+}
+
+func (h *Helmfile) warn(format string, arguments ...any) {
+	h.Warnings = append(h.Warnings, fmt.Sprintf(format, arguments...))
+}
+
+// resolveRelease converts a helmfile release into a scan.Release, locating
+// its chart and loading its values.
+func (h *Helmfile) resolveRelease(directory string, r release, repositories map[string]repository, environmentName string, values map[string]any) (scan.Release, error) {
+	resolved := scan.Release{Name: r.Name, Kind: ReleaseKind, Namespace: r.Namespace}
+	switch {
+	case r.Chart == "":
+		return resolved, fmt.Errorf("no chart")
+	case strings.Contains(r.Chart, "://"):
+		resolved.Chart = r.Chart
+		if r.Version != "" && strings.HasPrefix(r.Chart, "oci://") {
+			resolved.Chart += ":" + r.Version
+		}
+	case filepath.IsAbs(r.Chart):
+		resolved.Chart = r.Chart
+	case isLocalChart(directory, r.Chart):
+		resolved.Chart = filepath.Join(directory, r.Chart)
+	default:
+		name, chart, _ := strings.Cut(r.Chart, "/")
+		repo, ok := repositories[name]
+		if !ok {
+			return resolved, fmt.Errorf("repository %q of chart %q is not defined", name, r.Chart)
+		}
+		resolved.Repository = repo.URL
+		if repo.OCI && !strings.HasPrefix(repo.URL, "oci://") {
+			resolved.Repository = "oci://" + repo.URL
+		}
+		resolved.Chart = chart
+		resolved.Version = r.Version
+	}
+
+	if len(r.Secrets) > 0 {
+		h.warn("release %q: secrets are not supported and are ignored", r.Name)
+	}
+	data := templateData(environmentName, values, map[string]any{
+		"Name":      r.Name,
+		"Namespace": r.Namespace,
+		"Chart":     r.Chart,
+		"Labels":    r.Labels,
+	})
+	for _, entry := range r.Values {
+		layer, err := loadValues(directory, entry, data)
+		if err != nil {
+			return resolved, err
+		}
+		resolved.Values = append(resolved.Values, layer)
+	}
+	for _, set := range r.Set {
+		resolved.Set = append(resolved.Set, fmt.Sprintf("--set=%s=%v", set.Name, set.Value))
+	}
+	return resolved, nil
+}
+
+// isLocalChart reports whether chart is a path to a chart on disk rather
+// than a repository/chart name.
+func isLocalChart(directory, chart string) bool {
+	if strings.HasPrefix(chart, "./") || strings.HasPrefix(chart, "../") {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(directory, chart))
+	return err == nil
+}
+
+// loadValues returns an inline values map, or reads a values file relative
+// to directory, rendering it as a template if it ends in .gotmpl.
+func loadValues(directory string, entry any, data map[string]any) (map[string]any, error) {
+	switch entry := entry.(type) {
+	case map[string]any:
+		return entry, nil
+	case string:
+		path := entry
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(directory, path)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read values: %w", err)
+		}
+		if strings.HasSuffix(path, ".gotmpl") {
+			if content, err = render(path, content, data, true); err != nil {
+				return nil, err
+			}
+		}
+		values := map[string]any{}
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return nil, fmt.Errorf("parse values %s: %w", entry, err)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported values entry %v", entry)
+	}
+}
+
+// conditionEnabled evaluates a release condition, a dotted path to a
+// boolean in the environment values.
+func conditionEnabled(values map[string]any, condition string) bool {
+	var current any = values
+	for _, key := range strings.Split(condition, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return false
+		}
+		current = object[key]
+	}
+	enabled, _ := current.(bool)
+	return enabled
+}
+
+// mergeValues deep-merges src into dst, as Helm merges values files.
+func mergeValues(dst, src map[string]any) {
+	for key, value := range src {
+		if source, ok := value.(map[string]any); ok {
+			if destination, ok := dst[key].(map[string]any); ok {
+				mergeValues(destination, source)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// splitDocuments splits a helmfile at "---" separator lines.
+func splitDocuments(data []byte) [][]byte {
+	var documents [][]byte
+	var current bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if text := strings.TrimRight(string(line), "\r\n"); text == "---" {
+			documents = append(documents, bytes.Clone(current.Bytes()))
+			current.Reset()
+			continue
+		}
+		current.Write(line)
+	}
+	return append(documents, current.Bytes())
+}
@@ -0,0 +1,144 @@
+package helmfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+const testHelmfile = `environments:
+  default:
+    values:
+      - cache:
+          enabled: false
+  prod:
+    values:
+      - environments/prod.yaml
+      - registry: registry.internal
+---
+repositories:
+  - name: bitnami
+    url: https://charts.bitnami.com/bitnami
+  - name: ghcr
+    url: ghcr.io/org/charts
+    oci: true
+
+releases:
+  - name: redis
+    namespace: cache
+    chart: bitnami/redis
+    version: ~19.0.0
+    condition: cache.enabled
+    set:
+      - name: image.registry
+        value: {{ .Values.registry }}
+  - name: api
+    namespace: {{ .Environment.Name }}
+    chart: ghcr/api
+    version: 1.2.3
+    values:
+      - values/api.yaml.gotmpl
+      - replicaCount: 3
+  - name: web
+    chart: ./charts/web
+  - name: legacy
+    chart: bitnami/legacy
+    installed: false
+`
+
+func writeTestHelmfile(t *testing.T) string {
+	t.Helper()
+	directory := t.TempDir()
+	files := map[string]string{
+		"helmfile.yaml":          testHelmfile,
+		"environments/prod.yaml": "cache:\n  enabled: true\nregistry: docker.io\n",
+		"values/api.yaml.gotmpl": "image:\n  repository: {{ .Values.registry }}/api\n  tag: {{ .Release.Name }}-{{ .Environment.Name }}\n",
+		"charts/web/Chart.yaml":  "apiVersion: v2\nname: web\nversion: 0.1.0\n",
+		"charts/web/values.yaml": "image: nginx:1.27\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(directory, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(directory, "helmfile.yaml")
+}
+
+// TestLoadResolvesReleasesForEnvironment verifies that environment values
+// are merged in order and used to render the helmfile and .gotmpl values
+// files, that charts are resolved against repositories or the helmfile's
+// directory, and that disabled releases are left out.
+func TestLoadResolvesReleasesForEnvironment(t *testing.T) {
+	path := writeTestHelmfile(t)
+	directory := filepath.Dir(path)
+
+	loaded, err := Load(path, "prod")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := []scan.Release{
+		{
+			Name:       "redis",
+			Kind:       ReleaseKind,
+			Namespace:  "cache",
+			Repository: "https://charts.bitnami.com/bitnami",
+			Chart:      "redis",
+			Version:    "~19.0.0",
+			Set:        []string{"--set=image.registry=registry.internal"},
+		},
+		{
+			Name:       "api",
+			Kind:       ReleaseKind,
+			Namespace:  "prod",
+			Repository: "oci://ghcr.io/org/charts",
+			Chart:      "api",
+			Version:    "1.2.3",
+			Values: []map[string]any{
+				{"image": map[string]any{"repository": "registry.internal/api", "tag": "api-prod"}},
+				{"replicaCount": 3},
+			},
+		},
+		{
+			Name:  "web",
+			Kind:  ReleaseKind,
+			Chart: filepath.Join(directory, "charts/web"),
+		},
+	}
+	if !reflect.DeepEqual(loaded.Releases, want) {
+		t.Fatalf("releases = %#v, want %#v", loaded.Releases, want)
+	}
+}
+
+// TestLoadDefaultEnvironmentAndErrors verifies the default environment's
+// values apply when none is given, and that undefined environments and
+// missing template values are reported.
+func TestLoadDefaultEnvironmentAndErrors(t *testing.T) {
+	path := writeTestHelmfile(t)
+
+	if _, err := Load(path, ""); err == nil || !strings.Contains(err.Error(), "registry") {
+		t.Fatalf("Load(default) error = %v, want missing registry value", err)
+	}
+	if _, err := Load(path, "staging"); err == nil || !strings.Contains(err.Error(), `environment "staging" is not defined`) {
+		t.Fatalf("Load(staging) error = %v", err)
+	}
+
+	plain := filepath.Join(filepath.Dir(path), "plain.yaml")
+	if err := os.WriteFile(plain, []byte("releases:\n  - name: web\n    chart: charts/web\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(plain, "")
+	if err != nil {
+		t.Fatalf("Load(plain): %v", err)
+	}
+	if loaded.Environment != DefaultEnvironment || len(loaded.Releases) != 1 {
+		t.Fatalf("loaded = %+v", loaded)
+	}
+}
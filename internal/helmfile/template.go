@@ -0,0 +1,137 @@
+package helmfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateData is the data helmfile templates see: the environment, its
+// values as .Values and .StateValues, and, in release values files, the
+// release.
+func templateData(environmentName string, values map[string]any, release map[string]any) map[string]any {
+	if values == nil {
+		values = map[string]any{}
+	}
+	data := map[string]any{
+		"Environment": map[string]any{"Name": environmentName, "Values": values},
+		"Values":      values,
+		"StateValues": values,
+	}
+	if release != nil {
+		data["Release"] = release
+	}
+	return data
+}
+
+// render executes content as a Go template with the subset of helmfile's
+// template functions heft supports. With strict set, referring to a
+// missing map key is an error, as in helmfile.
+func render(name string, content []byte, data map[string]any, strict bool) ([]byte, error) {
+	if !bytes.Contains(content, []byte("{{")) {
+		return content, nil
+	}
+	missingKey := "missingkey=zero"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+	parsed, err := template.New(filepath.Base(name)).Option(missingKey).Funcs(templateFunctions(filepath.Dir(name))).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	var buffer bytes.Buffer
+	if err := parsed.Execute(&buffer, data); err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func templateFunctions(directory string) template.FuncMap {
+	return template.FuncMap{
+		"env": os.Getenv,
+		"requiredEnv": func(name string) (string, error) {
+			value, ok := os.LookupEnv(name)
+			if !ok || value == "" {
+				return "", fmt.Errorf("required env var %q is not set", name)
+			}
+			return value, nil
+		},
+		"default": func(fallback, value any) any {
+			if isEmpty(value) {
+				return fallback
+			}
+			return value
+		},
+		"required": func(message string, value any) (any, error) {
+			if isEmpty(value) {
+				return nil, fmt.Errorf("%s", message)
+			}
+			return value, nil
+		},
+		"get": func(path string, fallback, values any) any {
+			current := values
+			for _, key := range strings.Split(path, ".") {
+				object, ok := current.(map[string]any)
+				if !ok {
+					return fallback
+				}
+				if current, ok = object[key]; !ok {
+					return fallback
+				}
+			}
+			return current
+		},
+		"quote":  func(value any) string { return fmt.Sprintf("%q", fmt.Sprint(value)) },
+		"squote": func(value any) string { return "'" + fmt.Sprint(value) + "'" },
+		"lower":  strings.ToLower,
+		"upper":  strings.ToUpper,
+		"trim":   strings.TrimSpace,
+		"toYaml": func(value any) (string, error) {
+			data, err := yaml.Marshal(value)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(string(data), "\n"), nil
+		},
+		"indent": func(spaces int, text string) string {
+			padding := strings.Repeat(" ", spaces)
+			return padding + strings.ReplaceAll(text, "\n", "\n"+padding)
+		},
+		"nindent": func(spaces int, text string) string {
+			padding := strings.Repeat(" ", spaces)
+			return "\n" + padding + strings.ReplaceAll(text, "\n", "\n"+padding)
+		},
+		"readFile": func(path string) (string, error) {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(directory, path)
+			}
+			data, err := os.ReadFile(path)
+			return string(data), err
+		},
+	}
+}
+
+func isEmpty(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case bool:
+		return !value
+	case int:
+		return value == 0
+	case float64:
+		return value == 0
+	case map[string]any:
+		return len(value) == 0
+	case []any:
+		return len(value) == 0
+	}
+	return false
+}
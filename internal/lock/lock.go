@@ -0,0 +1,108 @@
+// Package lock records the images a chart is expected to use in a lock
+// file, so that a later scan can detect unexpected changes.
+package lock
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+// DefaultFile is the lock file written and verified when none is given.
+const DefaultFile = "heft.lock.yaml"
+
+// header is written at the top of every lock file.
+const header = "# Generated by 'heft lock'. Verify with 'heft verify-lock'; do not edit.\n"
+
+// File is the content of a lock file.
+type File struct {
+	// Ref is the chart reference that was scanned.
+	Ref     string              `yaml:"ref"`
+	Chart   *scan.ChartMetadata `yaml:"chart,omitempty"`
+	Options Options             `yaml:"options"`
+	Images  []Image             `yaml:"images"`
+}
+
+// Options are the scan flags the lock was created with, reused when it is
+// verified so both scans see the same chart configuration.
+type Options struct {
+	MinConfidence       scan.Confidence `yaml:"minConfidence"`
+	Set                 []string        `yaml:"set,omitempty"`
+	SetString           []string        `yaml:"setString,omitempty"`
+	Values              []string        `yaml:"values,omitempty"`
+	IncludeOptionalDeps bool            `yaml:"includeOptionalDeps,omitempty"`
+	NoHelmDeps          bool            `yaml:"noHelmDeps,omitempty"`
+	ResolveDigests      bool            `yaml:"resolveDigests,omitempty"`
+	// Detectors are the names of the detectors run, in order, or empty
+	// for the defaults.
+	Detectors   []string `yaml:"detectors,omitempty"`
+	Concurrency int      `yaml:"concurrency,omitempty"`
+}
+
+// Image is a locked image.
+type Image struct {
+	Name   string `yaml:"name"`
+	Digest string `yaml:"digest,omitempty"`
+}
+
+// New builds a lock file from the result of scanning ref with options.
+// Images are sorted by name.
+func New(ref string, options Options, result *scan.ScanResult) *File {
+	file := &File{Ref: ref, Chart: result.Chart, Options: options, Images: []Image{}}
+	for _, image := range result.Images {
+		file.Images = append(file.Images, Image{Name: image.Name, Digest: image.Digest})
+	}
+	sort.Slice(file.Images, func(i, j int) bool { return file.Images[i].Name < file.Images[j].Name })
+	return file
+}
+
+// Findings returns the locked images as scan findings, for comparison with
+// a new scan.
+func (f *File) Findings() []scan.ImageFinding {
+	findings := make([]scan.ImageFinding, 0, len(f.Images))
+	for _, image := range f.Images {
+		findings = append(findings, scan.ImageFinding{Name: image.Name, Digest: image.Digest})
+	}
+	return findings
+}
+
+// Write writes f to path.
+func (f *File) Write(path string) error {
+	var buffer bytes.Buffer
+	buffer.WriteString(header)
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(f); err != nil {
+		return fmt.Errorf("encode lock: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("encode lock: %w", err)
+	}
+	if err := os.WriteFile(path, buffer.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write lock: %w", err)
+	}
+	return nil
+}
+
+// Read reads the lock file at path.
+func Read(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read lock: %w", err)
+	}
+	var file File
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("lock %s: parse: %w", path, err)
+	}
+	if file.Ref == "" {
+		return nil, fmt.Errorf("lock %s: missing ref", path)
+	}
+	return &file, nil
+}
@@ -0,0 +1,43 @@
+package lock
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+// TestWriteAndReadRoundTrip verifies that a lock file keeps its images in
+// name order and keeps the options it was created with.
+func TestWriteAndReadRoundTrip(t *testing.T) {
+	options := Options{MinConfidence: scan.ConfidenceMedium, Set: []string{"a=b"}, Values: []string{"prod.yaml"}, ResolveDigests: true, Detectors: []string{"static"}, Concurrency: 2}
+	result := &scan.ScanResult{
+		Chart: &scan.ChartMetadata{Name: "demo", Version: "1.0.0"},
+		Images: []scan.ImageFinding{
+			{Name: "nginx:1.25", Digest: "sha256:abc"},
+			{Name: "busybox:1.36"},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	if err := New("./charts/demo", options, result).Write(path); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+	file, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() returned error: %v", err)
+	}
+
+	wantImages := []Image{{Name: "busybox:1.36"}, {Name: "nginx:1.25", Digest: "sha256:abc"}}
+	if !reflect.DeepEqual(file.Images, wantImages) {
+		t.Fatalf("unexpected images: %+v", file.Images)
+	}
+	if file.Ref != "./charts/demo" || file.Chart.Version != "1.0.0" {
+		t.Fatalf("unexpected lock: %+v", file)
+	}
+
+	if !reflect.DeepEqual(file.Options, options) {
+		t.Fatalf("unexpected options: %+v", file.Options)
+	}
+}
@@ -0,0 +1,131 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/tonur/heft/internal/registry"
+)
+
+// copier copies images between registries, including every platform of a
+// multi-platform index.
+type copier struct {
+	source Source
+	target *registry.Client
+}
+
+// Copy copies the image or index source points at, with everything it
+// references, from the source to target in the target registry. It returns
+// the manifest digest and whether the copy was skipped because target
+// already held it.
+func Copy(ctx context.Context, from Source, to *registry.Client, source, target registry.Reference) (digest string, skipped bool, err error) {
+	copier := &copier{source: from, target: to}
+	return copier.copyImage(ctx, source, target)
+}
+
+// copyImage copies source to target and returns the manifest digest. When
+// target already holds the same manifest the copy is skipped, which is what
+// lets an interrupted mirror run resume where it stopped.
+func (c *copier) copyImage(ctx context.Context, source, target registry.Reference) (digest string, skipped bool, err error) {
+	data, digest, mediaType, err := c.source.GetManifest(ctx, source)
+	if err != nil {
+		return "", false, fmt.Errorf("fetch %s: %w", source, err)
+	}
+
+	existing, err := c.target.HeadManifest(ctx, target)
+	if err == nil && existing == digest {
+		return digest, true, nil
+	}
+	if err != nil && !registry.IsNotFound(err) {
+		return "", false, fmt.Errorf("check %s: %w", target, err)
+	}
+
+	if err := c.copyContent(ctx, source, target, data, mediaType); err != nil {
+		return "", false, err
+	}
+	if _, err := c.target.PutManifest(ctx, target, mediaType, data); err != nil {
+		return "", false, fmt.Errorf("push manifest %s: %w", target, err)
+	}
+	return digest, false, nil
+}
+
+// copyContent copies everything a manifest references: child manifests for
+// an index, config and layer blobs for an image manifest.
+func (c *copier) copyContent(ctx context.Context, source, target registry.Reference, data []byte, mediaType string) error {
+	if registry.IsIndex(mediaType) {
+		var index registry.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("parse index %s: %w", source, err)
+		}
+		for _, descriptor := range index.Manifests {
+			childSource := source
+			childSource.Tag, childSource.Digest = "", descriptor.Digest
+			childTarget := target
+			childTarget.Tag, childTarget.Digest = "", descriptor.Digest
+
+			childData, _, childMediaType, err := c.source.GetManifest(ctx, childSource)
+			if err != nil {
+				return fmt.Errorf("fetch %s: %w", childSource, err)
+			}
+			if err := c.copyContent(ctx, childSource, childTarget, childData, childMediaType); err != nil {
+				return err
+			}
+			if _, err := c.target.PutManifest(ctx, childTarget, childMediaType, childData); err != nil {
+				return fmt.Errorf("push manifest %s: %w", childTarget, err)
+			}
+		}
+		return nil
+	}
+
+	var manifest registry.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("parse manifest %s: %w", source, err)
+	}
+	blobs := append([]registry.Descriptor{manifest.Config}, manifest.Layers...)
+	for _, blob := range blobs {
+		if err := c.copyBlob(ctx, source, target, blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyBlob makes blob available in target's repository, preferring (in
+// order) an existing copy, a cross-repository mount on the same registry,
+// and finally streaming it from the source.
+func (c *copier) copyBlob(ctx context.Context, source, target registry.Reference, blob registry.Descriptor) error {
+	exists, err := c.target.BlobExists(ctx, target, blob.Digest)
+	if err != nil {
+		return fmt.Errorf("check blob %s in %s: %w", blob.Digest, target.Name(), err)
+	}
+	if exists {
+		return nil
+	}
+
+	// A declined mount leaves an upload session open, which the push
+	// reuses.
+	var upload *url.URL
+	if source.Registry == target.Registry {
+		mounted, session, err := c.target.MountBlob(ctx, target, blob.Digest, source.Repository)
+		if err == nil && mounted {
+			return nil
+		}
+		upload = session
+	}
+
+	content, err := c.source.GetBlob(ctx, source, blob.Digest)
+	if err != nil {
+		if upload != nil {
+			_ = c.target.CancelUpload(ctx, target, upload)
+		}
+		return fmt.Errorf("fetch blob %s from %s: %w", blob.Digest, source.Name(), err)
+	}
+	defer content.Close()
+
+	if err := c.target.PushBlob(ctx, target, upload, blob.Digest, blob.Size, content); err != nil {
+		return fmt.Errorf("push blob %s to %s: %w", blob.Digest, target.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package mirror
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/tonur/heft/internal/registry"
+)
+
+// Mapping strategies for naming mirrored repositories.
+const (
+	// StrategyKeepPath keeps the source repository path under the target
+	// prefix: docker.io/bitnami/redis -> <to>/bitnami/redis.
+	StrategyKeepPath = "keep-path"
+	// StrategyFlatten keeps only the last path segment:
+	// docker.io/bitnami/redis -> <to>/redis.
+	StrategyFlatten = "flatten"
+	// StrategyTemplate renders a Go template to produce the repository path
+	// under the target prefix.
+	StrategyTemplate = "template"
+)
+
+// Mapping derives target image references from source references.
+type Mapping struct {
+	Strategy string
+	template *template.Template
+}
+
+// TemplateData is the data available to template mappings.
+type TemplateData struct {
+	Registry   string // source registry host, e.g. docker.io
+	Repository string // source repository path, e.g. bitnami/redis
+	Name       string // last path segment of the repository, e.g. redis
+	Tag        string
+	Digest     string
+}
+
+// NewMapping validates strategy and, for StrategyTemplate, parses text as a
+// Go template such as "{{.Registry}}/{{.Repository}}". An empty strategy
+// means StrategyKeepPath.
+func NewMapping(strategy, text string) (Mapping, error) {
+	switch strategy {
+	case "", StrategyKeepPath:
+		return Mapping{Strategy: StrategyKeepPath}, nil
+	case StrategyFlatten:
+		return Mapping{Strategy: StrategyFlatten}, nil
+	case StrategyTemplate:
+		if strings.TrimSpace(text) == "" {
+			return Mapping{}, fmt.Errorf("mapping %q requires a template", strategy)
+		}
+		parsed, err := template.New("mapping").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return Mapping{}, fmt.Errorf("parse mapping template: %w", err)
+		}
+		return Mapping{Strategy: StrategyTemplate, template: parsed}, nil
+	default:
+		return Mapping{}, fmt.Errorf("unknown mapping strategy %q (want %s, %s or %s)", strategy, StrategyKeepPath, StrategyFlatten, StrategyTemplate)
+	}
+}
+
+// Target returns the reference source is mirrored to under prefix, which
+// is a registry host optionally followed by a path, e.g.
+// "registry.internal/mirror". Tag and digest are carried over; untagged
+// sources are pushed as "latest", which is what they resolve to.
+func (m Mapping) Target(prefix string, source registry.Reference) (registry.Reference, error) {
+	var repositoryPath string
+	switch m.Strategy {
+	case StrategyFlatten:
+		repositoryPath = path.Base(source.Repository)
+	case StrategyTemplate:
+		var buffer bytes.Buffer
+		data := TemplateData{
+			Registry:   source.Registry,
+			Repository: source.Repository,
+			Name:       path.Base(source.Repository),
+			Tag:        source.Tag,
+			Digest:     source.Digest,
+		}
+		if err := m.template.Execute(&buffer, data); err != nil {
+			return registry.Reference{}, fmt.Errorf("render mapping template for %s: %w", source, err)
+		}
+		repositoryPath = strings.Trim(buffer.String(), "/ ")
+	default:
+		repositoryPath = source.Repository
+	}
+
+	name := strings.TrimRight(prefix, "/") + "/" + repositoryPath
+	target, err := registry.ParseReference(name)
+	if err != nil {
+		return registry.Reference{}, fmt.Errorf("map %s to %s: %w", source, name, err)
+	}
+	if target.Tag != "" || target.Digest != "" {
+		return registry.Reference{}, fmt.Errorf("map %s: target %q must not contain a tag or digest", source, name)
+	}
+	target.Tag = source.Tag
+	target.Digest = source.Digest
+	if target.Tag == "" && target.Digest == "" {
+		target.Tag = registry.DefaultTag
+	}
+	return target, nil
+}
@@ -0,0 +1,63 @@
+package mirror
+
+import (
+	"testing"
+
+	"github.com/tonur/heft/internal/registry"
+)
+
+func TestMappingTarget(t *testing.T) {
+	cases := []struct {
+		strategy string
+		template string
+		source   string
+		want     string
+	}{
+		{StrategyKeepPath, "", "docker.io/bitnami/redis:7.2", "registry.internal/mirror/bitnami/redis:7.2"},
+		{"", "", "nginx", "registry.internal/mirror/library/nginx:latest"},
+		{StrategyFlatten, "", "ghcr.io/org/team/app:v1", "registry.internal/mirror/app:v1"},
+		{StrategyTemplate, "{{.Registry}}/{{.Repository}}", "quay.io/org/app@sha256:abcd", "registry.internal/mirror/quay.io/org/app@sha256:abcd"},
+		{StrategyTemplate, "charts/{{.Name}}", "ghcr.io/org/app:v1", "registry.internal/mirror/charts/app:v1"},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.strategy+"/"+testCase.source, func(t *testing.T) {
+			mapping, err := NewMapping(testCase.strategy, testCase.template)
+			if err != nil {
+				t.Fatalf("NewMapping error: %v", err)
+			}
+			source, err := registry.ParseReference(testCase.source)
+			if err != nil {
+				t.Fatalf("ParseReference error: %v", err)
+			}
+			target, err := mapping.Target("registry.internal/mirror/", source)
+			if err != nil {
+				t.Fatalf("Target error: %v", err)
+			}
+			if target.String() != testCase.want {
+				t.Fatalf("Target(%s) = %s, want %s", testCase.source, target, testCase.want)
+			}
+		})
+	}
+}
+
+func TestNewMappingErrors(t *testing.T) {
+	if _, err := NewMapping("nested", ""); err == nil {
+		t.Fatalf("expected error for unknown strategy")
+	}
+	if _, err := NewMapping(StrategyTemplate, ""); err == nil {
+		t.Fatalf("expected error for template strategy without template")
+	}
+	if _, err := NewMapping(StrategyTemplate, "{{.Unknown"); err == nil {
+		t.Fatalf("expected error for invalid template")
+	}
+
+	mapping, err := NewMapping(StrategyTemplate, "{{.Name}}:pinned")
+	if err != nil {
+		t.Fatalf("NewMapping error: %v", err)
+	}
+	source, _ := registry.ParseReference("ghcr.io/org/app:v1")
+	if _, err := mapping.Target("registry.internal", source); err == nil {
+		t.Fatalf("expected error when template produces a tag")
+	}
+}
@@ -0,0 +1,186 @@
+// Package mirror copies the images discovered in a chart into another
+// registry.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Status values reported for each mirrored image.
+const (
+	StatusPlanned = "planned"
+	StatusCopied  = "copied"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Source is where images are copied from. *registry.Client is a Source,
+// and so is an unpacked bundle.
+type Source interface {
+	GetManifest(ctx context.Context, reference registry.Reference) (data []byte, digest, mediaType string, err error)
+	GetBlob(ctx context.Context, reference registry.Reference, digest string) (io.ReadCloser, error)
+}
+
+// Options controls a mirror run.
+type Options struct {
+	// To is the target registry prefix, e.g. "registry.internal/mirror".
+	To      string
+	Mapping Mapping
+	// Concurrency is the number of images copied in parallel; values below
+	// one mean one.
+	Concurrency int
+	// DryRun computes target names without contacting any registry.
+	DryRun bool
+	// Source and Target are used to read and write images. They may be the
+	// same registry client.
+	Source Source
+	Target *registry.Client
+}
+
+// ImageResult is the outcome of mirroring one image.
+type ImageResult struct {
+	Source string `yaml:"source" json:"source"`
+	Target string `yaml:"target,omitempty" json:"target,omitempty"`
+	Digest string `yaml:"digest,omitempty" json:"digest,omitempty"`
+	Status string `yaml:"status" json:"status"`
+	Error  string `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// Summary counts image results by status.
+type Summary struct {
+	Total   int `yaml:"total" json:"total"`
+	Planned int `yaml:"planned,omitempty" json:"planned,omitempty"`
+	Copied  int `yaml:"copied" json:"copied"`
+	Skipped int `yaml:"skipped" json:"skipped"`
+	Failed  int `yaml:"failed" json:"failed"`
+}
+
+// Report is the result of a mirror run.
+type Report struct {
+	Images  []ImageResult `yaml:"images" json:"images"`
+	Summary Summary       `yaml:"summary" json:"summary"`
+}
+
+// Run mirrors every distinct image to options.To. A failing image does not
+// stop the others; it is recorded in the report, and re-running skips
+// images and blobs that already made it to the target.
+func Run(ctx context.Context, images []scan.ImageFinding, options Options) (*Report, error) {
+	if options.To == "" {
+		return nil, fmt.Errorf("mirror target is empty")
+	}
+
+	results := planImages(images, options)
+
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	copier := &copier{source: options.Source, target: options.Target}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for i := range results {
+		result := &results[i]
+		if result.Status != StatusPlanned || options.DryRun {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				result.Status, result.Error = StatusFailed, ctx.Err().Error()
+				return
+			}
+			copyResult(ctx, copier, result)
+		}()
+	}
+	wg.Wait()
+
+	report := NewReport(results)
+	if err := ctx.Err(); err != nil {
+		return report, fmt.Errorf("mirror interrupted: %w", err)
+	}
+	return report, nil
+}
+
+// NewReport returns a report for results with their statuses counted.
+func NewReport(results []ImageResult) *Report {
+	report := &Report{Images: results}
+	for _, result := range results {
+		report.Summary.Total++
+		switch result.Status {
+		case StatusPlanned:
+			report.Summary.Planned++
+		case StatusCopied:
+			report.Summary.Copied++
+		case StatusSkipped:
+			report.Summary.Skipped++
+		case StatusFailed:
+			report.Summary.Failed++
+		}
+	}
+	return report
+}
+
+// planImages maps each distinct image to its target. Images whose names
+// cannot be parsed or mapped are marked failed up front.
+func planImages(images []scan.ImageFinding, options Options) []ImageResult {
+	seen := map[string]bool{}
+	var results []ImageResult
+	for _, image := range images {
+		if seen[image.Name] {
+			continue
+		}
+		seen[image.Name] = true
+
+		result := ImageResult{Source: image.Name, Status: StatusPlanned}
+		source, err := registry.ParseReference(image.Name)
+		if err == nil {
+			var target registry.Reference
+			target, err = options.Mapping.Target(options.To, source)
+			result.Target = target.String()
+		}
+		if err != nil {
+			result.Status, result.Error = StatusFailed, err.Error()
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Source < results[j].Source })
+	return results
+}
+
+func copyResult(ctx context.Context, copier *copier, result *ImageResult) {
+	source, err := registry.ParseReference(result.Source)
+	if err != nil {
+		result.Status, result.Error = StatusFailed, err.Error()
+		return
+	}
+	target, err := registry.ParseReference(result.Target)
+	if err != nil {
+		result.Status, result.Error = StatusFailed, err.Error()
+		return
+	}
+
+	digest, skipped, err := copier.copyImage(ctx, source, target)
+	if err != nil {
+		result.Status, result.Error = StatusFailed, err.Error()
+		return
+	}
+	result.Digest = digest
+	result.Status = StatusCopied
+	if skipped {
+		result.Status = StatusSkipped
+	}
+}
@@ -0,0 +1,190 @@
+package mirror
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+)
+
+func newTestOptions(t *testing.T, to string, concurrency int) Options {
+	t.Helper()
+	mapping, err := NewMapping(StrategyKeepPath, "")
+	if err != nil {
+		t.Fatalf("NewMapping: %v", err)
+	}
+	client := &registry.Client{}
+	return Options{To: to, Mapping: mapping, Concurrency: concurrency, Source: client, Target: client}
+}
+
+func TestRunCopiesMultiPlatformImagesAndResumes(t *testing.T) {
+	source := registrytest.New(t)
+	target := registrytest.New(t)
+
+	amd64 := source.AddImage("org/app", "", []byte(`{"os":"linux","architecture":"amd64"}`), []byte("layer-amd64"))
+	arm64 := source.AddImage("org/app", "", []byte(`{"os":"linux","architecture":"arm64"}`), []byte("layer-arm64"))
+	index := source.AddIndex("org/app", "v1", map[string]registry.Platform{
+		amd64: {OS: "linux", Architecture: "amd64"},
+		arm64: {OS: "linux", Architecture: "arm64"},
+	})
+	single := source.AddImage("org/tool", "2.0", []byte(`{"os":"linux","architecture":"amd64"}`), []byte("tool-layer"))
+
+	images := []scan.ImageFinding{
+		{Name: source.Host() + "/org/app:v1"},
+		{Name: source.Host() + "/org/tool:2.0"},
+		{Name: source.Host() + "/org/app:v1"},
+	}
+
+	report, err := Run(context.Background(), images, newTestOptions(t, target.Host()+"/mirror", 2))
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if report.Summary.Total != 2 || report.Summary.Copied != 2 || report.Summary.Failed != 0 {
+		t.Fatalf("unexpected summary: %+v (%+v)", report.Summary, report.Images)
+	}
+	if report.Images[0].Target != target.Host()+"/mirror/org/app:v1" || report.Images[0].Digest != index {
+		t.Fatalf("unexpected result: %+v", report.Images[0])
+	}
+
+	if _, ok := target.Manifest("mirror/org/app", "v1"); !ok {
+		t.Fatalf("expected index to be tagged v1 in target")
+	}
+	for _, digest := range []string{amd64, arm64} {
+		if _, ok := target.Manifest("mirror/org/app", digest); !ok {
+			t.Fatalf("expected platform manifest %s in target", digest)
+		}
+	}
+	if !target.HasBlob("mirror/org/app", registry.Digest([]byte("layer-arm64"))) {
+		t.Fatalf("expected arm64 layer to be copied")
+	}
+	if _, ok := target.Manifest("mirror/org/tool", single); !ok {
+		t.Fatalf("expected single-platform image in target")
+	}
+
+	report, err = Run(context.Background(), images, newTestOptions(t, target.Host()+"/mirror", 1))
+	if err != nil {
+		t.Fatalf("second Run error: %v", err)
+	}
+	if report.Summary.Skipped != 2 || report.Summary.Copied != 0 {
+		t.Fatalf("expected second run to skip mirrored images, got %+v", report.Summary)
+	}
+}
+
+func TestRunRecordsFailuresAndResumes(t *testing.T) {
+	source := registrytest.New(t)
+	target := registrytest.New(t)
+	source.AddImage("org/app", "v1", []byte(`{}`), []byte("app-layer"))
+	source.AddImage("org/tool", "v1", []byte(`{"tool":true}`), []byte("tool-layer"))
+
+	var failing atomic.Bool
+	failing.Store(true)
+	target.Fail = func(request *http.Request) bool {
+		return failing.Load() && request.Method == http.MethodPut && strings.Contains(request.URL.Path, "/org/tool/manifests/")
+	}
+
+	images := []scan.ImageFinding{
+		{Name: source.Host() + "/org/app:v1"},
+		{Name: source.Host() + "/org/tool:v1"},
+		{Name: "not a valid image"},
+	}
+
+	report, err := Run(context.Background(), images, newTestOptions(t, target.Host(), 2))
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if report.Summary.Copied != 1 || report.Summary.Failed != 2 {
+		t.Fatalf("unexpected summary: %+v (%+v)", report.Summary, report.Images)
+	}
+
+	failing.Store(false)
+	before := len(target.Requests())
+	report, err = Run(context.Background(), images, newTestOptions(t, target.Host(), 2))
+	if err != nil {
+		t.Fatalf("second Run error: %v", err)
+	}
+	if report.Summary.Skipped != 1 || report.Summary.Copied != 1 || report.Summary.Failed != 1 {
+		t.Fatalf("expected resume to copy only the failed image, got %+v", report.Summary)
+	}
+	for _, request := range target.Requests()[before:] {
+		if strings.HasPrefix(request, "PUT ") && strings.Contains(request, "/org/tool/blobs/") {
+			t.Fatalf("expected tool blobs from the failed run to be reused, got %s", request)
+		}
+	}
+}
+
+func TestRunMountsBlobsWithinRegistry(t *testing.T) {
+	server := registrytest.New(t)
+	server.AddImage("org/app", "v1", []byte(`{}`), []byte("layer"))
+
+	report, err := Run(context.Background(), []scan.ImageFinding{{Name: server.Host() + "/org/app:v1"}}, newTestOptions(t, server.Host()+"/mirror", 1))
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if report.Summary.Copied != 1 {
+		t.Fatalf("unexpected summary: %+v (%+v)", report.Summary, report.Images)
+	}
+
+	mounted := false
+	for _, request := range server.Requests() {
+		if strings.HasPrefix(request, "POST /v2/mirror/org/app/blobs/uploads/?") && strings.Contains(request, "mount=") {
+			mounted = true
+		}
+		if strings.HasPrefix(request, "PUT /v2/mirror/org/app/blobs/uploads/") {
+			t.Fatalf("expected blobs to be mounted rather than uploaded, got %s", request)
+		}
+	}
+	if !mounted {
+		t.Fatalf("expected a cross-repository mount request")
+	}
+}
+
+func TestRunUploadsIntoSessionOfDeclinedMount(t *testing.T) {
+	server := registrytest.New(t)
+	server.DeclineMounts = true
+	server.AddImage("org/app", "v1", []byte(`{}`), []byte("layer"))
+
+	report, err := Run(context.Background(), []scan.ImageFinding{{Name: server.Host() + "/org/app:v1"}}, newTestOptions(t, server.Host()+"/mirror", 1))
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if report.Summary.Copied != 1 {
+		t.Fatalf("unexpected summary: %+v (%+v)", report.Summary, report.Images)
+	}
+
+	posts, puts := 0, 0
+	for _, request := range server.Requests() {
+		if strings.HasPrefix(request, "POST /v2/mirror/org/app/blobs/uploads/") {
+			posts++
+		}
+		if strings.HasPrefix(request, "PUT /v2/mirror/org/app/blobs/uploads/") {
+			puts++
+		}
+	}
+	if posts != puts {
+		t.Fatalf("expected one upload session per uploaded blob, got %d sessions for %d uploads", posts, puts)
+	}
+	if open := server.OpenUploads(); len(open) != 0 {
+		t.Fatalf("expected no dangling upload sessions, got %v", open)
+	}
+}
+
+func TestRunDryRunDoesNotContactRegistries(t *testing.T) {
+	options := newTestOptions(t, "registry.internal/mirror", 1)
+	options.DryRun = true
+
+	report, err := Run(context.Background(), []scan.ImageFinding{{Name: "bitnami/redis:7.2"}}, options)
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if report.Summary.Planned != 1 || report.Images[0].Status != StatusPlanned {
+		t.Fatalf("expected planned image, got %+v", report)
+	}
+	if report.Images[0].Target != "registry.internal/mirror/bitnami/redis:7.2" {
+		t.Fatalf("unexpected target %q", report.Images[0].Target)
+	}
+}
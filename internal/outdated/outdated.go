@@ -0,0 +1,149 @@
+// Package outdated finds newer versions of images by listing the tags of
+// their repositories.
+package outdated
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Options controls which tags are considered.
+type Options struct {
+	// Client lists tags.
+	Client *registry.Client
+	// TagFilter, when set, limits candidate tags to those it matches.
+	TagFilter *regexp.Regexp
+	// IncludePrerelease considers tags such as 1.3.0-rc.1.
+	IncludePrerelease bool
+}
+
+// Result is the newest version available for an image at each level. The
+// levels are only set when newer than the current tag; Skipped explains
+// why an image was not checked.
+type Result struct {
+	Image   string `yaml:"image" json:"image"`
+	Current string `yaml:"current,omitempty" json:"current,omitempty"`
+	Patch   string `yaml:"patch,omitempty" json:"patch,omitempty"`
+	Minor   string `yaml:"minor,omitempty" json:"minor,omitempty"`
+	Major   string `yaml:"major,omitempty" json:"major,omitempty"`
+	Skipped string `yaml:"skipped,omitempty" json:"skipped,omitempty"`
+	Error   string `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// Outdated reports whether a newer version was found.
+func (r Result) Outdated() bool {
+	return r.Patch != "" || r.Minor != "" || r.Major != ""
+}
+
+// Summary counts results.
+type Summary struct {
+	Images   int `yaml:"images" json:"images"`
+	Outdated int `yaml:"outdated" json:"outdated"`
+	Skipped  int `yaml:"skipped" json:"skipped"`
+	Failed   int `yaml:"failed" json:"failed"`
+}
+
+// Report is the outcome of Check.
+type Report struct {
+	Summary Summary  `yaml:"summary" json:"summary"`
+	Images  []Result `yaml:"images" json:"images"`
+}
+
+// Check looks up newer versions of every image with a semver-like tag.
+// Tags are listed once per repository. Registry errors are recorded on
+// the image's result rather than returned.
+func Check(ctx context.Context, images []scan.ImageFinding, options Options) *Report {
+	client := options.Client
+	if client == nil {
+		client = &registry.Client{}
+	}
+
+	type listing struct {
+		tags []string
+		err  error
+	}
+	listings := map[string]listing{}
+
+	report := &Report{Images: []Result{}}
+	for _, image := range images {
+		result := Result{Image: image.Name}
+		reference, err := registry.ParseReference(image.Name)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case reference.Tag == "":
+			result.Skipped = "image has no tag"
+		default:
+			current, ok := parseVersion(reference.Tag)
+			if !ok {
+				result.Skipped = "tag is not a version"
+				break
+			}
+			result.Current = reference.Tag
+			tags, cached := listings[reference.Name()]
+			if !cached {
+				tags.tags, tags.err = client.ListTags(ctx, reference)
+				listings[reference.Name()] = tags
+			}
+			if tags.err != nil {
+				result.Error = tags.err.Error()
+				break
+			}
+			result.Patch, result.Minor, result.Major = newer(current, tags.tags, options)
+		}
+
+		report.Images = append(report.Images, result)
+		report.Summary.Images++
+		switch {
+		case result.Error != "":
+			report.Summary.Failed++
+		case result.Skipped != "":
+			report.Summary.Skipped++
+		case result.Outdated():
+			report.Summary.Outdated++
+		}
+	}
+	return report
+}
+
+// newer returns the newest tag in tags that is a patch, minor and major
+// upgrade of current respectively.
+func newer(current version, tags []string, options Options) (patch, minor, major string) {
+	var best [3]*version
+	for _, tag := range tags {
+		if options.TagFilter != nil && !options.TagFilter.MatchString(tag) {
+			continue
+		}
+		candidate, ok := parseVersion(tag)
+		if !ok || !current.comparable(candidate) || candidate.compare(current) <= 0 {
+			continue
+		}
+		if candidate.prerelease && !options.IncludePrerelease {
+			continue
+		}
+		level := 0
+		for level < len(current.parts)-1 && candidate.parts[level] == current.parts[level] {
+			level++
+		}
+		// level counts leading components in common: for three-part
+		// versions 2 is a patch, 1 a minor and 0 a major upgrade.
+		slot := len(current.parts) - 1 - level
+		if len(current.parts) < 3 {
+			slot += 3 - len(current.parts)
+		}
+		if best[slot] == nil || candidate.compare(*best[slot]) > 0 {
+			best[slot] = &candidate
+		}
+	}
+
+	tag := func(v *version) string {
+		if v == nil {
+			return ""
+		}
+		return v.tag
+	}
+	return tag(best[0]), tag(best[1]), tag(best[2])
+}
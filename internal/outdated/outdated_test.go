@@ -0,0 +1,78 @@
+package outdated
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// TestCheckReportsNewerVersionsFromRegistry verifies that Check lists tags
+// from the registry and reports the newest patch, minor and major versions
+// of the same variant, skipping prereleases and non-version tags.
+func TestCheckReportsNewerVersionsFromRegistry(t *testing.T) {
+	server := registrytest.New(t)
+	for _, tag := range []string{"1.25.3", "1.25.4", "1.25.10", "1.26.0", "1.27.1", "2.0.0-rc.1", "1.27.2-alpine", "latest"} {
+		server.AddImage("library/nginx", tag, []byte(`{}`))
+	}
+	for _, tag := range []string{"3.18-alpine", "3.19-alpine", "3.19"} {
+		server.AddImage("org/tool", tag, []byte(`{}`))
+	}
+
+	images := []scan.ImageFinding{
+		{Name: server.Host() + "/library/nginx:1.25.3"},
+		{Name: server.Host() + "/org/tool:3.18-alpine"},
+		{Name: server.Host() + "/library/nginx:latest"},
+	}
+	report := Check(context.Background(), images, Options{})
+
+	nginx := report.Images[0]
+	if nginx.Patch != "1.25.10" || nginx.Minor != "1.27.1" || nginx.Major != "" {
+		t.Fatalf("unexpected nginx result: %+v", nginx)
+	}
+	tool := report.Images[1]
+	if tool.Minor != "3.19-alpine" || tool.Patch != "" || tool.Major != "" {
+		t.Fatalf("unexpected tool result: %+v", tool)
+	}
+	if report.Images[2].Skipped == "" {
+		t.Fatalf("expected latest to be skipped, got %+v", report.Images[2])
+	}
+	if report.Summary != (Summary{Images: 3, Outdated: 2, Skipped: 1}) {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+
+	report = Check(context.Background(), images[:1], Options{IncludePrerelease: true, TagFilter: regexp.MustCompile(`^(1\.25\.4|2\..*)$`)})
+	if got := report.Images[0]; got.Patch != "1.25.4" || got.Minor != "" || got.Major != "2.0.0-rc.1" {
+		t.Fatalf("unexpected filtered result: %+v", got)
+	}
+}
+
+// TestCheckRecordsRegistryErrors verifies that a repository that cannot be
+// listed fails only its own images.
+func TestCheckRecordsRegistryErrors(t *testing.T) {
+	server := registrytest.New(t)
+	report := Check(context.Background(), []scan.ImageFinding{{Name: server.Host() + "/org/missing:1.0.0"}}, Options{})
+	if report.Summary.Failed != 1 || report.Images[0].Error == "" {
+		t.Fatalf("expected a failed image, got %+v", report)
+	}
+}
+
+func TestCompareOrdersVersions(t *testing.T) {
+	for _, test := range []struct {
+		older, newer string
+	}{
+		{"1.2.9", "1.2.10"},
+		{"1.3.0-rc.1", "1.3.0"},
+		{"1.3.0-rc.2", "1.3.0-rc.10"},
+		{"7.2.4-debian-12-r3", "7.2.4-debian-12-r10"},
+		{"v1.9", "v1.10"},
+	} {
+		older, _ := parseVersion(test.older)
+		newer, _ := parseVersion(test.newer)
+		if !older.comparable(newer) || older.compare(newer) >= 0 {
+			t.Errorf("expected %s < %s", test.older, test.newer)
+		}
+	}
+}
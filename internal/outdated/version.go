@@ -0,0 +1,121 @@
+package outdated
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionPattern matches semver-like tags: an optional "v", one to three
+// numeric components and an optional suffix, e.g. v1.2, 1.25.3-alpine or
+// 2.0.0-rc.1.
+var versionPattern = regexp.MustCompile(`^(v?)(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z][0-9A-Za-z.-]*))?$`)
+
+// prereleasePattern matches suffixes that mark a prerelease rather than an
+// image variant such as -alpine.
+var prereleasePattern = regexp.MustCompile(`(?i)^(alpha|beta|rc|pre|preview|dev|snapshot)([.-]?\d+)*$`)
+
+var digits = regexp.MustCompile(`\d+`)
+
+// version is a parsed semver-like tag.
+type version struct {
+	tag        string
+	prefix     string
+	parts      []int
+	suffix     string
+	prerelease bool
+}
+
+// parseVersion parses tag, reporting false for tags that are not
+// semver-like, such as "latest".
+func parseVersion(tag string) (version, bool) {
+	match := versionPattern.FindStringSubmatch(tag)
+	if match == nil {
+		return version{}, false
+	}
+	parsed := version{tag: tag, prefix: match[1], suffix: match[5]}
+	for _, part := range match[2:5] {
+		if part == "" {
+			break
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return version{}, false
+		}
+		parsed.parts = append(parsed.parts, number)
+	}
+	parsed.prerelease = parsed.suffix != "" && prereleasePattern.MatchString(parsed.suffix)
+	return parsed, true
+}
+
+// variant is the image flavour named by a non-prerelease suffix with its
+// numbers removed, so 7.2.4-debian-12-r3 and 7.2.5-debian-12-r0 are the same
+// variant while 1.25-alpine and 1.25 are not.
+func (v version) variant() string {
+	if v.prerelease {
+		return ""
+	}
+	return digits.ReplaceAllString(v.suffix, "")
+}
+
+// comparable reports whether o is an upgrade candidate for v: the same
+// prefix, number of components and variant.
+func (v version) comparable(o version) bool {
+	return v.prefix == o.prefix && len(v.parts) == len(o.parts) && v.variant() == o.variant()
+}
+
+// compare orders comparable versions by their numeric components, then
+// releases after prereleases, then by suffix with numbers compared
+// numerically.
+func (v version) compare(o version) int {
+	for i := range v.parts {
+		if v.parts[i] != o.parts[i] {
+			if v.parts[i] < o.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	if v.prerelease != o.prerelease {
+		if v.prerelease {
+			return -1
+		}
+		return 1
+	}
+	return naturalCompare(v.suffix, o.suffix)
+}
+
+// naturalCompare compares strings with runs of digits compared as numbers.
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		aDigits, bDigits := leadingDigits(a), leadingDigits(b)
+		if aDigits != "" && bDigits != "" {
+			aNumber, _ := strconv.Atoi(aDigits)
+			bNumber, _ := strconv.Atoi(bDigits)
+			if aNumber != bNumber {
+				if aNumber < bNumber {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[len(aDigits):], b[len(bDigits):]
+			continue
+		}
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[1:], b[1:]
+	}
+	return strings.Compare(a, b)
+}
+
+func leadingDigits(s string) string {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
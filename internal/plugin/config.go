@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnvironment names the environment variable that points at the heft
+// config file.
+const ConfigEnvironment = "HEFT_CONFIG"
+
+// Config is the part of the heft config file that lists plugins.
+type Config struct {
+	Plugins struct {
+		Detectors []ConfigDetector `yaml:"detectors"`
+	} `yaml:"plugins"`
+}
+
+// ConfigDetector is a detector plugin listed in the config file.
+type ConfigDetector struct {
+	// Name overrides the name the plugin reports.
+	Name string `yaml:"name"`
+	// Command is the plugin executable, relative to the config file or
+	// looked up on PATH; Args are passed before "info" and "detect".
+	Command string        `yaml:"command"`
+	Args    []string      `yaml:"args"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// ConfigFile returns the heft config file: $HEFT_CONFIG, or
+// heft/config.yaml in the user's config directory.
+func ConfigFile() string {
+	if path := os.Getenv(ConfigEnvironment); path != "" {
+		return path
+	}
+	directory, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(directory, "heft", "config.yaml")
+}
+
+// LoadConfig reads the config file at path. A missing file is an empty
+// config.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	for i, detector := range config.Plugins.Detectors {
+		if detector.Command == "" {
+			return nil, fmt.Errorf("config %s: detector plugin %d has no command", path, i+1)
+		}
+	}
+	return config, nil
+}
+
+// Find loads the detector plugins listed in the config file at configPath
+// and those on pathList. A plugin that cannot be loaded is reported in the
+// returned errors and left out; so is one whose name is taken.
+func Find(ctx context.Context, configPath, pathList string) ([]*Detector, []error) {
+	var detectors []*Detector
+	var errs []error
+	names := map[string]bool{}
+	paths := map[string]bool{}
+	add := func(detector *Detector, err error) {
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case names[detector.Name()]:
+			errs = append(errs, fmt.Errorf("plugin %s: detector %q is already defined", detector.Path(), detector.Name()))
+		default:
+			names[detector.Name()] = true
+			paths[detector.Path()] = true
+			detectors = append(detectors, detector)
+		}
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, []error{err}
+	}
+	for _, entry := range config.Plugins.Detectors {
+		command, err := commandPath(entry.Command, filepath.Dir(configPath))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		add(Load(ctx, command, entry.Args, entry.Name, entry.Timeout))
+	}
+	for _, path := range Discover(pathList) {
+		if !paths[path] {
+			add(Load(ctx, path, nil, "", 0))
+		}
+	}
+	return detectors, errs
+}
+
+// commandPath resolves a configured command: paths are relative to the
+// config file's directory, bare names are looked up on PATH.
+func commandPath(command, directory string) (string, error) {
+	if filepath.Base(command) == command {
+		path, err := exec.LookPath(command)
+		if err != nil {
+			return "", fmt.Errorf("plugin %s: %w", command, err)
+		}
+		return path, nil
+	}
+	if !filepath.IsAbs(command) {
+		command = filepath.Join(directory, command)
+	}
+	return command, nil
+}
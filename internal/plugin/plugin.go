@@ -0,0 +1,230 @@
+// Package plugin runs external detectors: executables named
+// heft-detector-* on PATH, or listed in the heft config file, that find
+// images in charts.
+//
+// The protocol is JSON over stdin and stdout. heft first runs
+// "<plugin> info", which prints an Info; plugins speaking another
+// ProtocolVersion are not used. To scan a chart, heft runs
+// "<plugin> detect" with a Request on stdin and reads a Response from
+// stdout. A non-zero exit status fails the detector, with stderr as the
+// error message.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+// ProtocolVersion is the version of the protocol heft speaks.
+const ProtocolVersion = 1
+
+// Prefix is the prefix of plugin executables found on PATH; the rest of
+// the file name is the detector's default name.
+const Prefix = "heft-detector-"
+
+// Default timeouts for the info handshake and for scanning one chart.
+const (
+	DefaultInfoTimeout   = 5 * time.Second
+	DefaultDetectTimeout = 2 * time.Minute
+)
+
+// Info is what a plugin prints for "info".
+type Info struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	Name            string `json:"name,omitempty"`
+	// Confidence is the confidence of the plugin's findings; it defaults
+	// to medium.
+	Confidence scan.Confidence `json:"confidence,omitempty"`
+}
+
+// Request is what a plugin reads on stdin for "detect".
+type Request struct {
+	ProtocolVersion int   `json:"protocolVersion"`
+	Chart           Chart `json:"chart"`
+}
+
+// Chart is the chart to scan, with the values heft renders it with.
+type Chart struct {
+	// Path is the local chart directory.
+	Path string `json:"path"`
+	// Set and SetString are key=value pairs as passed to helm --set and
+	// --set-string; ValuesFiles are --values files, in order.
+	Set         []string `json:"set,omitempty"`
+	SetString   []string `json:"setString,omitempty"`
+	ValuesFiles []string `json:"valuesFiles,omitempty"`
+	HelmBin     string   `json:"helmBin,omitempty"`
+	Verbose     bool     `json:"verbose,omitempty"`
+}
+
+// Response is what a plugin prints for "detect".
+type Response struct {
+	Images []scan.ImageFinding `json:"images"`
+}
+
+// Detector is a plugin used as a scan.Detector.
+type Detector struct {
+	name       string
+	path       string
+	arguments  []string
+	confidence scan.Confidence
+	timeout    time.Duration
+}
+
+// Load runs the info handshake with the plugin at path, which is called
+// with arguments before "info" and "detect". name overrides the name the
+// plugin reports, and timeout bounds each detect call; zero means
+// DefaultDetectTimeout.
+func Load(ctx context.Context, path string, arguments []string, name string, timeout time.Duration) (*Detector, error) {
+	detector := &Detector{path: path, arguments: arguments, timeout: timeout}
+	if detector.timeout == 0 {
+		detector.timeout = DefaultDetectTimeout
+	}
+
+	output, err := detector.run(ctx, DefaultInfoTimeout, "info", nil)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: info: %w", path, err)
+	}
+	var info Info
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("plugin %s: info: decode: %w", path, err)
+	}
+	if info.ProtocolVersion != ProtocolVersion {
+		return nil, fmt.Errorf("plugin %s speaks protocol version %d; heft supports %d", path, info.ProtocolVersion, ProtocolVersion)
+	}
+
+	detector.name = name
+	if detector.name == "" {
+		detector.name = info.Name
+	}
+	if detector.name == "" {
+		detector.name = strings.TrimPrefix(filepath.Base(path), Prefix)
+	}
+	switch info.Confidence {
+	case "":
+		detector.confidence = scan.ConfidenceMedium
+	case scan.ConfidenceHigh, scan.ConfidenceMedium, scan.ConfidenceLow:
+		detector.confidence = info.Confidence
+	default:
+		return nil, fmt.Errorf("plugin %s: invalid confidence %q", path, info.Confidence)
+	}
+	return detector, nil
+}
+
+// Name returns the detector's name.
+func (d *Detector) Name() string { return d.name }
+
+// Confidence returns the confidence of the detector's findings.
+func (d *Detector) Confidence() scan.Confidence { return d.confidence }
+
+// Path returns the plugin executable.
+func (d *Detector) Path() string { return d.path }
+
+// Detect runs the plugin on chart. Findings without a source are marked
+// with the plugin's name.
+func (d *Detector) Detect(ctx context.Context, chart scan.Chart) ([]scan.ImageFinding, error) {
+	request := Request{ProtocolVersion: ProtocolVersion, Chart: Chart{
+		Path:        chart.Path,
+		HelmBin:     chart.HelmBin,
+		Verbose:     chart.Verbose,
+		ValuesFiles: trimPrefixes(chart.ValuesFiles, "--values="),
+	}}
+	for _, value := range chart.Values {
+		if stringValue, ok := strings.CutPrefix(value, "--set-string="); ok {
+			request.Chart.SetString = append(request.Chart.SetString, stringValue)
+		} else {
+			request.Chart.Set = append(request.Chart.Set, strings.TrimPrefix(value, "--set="))
+		}
+	}
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	output, err := d.run(ctx, d.timeout, "detect", input)
+	if err != nil {
+		return nil, err
+	}
+	var response Response
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	for i := range response.Images {
+		if response.Images[i].Source == "" {
+			response.Images[i].Source = scan.SourceKind(d.name)
+		}
+	}
+	return response.Images, nil
+}
+
+// run runs the plugin with command and input on stdin, and returns its
+// stdout.
+func (d *Detector) run(ctx context.Context, timeout time.Duration, command string, input []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	process := exec.CommandContext(ctx, d.path, append(append([]string(nil), d.arguments...), command)...)
+	process.WaitDelay = time.Second
+	process.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	process.Stdout, process.Stderr = &stdout, &stderr
+	if err := process.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out after %s", timeout)
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Discover returns the heft-detector-* executables in the directories of
+// pathList, a PATH-style list. As with commands, the first executable of a
+// name wins.
+func Discover(pathList string) []string {
+	seen := map[string]bool{}
+	var found []string
+	for _, directory := range filepath.SplitList(pathList) {
+		if directory == "" {
+			continue
+		}
+		entries, err := os.ReadDir(directory)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, Prefix) || seen[name] {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(directory, name))
+			if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+				continue
+			}
+			seen[name] = true
+			found = append(found, filepath.Join(directory, name))
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return filepath.Base(found[i]) < filepath.Base(found[j]) })
+	return found
+}
+
+func trimPrefixes(values []string, prefix string) []string {
+	var trimmed []string
+	for _, value := range values {
+		trimmed = append(trimmed, strings.TrimPrefix(value, prefix))
+	}
+	return trimmed
+}
@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+// writePlugin writes a shell script plugin that answers info with info,
+// saves each detect request next to itself and answers with response.
+func writePlugin(t *testing.T, directory, name, info, response string) string {
+	t.Helper()
+	path := filepath.Join(directory, name)
+	script := `#!/bin/sh
+case "$1" in
+info) echo '` + info + `' ;;
+detect) cat > "$0.request"; echo '` + response + `' ;;
+*) echo "unexpected command $1" >&2; exit 2 ;;
+esac
+`
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDetectorProtocol(t *testing.T) {
+	directory := t.TempDir()
+	path := writePlugin(t, directory, "heft-detector-configmap",
+		`{"protocolVersion":1,"confidence":"high"}`,
+		`{"images":[{"name":"example.com/app:v1","file":"templates/cm.yaml","line":4},{"name":"example.com/sidecar:v2","source":"custom"}]}`)
+
+	detector, err := Load(context.Background(), path, nil, "", 0)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if detector.Name() != "configmap" || detector.Confidence() != scan.ConfidenceHigh {
+		t.Fatalf("detector = %s/%s", detector.Name(), detector.Confidence())
+	}
+
+	images, err := detector.Detect(context.Background(), scan.Chart{
+		Path:        "/charts/app",
+		Values:      []string{"--set=a=1", "--set-string=b=2"},
+		ValuesFiles: []string{"--values=prod.yaml"},
+		HelmBin:     "helm",
+	})
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	want := []scan.ImageFinding{
+		{Name: "example.com/app:v1", Source: "configmap", File: "templates/cm.yaml", Line: 4},
+		{Name: "example.com/sidecar:v2", Source: "custom"},
+	}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("images = %+v, want %+v", images, want)
+	}
+
+	data, err := os.ReadFile(path + ".request")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request Request
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatal(err)
+	}
+	wantRequest := Request{ProtocolVersion: ProtocolVersion, Chart: Chart{
+		Path:        "/charts/app",
+		Set:         []string{"a=1"},
+		SetString:   []string{"b=2"},
+		ValuesFiles: []string{"prod.yaml"},
+		HelmBin:     "helm",
+	}}
+	if !reflect.DeepEqual(request, wantRequest) {
+		t.Errorf("request = %+v, want %+v", request, wantRequest)
+	}
+}
+
+func TestLoadRejectsOtherProtocolVersions(t *testing.T) {
+	path := writePlugin(t, t.TempDir(), "heft-detector-future", `{"protocolVersion":2}`, `{}`)
+	if _, err := Load(context.Background(), path, nil, "", 0); err == nil || !strings.Contains(err.Error(), "protocol version 2") {
+		t.Fatalf("Load error = %v, want protocol version error", err)
+	}
+}
+
+func TestDetectTimesOutAndReportsStderr(t *testing.T) {
+	directory := t.TempDir()
+	slow := filepath.Join(directory, "slow")
+	script := "#!/bin/sh\nif [ \"$1\" = info ]; then echo '{\"protocolVersion\":1}'; exit 0; fi\nexec sleep 10\n"
+	if err := os.WriteFile(slow, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	detector, err := Load(context.Background(), slow, nil, "", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, err := detector.Detect(context.Background(), scan.Chart{Path: directory}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Detect error = %v, want timeout", err)
+	}
+
+	failing := writePlugin(t, directory, "failing", `{"protocolVersion":1}`, `{}`)
+	_, err = Load(context.Background(), failing, []string{"--mode"}, "", 0)
+	if err == nil {
+		t.Fatal("expected an error when the plugin rejects its arguments")
+	}
+	if !strings.Contains(err.Error(), "unexpected command --mode") {
+		t.Errorf("Load error = %v, want plugin stderr", err)
+	}
+}
+
+// TestFindUsesConfigAndPath verifies that plugins come from the config
+// file and PATH, that the first plugin of a name wins and that broken
+// plugins are reported.
+func TestFindUsesConfigAndPath(t *testing.T) {
+	configDirectory := t.TempDir()
+	first, second := t.TempDir(), t.TempDir()
+	writePlugin(t, configDirectory, "inhouse", `{"protocolVersion":1,"name":"inhouse"}`, `{"images":[]}`)
+	writePlugin(t, first, "heft-detector-operator", `{"protocolVersion":1}`, `{"images":[]}`)
+	writePlugin(t, second, "heft-detector-operator", `{"protocolVersion":1,"confidence":"low"}`, `{"images":[]}`)
+	writePlugin(t, second, "heft-detector-broken", `not json`, `{}`)
+	if err := os.WriteFile(filepath.Join(second, "heft-detector-notexec"), []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(configDirectory, "config.yaml")
+	if err := os.WriteFile(config, []byte("plugins:\n  detectors:\n    - name: values-keys\n      command: ./inhouse\n      timeout: 30s\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	detectors, errs := Find(context.Background(), config, first+string(os.PathListSeparator)+second)
+	var names []string
+	for _, detector := range detectors {
+		names = append(names, detector.Name()+"/"+string(detector.Confidence()))
+	}
+	if want := []string{"values-keys/medium", "operator/medium"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("detectors = %v, want %v", names, want)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "heft-detector-broken") {
+		t.Errorf("errors = %v, want one for the broken plugin", errs)
+	}
+	if detectors[0].timeout != 30*time.Second {
+		t.Errorf("timeout = %s, want 30s", detectors[0].timeout)
+	}
+}
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Violation is an image breaking a rule.
+type Violation struct {
+	Rule     string   `yaml:"rule" json:"rule"`
+	Severity Severity `yaml:"severity" json:"severity"`
+	Image    string   `yaml:"image" json:"image"`
+	Message  string   `yaml:"message" json:"message"`
+	File     string   `yaml:"file,omitempty" json:"file,omitempty"`
+	Line     int      `yaml:"line,omitempty" json:"line,omitempty"`
+	Column   int      `yaml:"column,omitempty" json:"column,omitempty"`
+	// KeyPath is the values key the image is set by, when known.
+	KeyPath string `yaml:"keyPath,omitempty" json:"keyPath,omitempty"`
+}
+
+// String formats the violation like a compiler diagnostic, so CI systems
+// can link it to the offending file. The key path, if known, follows the
+// image.
+func (v Violation) String() string {
+	location := ""
+	if v.File != "" {
+		location = v.File + ": "
+		switch {
+		case v.Line > 0 && v.Column > 0:
+			location = fmt.Sprintf("%s:%d:%d: ", v.File, v.Line, v.Column)
+		case v.Line > 0:
+			location = fmt.Sprintf("%s:%d: ", v.File, v.Line)
+		}
+	}
+	if v.Image == "" {
+		return fmt.Sprintf("%s%s: %s: %s", location, v.Severity, v.Rule, v.Message)
+	}
+	image := v.Image
+	if v.KeyPath != "" {
+		image = fmt.Sprintf("%s (%s)", v.Image, v.KeyPath)
+	}
+	return fmt.Sprintf("%s%s: %s: %s: %s", location, v.Severity, v.Rule, image, v.Message)
+}
+
+// Evaluate checks every image against every rule and returns the
+// violations ordered by file, line, image and rule. Images whose names
+// cannot be parsed violate an implicit "invalid-reference" error rule.
+func (p *Policy) Evaluate(images []scan.ImageFinding) []Violation {
+	var violations []Violation
+	for _, image := range images {
+		reference, err := registry.ParseReference(image.Name)
+		if err != nil {
+			violations = append(violations, newViolation("invalid-reference", SeverityError, image, err.Error()))
+			continue
+		}
+		s := subject{finding: image, reference: reference, tag: reference.Tag}
+		if s.tag == "" && reference.Digest == "" {
+			s.tag = registry.DefaultTag
+		}
+
+		for _, rule := range p.Rules {
+			if message, violated := rule.check(s); violated {
+				if rule.Message != "" {
+					message = rule.Message
+				}
+				violations = append(violations, newViolation(rule.Name, rule.Severity, image, message))
+			}
+		}
+	}
+
+	sortViolations(violations)
+	return violations
+}
+
+// Check evaluates result against the policy's rules and its Rego modules.
+func (p *Policy) Check(ctx context.Context, result *scan.ScanResult) ([]Violation, error) {
+	violations := p.Evaluate(result.Images)
+	if p.rego != nil {
+		regoViolations, err := p.rego.Evaluate(ctx, result)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, regoViolations...)
+		sortViolations(violations)
+	}
+	return violations, nil
+}
+
+func sortViolations(violations []Violation) {
+	sort.SliceStable(violations, func(i, j int) bool {
+		a, b := violations[i], violations[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		if a.Image != b.Image {
+			return a.Image < b.Image
+		}
+		return a.Rule < b.Rule
+	})
+}
+
+func (r Rule) check(s subject) (string, bool) {
+	if !r.When.matches(s) {
+		return "", false
+	}
+	if r.Allow != nil && !r.Allow.matches(s) {
+		return fmt.Sprintf("%s is not allowed", r.Allow.describe(s)), true
+	}
+	if r.Deny != nil && r.Deny.matches(s) {
+		return fmt.Sprintf("%s is denied", r.Deny.describe(s)), true
+	}
+	if r.RequireDigest && s.reference.Digest == "" {
+		return "image is not pinned by digest", true
+	}
+	return "", false
+}
+
+func newViolation(rule string, severity Severity, image scan.ImageFinding, message string) Violation {
+	return Violation{
+		Rule:     rule,
+		Severity: severity,
+		Image:    image.Name,
+		Message:  message,
+		File:     image.File,
+		Line:     image.Line,
+		Column:   image.Column,
+		KeyPath:  image.KeyPath,
+	}
+}
+
+// Failing returns how many violations are at or above threshold.
+func Failing(violations []Violation, threshold Severity) int {
+	count := 0
+	for _, violation := range violations {
+		if violation.Severity.AtLeast(threshold) {
+			count++
+		}
+	}
+	return count
+}
+
+// Report writes one line per violation to w and returns an error if any
+// violation reaches threshold.
+func Report(w io.Writer, violations []Violation, threshold Severity) error {
+	for _, violation := range violations {
+		fmt.Fprintln(w, violation)
+	}
+	if failing := Failing(violations, threshold); failing > 0 {
+		return fmt.Errorf("policy check failed: %d violation(s) at or above %s", failing, threshold)
+	}
+	return nil
+}
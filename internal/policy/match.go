@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// subject is an image finding with its parsed reference.
+type subject struct {
+	finding   scan.ImageFinding
+	reference registry.Reference
+	tag       string
+}
+
+func (m *Match) compile() error {
+	for _, pattern := range m.Registries {
+		m.registries = append(m.registries, globPattern(pattern))
+	}
+	for _, pattern := range m.Repositories {
+		m.repositories = append(m.repositories, globPattern(pattern))
+	}
+	for _, pattern := range m.Tags {
+		compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("tag pattern %q: %w", pattern, err)
+		}
+		m.tags = append(m.tags, compiled)
+	}
+	for _, confidence := range m.Confidence {
+		switch confidence {
+		case scan.ConfidenceHigh, scan.ConfidenceMedium, scan.ConfidenceLow:
+		default:
+			return fmt.Errorf("invalid confidence %q", confidence)
+		}
+	}
+	return nil
+}
+
+// matches reports whether s satisfies every field set on m. A nil Match
+// matches everything.
+func (m *Match) matches(s subject) bool {
+	if m == nil {
+		return true
+	}
+	if len(m.registries) > 0 && !anyMatch(m.registries, s.reference.Registry) {
+		return false
+	}
+	if len(m.repositories) > 0 && !anyMatch(m.repositories, s.reference.Name()) {
+		return false
+	}
+	if len(m.tags) > 0 && !anyMatch(m.tags, s.tag) {
+		return false
+	}
+	if len(m.Confidence) > 0 && !slices.Contains(m.Confidence, s.finding.Confidence) {
+		return false
+	}
+	return true
+}
+
+// describe explains which fields of m s matched, for violation messages.
+func (m *Match) describe(s subject) string {
+	var parts []string
+	if len(m.registries) > 0 {
+		parts = append(parts, fmt.Sprintf("registry %q", s.reference.Registry))
+	}
+	if len(m.repositories) > 0 {
+		parts = append(parts, fmt.Sprintf("repository %q", s.reference.Name()))
+	}
+	if len(m.tags) > 0 {
+		parts = append(parts, fmt.Sprintf("tag %q", s.tag))
+	}
+	if len(m.Confidence) > 0 {
+		parts = append(parts, fmt.Sprintf("confidence %q", s.finding.Confidence))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func anyMatch(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// globPattern converts a glob where "*" matches within a path segment and
+// "**" matches across segments into an anchored regular expression.
+func globPattern(glob string) *regexp.Regexp {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			builder.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			builder.WriteString("[^/]*")
+		case glob[i] == '?':
+			builder.WriteString("[^/]")
+		default:
+			builder.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	builder.WriteString("$")
+	return regexp.MustCompile(builder.String())
+}
@@ -0,0 +1,191 @@
+// Package policy evaluates scanned images against the rules in a policy
+// file, such as approved registries or a ban on the latest tag.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+// DefaultFile is the policy file used when none is given.
+const DefaultFile = ".heft-policy.yaml"
+
+// Severity ranks violations. The zero value is SeverityError.
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+	// SeverityNone as a fail-on threshold never fails.
+	SeverityNone Severity = "none"
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityError, "":
+		return 3
+	default:
+		return 4
+	}
+}
+
+// AtLeast reports whether s is as severe as threshold. Nothing reaches
+// SeverityNone.
+func (s Severity) AtLeast(threshold Severity) bool {
+	if threshold == SeverityNone {
+		return false
+	}
+	return s.rank() >= threshold.rank()
+}
+
+// ParseSeverity validates a severity or fail-on threshold.
+func ParseSeverity(value string) (Severity, error) {
+	switch severity := Severity(value); severity {
+	case SeverityInfo, SeverityWarning, SeverityError, SeverityNone:
+		return severity, nil
+	default:
+		return "", fmt.Errorf("invalid severity %q (want info, warning, error or none)", value)
+	}
+}
+
+// Policy is the content of a policy file.
+type Policy struct {
+	// FailOn is the lowest severity that fails a check; defaults to error.
+	FailOn Severity `yaml:"failOn"`
+	Rules  []Rule   `yaml:"rules"`
+	// Rego lists .rego files or directories, relative to the policy file,
+	// evaluated in addition to Rules.
+	Rego []string `yaml:"rego"`
+
+	rego *Rego
+}
+
+// Rule is a single policy rule. An image in scope (When) violates the rule
+// if it does not match Allow, matches Deny, or lacks a digest while
+// RequireDigest is set.
+type Rule struct {
+	Name     string   `yaml:"name"`
+	Severity Severity `yaml:"severity"`
+	// Message replaces the generated violation message.
+	Message       string `yaml:"message"`
+	When          *Match `yaml:"when"`
+	Allow         *Match `yaml:"allow"`
+	Deny          *Match `yaml:"deny"`
+	RequireDigest bool   `yaml:"requireDigest"`
+}
+
+// Match selects images. Every field that is set must match; within a field
+// any entry may match.
+type Match struct {
+	// Registries are globs matched against the registry host, e.g.
+	// "*.internal" or "docker.io".
+	Registries []string `yaml:"registries"`
+	// Repositories are globs matched against the fully qualified
+	// repository, e.g. "docker.io/bitnami/*". "*" stays within one path
+	// segment and "**" spans segments.
+	Repositories []string `yaml:"repositories"`
+	// Tags are regular expressions that must match the whole tag. Untagged
+	// images are matched as "latest".
+	Tags []string `yaml:"tags"`
+	// Confidence lists finding confidences, e.g. [low].
+	Confidence []scan.Confidence `yaml:"confidence"`
+
+	registries   []*regexp.Regexp
+	repositories []*regexp.Regexp
+	tags         []*regexp.Regexp
+}
+
+// Load reads and validates the policy file at path.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	policy, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	for i, regoPath := range policy.Rego {
+		if !filepath.IsAbs(regoPath) {
+			policy.Rego[i] = filepath.Join(filepath.Dir(path), regoPath)
+		}
+	}
+	if len(policy.Rego) > 0 {
+		if policy.rego, err = LoadRego(context.Background(), policy.Rego); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", path, err)
+		}
+	}
+	return policy, nil
+}
+
+// AddRego adds Rego modules at paths to the policy.
+func (p *Policy) AddRego(ctx context.Context, paths []string) error {
+	evaluator, err := LoadRego(ctx, append(append([]string(nil), p.Rego...), paths...))
+	if err != nil {
+		return err
+	}
+	p.Rego = append(p.Rego, paths...)
+	p.rego = evaluator
+	return nil
+}
+
+// Parse decodes and validates a policy document.
+func Parse(data []byte) (*Policy, error) {
+	var policy Policy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	if policy.FailOn == "" {
+		policy.FailOn = SeverityError
+	}
+	if _, err := ParseSeverity(string(policy.FailOn)); err != nil {
+		return nil, fmt.Errorf("failOn: %w", err)
+	}
+
+	names := map[string]bool{}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Severity == "" {
+			rule.Severity = SeverityError
+		}
+		if severity, err := ParseSeverity(string(rule.Severity)); err != nil || severity == SeverityNone {
+			return nil, fmt.Errorf("rule %q: invalid severity %q", rule.Name, rule.Severity)
+		}
+		if rule.Allow == nil && rule.Deny == nil && !rule.RequireDigest {
+			return nil, fmt.Errorf("rule %q needs allow, deny or requireDigest", rule.Name)
+		}
+		for _, match := range []*Match{rule.When, rule.Allow, rule.Deny} {
+			if match == nil {
+				continue
+			}
+			if err := match.compile(); err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+		}
+	}
+	return &policy, nil
+}
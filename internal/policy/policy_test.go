@@ -0,0 +1,102 @@
+package policy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+const testPolicy = `
+failOn: warning
+rules:
+  - name: approved-registries
+    allow:
+      registries: [ghcr.io, "*.internal"]
+  - name: no-latest
+    severity: warning
+    deny:
+      tags: [latest]
+  - name: deprecated
+    deny:
+      repositories: ["ghcr.io/legacy/**"]
+    message: legacy images are deprecated, use ghcr.io/org instead
+  - name: pin-high-confidence
+    severity: info
+    when:
+      confidence: [high]
+    requireDigest: true
+`
+
+func TestEvaluateReportsViolations(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	images := []scan.ImageFinding{
+		{Name: "ghcr.io/org/app:v1", Confidence: scan.ConfidenceHigh, File: "values.yaml", Line: 3},
+		{Name: "ghcr.io/org/app@sha256:" + strings.Repeat("a", 64), Confidence: scan.ConfidenceHigh},
+		{Name: "nginx", Confidence: scan.ConfidenceMedium, File: "values.yaml", Line: 10, Column: 3, KeyPath: "proxy.image"},
+		{Name: "ghcr.io/legacy/tools/kubectl:1.20", Confidence: scan.ConfidenceLow},
+		{Name: "registry.internal/app:latest", Confidence: scan.ConfidenceLow},
+	}
+
+	var got []string
+	for _, violation := range policy.Evaluate(images) {
+		got = append(got, violation.String())
+	}
+	want := []string{
+		"error: deprecated: ghcr.io/legacy/tools/kubectl:1.20: legacy images are deprecated, use ghcr.io/org instead",
+		"warning: no-latest: registry.internal/app:latest: tag \"latest\" is denied",
+		"values.yaml:3: info: pin-high-confidence: ghcr.io/org/app:v1: image is not pinned by digest",
+		"values.yaml:10:3: error: approved-registries: nginx (proxy.image): registry \"docker.io\" is not allowed",
+		"values.yaml:10:3: warning: no-latest: nginx (proxy.image): tag \"latest\" is denied",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var output bytes.Buffer
+	err = Report(&output, policy.Evaluate(images), policy.FailOn)
+	if err == nil || !strings.Contains(err.Error(), "4 violation(s) at or above warning") {
+		t.Fatalf("expected failing report, got %v", err)
+	}
+	if err := Report(&output, policy.Evaluate(images), SeverityNone); err != nil {
+		t.Fatalf("expected fail-on none to pass, got %v", err)
+	}
+}
+
+func TestParseRejectsInvalidPolicies(t *testing.T) {
+	for name, document := range map[string]string{
+		"unknown field":  "rules:\n  - name: a\n    deny: {tag: [x]}\n",
+		"no condition":   "rules:\n  - name: a\n",
+		"bad severity":   "rules:\n  - name: a\n    severity: fatal\n    requireDigest: true\n",
+		"bad regexp":     "rules:\n  - name: a\n    deny: {tags: ['(']}\n",
+		"duplicate rule": "rules:\n  - {name: a, requireDigest: true}\n  - {name: a, requireDigest: true}\n",
+		"bad failOn":     "failOn: sometimes\n",
+	} {
+		if _, err := Parse([]byte(document)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestGlobPattern(t *testing.T) {
+	cases := []struct {
+		glob, value string
+		want        bool
+	}{
+		{"docker.io/bitnami/*", "docker.io/bitnami/redis", true},
+		{"docker.io/bitnami/*", "docker.io/bitnami/sub/redis", false},
+		{"docker.io/**", "docker.io/bitnami/sub/redis", true},
+		{"*.internal", "registry.internal", true},
+		{"*.internal", "registry.internal.example.com", false},
+	}
+	for _, c := range cases {
+		if got := globPattern(c.glob).MatchString(c.value); got != c.want {
+			t.Errorf("glob %q on %q = %v, want %v", c.glob, c.value, got, c.want)
+		}
+	}
+}
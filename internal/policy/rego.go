@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+// regoRules maps the rule names heft queries in each Rego package to the
+// severity of their results. violation is the rule Gatekeeper templates use.
+var regoRules = map[string]Severity{
+	"deny":      SeverityError,
+	"violation": SeverityError,
+	"warn":      SeverityWarning,
+}
+
+// Rego evaluates Rego modules against scan results, embedded in heft. Each
+// package's deny, violation and warn rules are queried with the scan
+// result as input.
+type Rego struct {
+	queries []regoQuery
+}
+
+type regoQuery struct {
+	rule     string
+	severity Severity
+	prepared rego.PreparedEvalQuery
+}
+
+// LoadRego parses the .rego files at paths, which may be files or
+// directories searched recursively; _test.rego files are skipped. Modules
+// are parsed as Rego v1 and, failing that, as v0, so policies written for
+// older OPA and Gatekeeper releases keep working.
+func LoadRego(ctx context.Context, paths []string) (*Rego, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(file, ".rego") && !strings.HasSuffix(file, "_test.rego") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read rego: %w", err)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .rego files found in %s", strings.Join(paths, ", "))
+	}
+
+	var options []func(*rego.Rego)
+	packages := map[string]bool{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read rego: %w", err)
+		}
+		module, err := ast.ParseModuleWithOpts(file, string(data), ast.ParserOptions{RegoVersion: ast.RegoV1})
+		if err != nil {
+			var v0Err error
+			if module, v0Err = ast.ParseModuleWithOpts(file, string(data), ast.ParserOptions{RegoVersion: ast.RegoV0}); v0Err != nil {
+				return nil, fmt.Errorf("parse rego: %w", err)
+			}
+		}
+		options = append(options, rego.ParsedModule(module))
+		packages[module.Package.Path.String()] = true
+	}
+
+	var packageNames []string
+	for name := range packages {
+		packageNames = append(packageNames, name)
+	}
+	sort.Strings(packageNames)
+
+	evaluator := &Rego{}
+	for _, packageName := range packageNames {
+		for rule, severity := range regoRules {
+			query := packageName + "." + rule
+			prepared, err := rego.New(append([]func(*rego.Rego){rego.Query(query)}, options...)...).PrepareForEval(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("compile rego: %w", err)
+			}
+			evaluator.queries = append(evaluator.queries, regoQuery{
+				rule:     strings.TrimPrefix(query, "data."),
+				severity: severity,
+				prepared: prepared,
+			})
+		}
+	}
+	sort.Slice(evaluator.queries, func(i, j int) bool { return evaluator.queries[i].rule < evaluator.queries[j].rule })
+	return evaluator, nil
+}
+
+// Evaluate runs every query with result as input and returns a violation
+// per message. Messages are strings or objects with a "msg" field and,
+// optionally, the "image" they are about, which links the violation to the
+// image's file and line.
+func (r *Rego) Evaluate(ctx context.Context, result *scan.ScanResult) ([]Violation, error) {
+	input, err := regoInput(result)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := map[string]scan.ImageFinding{}
+	for _, image := range result.Images {
+		findings[image.Name] = image
+	}
+
+	var violations []Violation
+	for _, query := range r.queries {
+		results, err := query.prepared.Eval(ctx, rego.EvalInput(input))
+		if err != nil {
+			return nil, fmt.Errorf("evaluate %s: %w", query.rule, err)
+		}
+		for _, result := range results {
+			for _, expression := range result.Expressions {
+				values, ok := expression.Value.([]any)
+				if !ok {
+					return nil, fmt.Errorf("evaluate %s: expected a set of messages, got %T", query.rule, expression.Value)
+				}
+				for _, value := range values {
+					violation := Violation{Rule: query.rule, Severity: query.severity}
+					switch message := value.(type) {
+					case string:
+						violation.Message = message
+					case map[string]any:
+						violation.Message, _ = message["msg"].(string)
+						violation.Image, _ = message["image"].(string)
+					default:
+						violation.Message = fmt.Sprint(message)
+					}
+					if finding, ok := findings[violation.Image]; ok {
+						violation.File, violation.Line, violation.Column = finding.File, finding.Line, finding.Column
+						violation.KeyPath = finding.KeyPath
+					}
+					violations = append(violations, violation)
+				}
+			}
+		}
+	}
+	sortViolations(violations)
+	return violations, nil
+}
+
+// regoInput converts result to the plain JSON structure Rego sees as
+// input, using the same field names as heft's JSON output.
+func regoInput(result *scan.ScanResult) (map[string]any, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("encode rego input: %w", err)
+	}
+	var input map[string]any
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("encode rego input: %w", err)
+	}
+	return input, nil
+}
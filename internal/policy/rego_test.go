@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/scan"
+)
+
+const regoV1Module = `package heft.images
+
+deny contains {"msg": msg, "image": image.name} if {
+	some image in input.images
+	image.confidence == "high"
+	not contains(image.name, "@sha256:")
+	msg := sprintf("%s/%s must pin %s by digest", [image.resource.kind, image.resource.name, image.name])
+}
+
+warn contains msg if {
+	input.chart.appVersion == "0.0.0"
+	msg := "chart has no real appVersion"
+}
+`
+
+// A Gatekeeper-style module written for OPA 0.x.
+const regoV0Module = `package k8sallowedrepos
+
+violation[{"msg": msg}] {
+	image := input.images[_]
+	startswith(image.name, "docker.io/")
+	msg := sprintf("%v is pulled from Docker Hub", [image.name])
+}
+`
+
+func TestRegoDenyAndWarnBecomeViolations(t *testing.T) {
+	directory := t.TempDir()
+	for name, content := range map[string]string{
+		"images.rego":      regoV1Module,
+		"gatekeeper.rego":  regoV0Module,
+		"images_test.rego": "package heft.images\n\ntest_broken if { false }\n",
+	} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	policyFile := filepath.Join(directory, DefaultFile)
+	if err := os.WriteFile(policyFile, []byte("rego: [.]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(policyFile)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	result := &scan.ScanResult{
+		Images: []scan.ImageFinding{
+			{Name: "ghcr.io/org/app:v1", Confidence: scan.ConfidenceHigh, Source: scan.SourceRendered, File: "values.yaml", Line: 2,
+				Resource: &scan.Resource{Kind: "Deployment", Name: "app", Container: "app"}},
+			{Name: "docker.io/library/redis:7", Confidence: scan.ConfidenceMedium},
+		},
+		Chart: &scan.ChartMetadata{Name: "demo", Version: "0.1.0", AppVersion: "0.0.0"},
+	}
+	violations, err := loaded.Check(context.Background(), result)
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+
+	var got []string
+	for _, violation := range violations {
+		got = append(got, violation.String())
+	}
+	want := []string{
+		"warning: heft.images.warn: chart has no real appVersion",
+		"error: k8sallowedrepos.violation: docker.io/library/redis:7 is pulled from Docker Hub",
+		"values.yaml:2: error: heft.images.deny: ghcr.io/org/app:v1: Deployment/app must pin ghcr.io/org/app:v1 by digest",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLoadRegoReportsSyntaxErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "broken.rego")
+	if err := os.WriteFile(file, []byte("package broken\n\ndeny contains msg if {\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRego(context.Background(), []string{file}); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
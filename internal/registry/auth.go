@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Credential is a username/password pair for a registry. An identity token
+// is sent as the password with an empty username, as the Docker CLI does.
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Keychain looks up credentials for a registry host.
+type Keychain interface {
+	Credential(ctx context.Context, registry string) (Credential, error)
+}
+
+// DockerConfig is the subset of the Docker CLI config.json used for
+// registry authentication.
+type DockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore"`
+	CredHelpers map[string]string     `json:"credHelpers"`
+}
+
+type dockerAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// credentialHelperCommand is a variable to allow tests to stub invocations
+// of docker-credential-* helpers.
+var credentialHelperCommand = func(ctx context.Context, helper string) *exec.Cmd {
+	return exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+}
+
+// LoadDockerConfig reads the Docker CLI config from $DOCKER_CONFIG or
+// ~/.docker. A missing config file yields an empty config.
+func LoadDockerConfig() (*DockerConfig, error) {
+	directory := os.Getenv("DOCKER_CONFIG")
+	if directory == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return &DockerConfig{}, nil
+		}
+		directory = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(directory, "config.json"))
+	if os.IsNotExist(err) {
+		return &DockerConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read docker config: %w", err)
+	}
+
+	var config DockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse docker config: %w", err)
+	}
+	return &config, nil
+}
+
+// Credential implements Keychain. Credential helpers take precedence over
+// inline auths, and unknown registries yield an empty (anonymous)
+// credential.
+func (c *DockerConfig) Credential(ctx context.Context, registry string) (Credential, error) {
+	keys := configKeys(registry)
+
+	for _, key := range keys {
+		if helper, ok := c.CredHelpers[key]; ok && helper != "" {
+			return helperCredential(ctx, helper, key)
+		}
+	}
+
+	for _, key := range keys {
+		auth, ok := c.Auths[key]
+		if !ok {
+			continue
+		}
+		if auth.IdentityToken != "" {
+			return Credential{Password: auth.IdentityToken}, nil
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credential{}, fmt.Errorf("decode docker auth for %s: %w", key, err)
+			}
+			username, password, _ := strings.Cut(string(decoded), ":")
+			return Credential{Username: username, Password: password}, nil
+		}
+		if auth.Username != "" {
+			return Credential{Username: auth.Username, Password: auth.Password}, nil
+		}
+	}
+
+	if c.CredsStore != "" {
+		return helperCredential(ctx, c.CredsStore, keys[0])
+	}
+	return Credential{}, nil
+}
+
+// configKeys lists the keys under which the Docker CLI may have stored
+// credentials for registry, most specific first.
+func configKeys(registry string) []string {
+	if registry == DefaultRegistry {
+		return []string{"https://index.docker.io/v1/", "index.docker.io", "docker.io", "registry-1.docker.io"}
+	}
+	return []string{registry, "https://" + registry, "http://" + registry}
+}
+
+func helperCredential(ctx context.Context, helper, serverURL string) (Credential, error) {
+	command := credentialHelperCommand(ctx, helper)
+	command.Stdin = strings.NewReader(serverURL)
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		// Helpers report unknown servers as an error; treat that as
+		// anonymous access rather than failing the request.
+		if strings.Contains(stdout.String()+stderr.String(), "credentials not found") {
+			return Credential{}, nil
+		}
+		return Credential{}, fmt.Errorf("docker-credential-%s: %w: %s", helper, err, stderr.String())
+	}
+
+	var response struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return Credential{}, fmt.Errorf("parse docker-credential-%s output: %w", helper, err)
+	}
+	if response.Username == "<token>" {
+		return Credential{Password: response.Secret}, nil
+	}
+	return Credential{Username: response.Username, Password: response.Secret}, nil
+}
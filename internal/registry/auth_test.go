@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDockerConfigMissingFile(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	config, err := LoadDockerConfig()
+	if err != nil {
+		t.Fatalf("LoadDockerConfig error: %v", err)
+	}
+	credential, err := config.Credential(context.Background(), "ghcr.io")
+	if err != nil {
+		t.Fatalf("Credential error: %v", err)
+	}
+	if credential != (Credential{}) {
+		t.Fatalf("expected anonymous credential, got %+v", credential)
+	}
+}
+
+func TestDockerConfigCredentialFromAuths(t *testing.T) {
+	directory := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", directory)
+	config := `{"auths": {
+  "ghcr.io": {"auth": "dXNlcjpzZWNyZXQ="},
+  "https://index.docker.io/v1/": {"username": "hub", "password": "pw"},
+  "quay.io": {"identitytoken": "refresh"}
+}}`
+	if err := os.WriteFile(filepath.Join(directory, "config.json"), []byte(config), 0o600); err != nil {
+		t.Fatalf("WriteFile config.json: %v", err)
+	}
+
+	loaded, err := LoadDockerConfig()
+	if err != nil {
+		t.Fatalf("LoadDockerConfig error: %v", err)
+	}
+
+	cases := map[string]Credential{
+		"ghcr.io":   {Username: "user", Password: "secret"},
+		"docker.io": {Username: "hub", Password: "pw"},
+		"quay.io":   {Password: "refresh"},
+	}
+	for registry, want := range cases {
+		got, err := loaded.Credential(context.Background(), registry)
+		if err != nil {
+			t.Fatalf("Credential(%s) error: %v", registry, err)
+		}
+		if got != want {
+			t.Fatalf("Credential(%s) = %+v, want %+v", registry, got, want)
+		}
+	}
+}
+
+func TestDockerConfigCredentialHelper(t *testing.T) {
+	old := credentialHelperCommand
+	defer func() { credentialHelperCommand = old }()
+
+	var gotHelper string
+	credentialHelperCommand = func(ctx context.Context, helper string) *exec.Cmd {
+		gotHelper = helper
+		return exec.Command("sh", "-c", `cat >/dev/null; echo '{"Username":"robot","Secret":"s3cret"}'`)
+	}
+
+	config := &DockerConfig{CredHelpers: map[string]string{"registry.internal": "corp"}}
+	credential, err := config.Credential(context.Background(), "registry.internal")
+	if err != nil {
+		t.Fatalf("Credential error: %v", err)
+	}
+	if gotHelper != "corp" {
+		t.Fatalf("expected corp helper, got %q", gotHelper)
+	}
+	if credential.Username != "robot" || credential.Password != "s3cret" {
+		t.Fatalf("unexpected credential: %+v", credential)
+	}
+}
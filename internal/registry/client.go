@@ -0,0 +1,379 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Media types for manifests understood by the client.
+const (
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+var manifestAccept = strings.Join([]string{
+	MediaTypeOCIIndex,
+	MediaTypeOCIManifest,
+	MediaTypeDockerManifestList,
+	MediaTypeDockerManifest,
+}, ", ")
+
+// Client talks to registries implementing the OCI distribution API.
+// The zero value is an anonymous client using http.DefaultClient.
+type Client struct {
+	// HTTPClient performs requests. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Keychain supplies credentials. A nil Keychain means anonymous access.
+	Keychain Keychain
+	// PlainHTTP forces plain HTTP for every registry. Loopback registries
+	// (localhost, 127.0.0.1, ::1) always use plain HTTP.
+	PlainHTTP bool
+
+	mutex  sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns a client authenticating with the Docker CLI config.
+// An unreadable Docker config is reported but falls back to anonymous
+// access so public images still resolve.
+func NewClient() (*Client, error) {
+	client := &Client{HTTPClient: http.DefaultClient}
+	config, err := LoadDockerConfig()
+	if err != nil {
+		return client, err
+	}
+	client.Keychain = config
+	return client, nil
+}
+
+// ResolveDigest returns the manifest digest the registry serves for
+// reference. References that already carry a digest are returned as is.
+func (c *Client) ResolveDigest(ctx context.Context, reference Reference) (string, error) {
+	if reference.Digest != "" {
+		return reference.Digest, nil
+	}
+
+	response, err := c.do(ctx, reference, http.MethodHead, "/manifests/"+reference.Identifier(), nil, map[string]string{"Accept": manifestAccept})
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	if digest := response.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Some registries omit the digest header on HEAD; fall back to hashing
+	// the manifest body as served.
+	_, digest, _, err := c.GetManifest(ctx, reference)
+	return digest, err
+}
+
+// GetManifest fetches the manifest for reference and returns its raw bytes,
+// digest and media type.
+func (c *Client) GetManifest(ctx context.Context, reference Reference) (data []byte, digest, mediaType string, err error) {
+	response, err := c.do(ctx, reference, http.MethodGet, "/manifests/"+reference.Identifier(), nil, map[string]string{"Accept": manifestAccept})
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer response.Body.Close()
+
+	data, err = io.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("read manifest %s: %w", reference, err)
+	}
+
+	digest = response.Header.Get("Docker-Content-Digest")
+	if digest == "" || reference.Digest != "" {
+		digest = Digest(data)
+	}
+	if reference.Digest != "" && digest != reference.Digest {
+		return nil, "", "", fmt.Errorf("manifest %s: digest mismatch, got %s", reference, digest)
+	}
+
+	mediaType = response.Header.Get("Content-Type")
+	if mediaType == "" || mediaType == "application/json" {
+		var probe struct {
+			MediaType string `json:"mediaType"`
+		}
+		if json.Unmarshal(data, &probe) == nil && probe.MediaType != "" {
+			mediaType = probe.MediaType
+		}
+	}
+	return data, digest, mediaType, nil
+}
+
+// Digest returns the sha256 content digest of data.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// StatusError is returned for registry responses with an unexpected status.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s %s: unexpected status %d", e.Method, e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("%s %s: unexpected status %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// IsNotFound reports whether err is a registry 404 response.
+func IsNotFound(err error) bool {
+	var statusError *StatusError
+	return errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound
+}
+
+// do sends a request to the repository of reference, authenticating on a
+// 401 challenge and retrying once. body is called for each attempt and
+// may be nil. Non-2xx responses are returned as *StatusError.
+func (c *Client) do(ctx context.Context, reference Reference, method, path string, body func() io.Reader, headers map[string]string) (*http.Response, error) {
+	target := c.baseURL(reference.Registry) + "/v2/" + reference.Repository + path
+	return c.doURL(ctx, reference, method, target, body, headers)
+}
+
+func (c *Client) doURL(ctx context.Context, reference Reference, method, target string, body func() io.Reader, headers map[string]string) (*http.Response, error) {
+	scopeKey := reference.Registry + "/" + reference.Repository + ":" + scopeActions(method)
+
+	send := func() (*http.Response, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = body()
+		}
+		request, err := http.NewRequestWithContext(ctx, method, target, reader)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range headers {
+			if key == "Content-Length" {
+				request.ContentLength, _ = strconv.ParseInt(value, 10, 64)
+				continue
+			}
+			request.Header.Set(key, value)
+		}
+		c.mutex.Lock()
+		authorization := c.tokens[scopeKey]
+		c.mutex.Unlock()
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		return c.httpClient().Do(request)
+	}
+
+	response, err := send()
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+
+		authorization, err := c.authorize(ctx, reference, method, challenge)
+		if err != nil {
+			return nil, err
+		}
+		c.mutex.Lock()
+		if c.tokens == nil {
+			c.tokens = map[string]string{}
+		}
+		c.tokens[scopeKey] = authorization
+		c.mutex.Unlock()
+
+		response, err = send()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return nil, &StatusError{Method: method, URL: target, StatusCode: response.StatusCode, Body: strings.TrimSpace(string(message))}
+	}
+	return response, nil
+}
+
+// authorize answers a WWW-Authenticate challenge with either basic
+// credentials or a bearer token fetched from the challenge realm.
+func (c *Client) authorize(ctx context.Context, reference Reference, method, challenge string) (string, error) {
+	scheme, parameters := parseChallenge(challenge)
+
+	var credential Credential
+	if c.Keychain != nil {
+		var err error
+		credential, err = c.Keychain.Credential(ctx, reference.Registry)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	switch scheme {
+	case "basic":
+		if credential.Username == "" && credential.Password == "" {
+			return "", fmt.Errorf("registry %s requires credentials", reference.Registry)
+		}
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.SetBasicAuth(credential.Username, credential.Password)
+		return request.Header.Get("Authorization"), nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, reference, method, parameters, credential)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("registry %s: unsupported auth challenge %q", reference.Registry, challenge)
+	}
+}
+
+func (c *Client) fetchToken(ctx context.Context, reference Reference, method string, parameters map[string]string, credential Credential) (string, error) {
+	realm := parameters["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry %s: bearer challenge without realm", reference.Registry)
+	}
+	scope := parameters["scope"]
+	if scope == "" {
+		scope = "repository:" + reference.Repository + ":" + scopeActions(method)
+	}
+
+	var request *http.Request
+	var err error
+	if credential.Username == "" && credential.Password != "" {
+		// Identity tokens are exchanged through the OAuth2 refresh flow.
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {credential.Password},
+			"service":       {parameters["service"]},
+			"scope":         {scope},
+			"client_id":     {"heft"},
+		}
+		request, err = http.NewRequestWithContext(ctx, http.MethodPost, realm, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{"scope": {scope}}
+		if service := parameters["service"]; service != "" {
+			query.Set("service", service)
+		}
+		request, err = http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		if credential.Username != "" {
+			request.SetBasicAuth(credential.Username, credential.Password)
+		}
+	}
+
+	response, err := c.httpClient().Do(request)
+	if err != nil {
+		return "", fmt.Errorf("fetch registry token: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return "", fmt.Errorf("fetch registry token: unexpected status %d: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("parse registry token: %w", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry token response contained no token")
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth",service="registry"` into its lowercased
+// scheme and parameters.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	parameters := map[string]string{}
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end == -1 {
+				parameters[key] = value[1:]
+				break
+			}
+			parameters[key] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			parameters[key] = strings.TrimSpace(value)
+		}
+	}
+	return strings.ToLower(scheme), parameters
+}
+
+func scopeActions(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return "pull"
+	}
+	return "pull,push"
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// baseURL returns the API endpoint for a registry host.
+func (c *Client) baseURL(registry string) string {
+	host := registry
+	if host == DefaultRegistry {
+		host = "registry-1.docker.io"
+	}
+	if c.PlainHTTP || isLoopback(host) {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+func isLoopback(host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
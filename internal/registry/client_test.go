@@ -0,0 +1,111 @@
+package registry_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/registry/registrytest"
+)
+
+type staticKeychain registry.Credential
+
+func (k staticKeychain) Credential(context.Context, string) (registry.Credential, error) {
+	return registry.Credential(k), nil
+}
+
+func TestResolveDigestAgainstRegistryStandIn(t *testing.T) {
+	server := registrytest.New(t)
+	digest := server.AddImage("org/app", "v1", []byte(`{"os":"linux","architecture":"amd64"}`))
+
+	reference, err := registry.ParseReference(server.Host() + "/org/app:v1")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+
+	client := &registry.Client{}
+	got, err := client.ResolveDigest(context.Background(), reference)
+	if err != nil {
+		t.Fatalf("ResolveDigest error: %v", err)
+	}
+	if got != digest {
+		t.Fatalf("ResolveDigest = %q, want %q", got, digest)
+	}
+
+	reference.Tag = "missing"
+	if _, err := client.ResolveDigest(context.Background(), reference); !registry.IsNotFound(err) {
+		t.Fatalf("expected not found error for missing tag, got %v", err)
+	}
+}
+
+func TestResolveDigestWithBearerToken(t *testing.T) {
+	server := registrytest.New(t)
+	server.Token = "t0ken"
+	server.Username = "robot"
+	server.Password = "s3cret"
+	digest := server.AddImage("org/private", "v2", []byte(`{}`))
+
+	reference, err := registry.ParseReference(server.Host() + "/org/private:v2")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+
+	anonymous := &registry.Client{}
+	if _, err := anonymous.ResolveDigest(context.Background(), reference); err == nil {
+		t.Fatalf("expected anonymous resolve to fail")
+	}
+
+	client := &registry.Client{Keychain: staticKeychain{Username: "robot", Password: "s3cret"}}
+	got, err := client.ResolveDigest(context.Background(), reference)
+	if err != nil {
+		t.Fatalf("ResolveDigest error: %v", err)
+	}
+	if got != digest {
+		t.Fatalf("ResolveDigest = %q, want %q", got, digest)
+	}
+}
+
+func TestGetManifestVerifiesDigest(t *testing.T) {
+	server := registrytest.New(t)
+	digest := server.AddImage("org/app", "v1", []byte(`{}`))
+
+	reference, err := registry.ParseReference(server.Host() + "/org/app@" + digest)
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+
+	data, gotDigest, mediaType, err := (&registry.Client{}).GetManifest(context.Background(), reference)
+	if err != nil {
+		t.Fatalf("GetManifest error: %v", err)
+	}
+	if gotDigest != digest || registry.Digest(data) != digest {
+		t.Fatalf("unexpected digest %q", gotDigest)
+	}
+	if mediaType != registry.MediaTypeOCIManifest {
+		t.Fatalf("unexpected media type %q", mediaType)
+	}
+}
+
+func TestListTagsFollowsPagination(t *testing.T) {
+	server := registrytest.New(t)
+	server.TagsPageSize = 2
+	for _, tag := range []string{"1.0.0", "1.0.1", "1.1.0"} {
+		server.AddImage("org/app", tag, []byte(`{}`))
+	}
+
+	reference, err := registry.ParseReference(server.Host() + "/org/app:1.0.0")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	client := &registry.Client{}
+	tags, err := client.ListTags(context.Background(), reference)
+	if err != nil {
+		t.Fatalf("ListTags error: %v", err)
+	}
+	if len(tags) != 3 || tags[0] != "1.0.0" || tags[2] != "1.1.0" {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+	if requests := server.Requests(); len(requests) != 2 {
+		t.Fatalf("expected two pages to be requested, got %v", requests)
+	}
+}
@@ -0,0 +1,156 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Descriptor describes content stored in a registry.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Platform     *Platform         `json:"platform,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest or Docker v2 schema 2 manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Index is an OCI image index or Docker manifest list.
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// IsIndex reports whether mediaType is a multi-platform index type.
+func IsIndex(mediaType string) bool {
+	return mediaType == MediaTypeOCIIndex || mediaType == MediaTypeDockerManifestList
+}
+
+// Platform identifies the operating system and CPU an image runs on.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	OSVersion    string `json:"os.version,omitempty"`
+}
+
+// ParsePlatform parses "os/arch" or "os/arch/variant".
+func ParsePlatform(value string) (Platform, error) {
+	parts := strings.Split(strings.TrimSpace(value), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", value)
+	}
+	platform := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// String returns the platform as "os/arch[/variant]".
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Architecture
+	}
+	return p.OS + "/" + p.Architecture + "/" + p.Variant
+}
+
+// Satisfies reports whether p can serve a request for required. A required
+// platform without a variant accepts any variant; arm64 without a variant
+// is treated as v8.
+func (p Platform) Satisfies(required Platform) bool {
+	if p.OS != required.OS || p.Architecture != required.Architecture {
+		return false
+	}
+	if required.Variant == "" {
+		return true
+	}
+	return normalizedVariant(p) == normalizedVariant(required)
+}
+
+func normalizedVariant(p Platform) string {
+	if p.Architecture == "arm64" && p.Variant == "" {
+		return "v8"
+	}
+	return p.Variant
+}
+
+// Platforms returns the platforms an image supports, read from its index or,
+// for single-platform images, from its config blob. Attestation and other
+// non-runnable entries of an index are skipped.
+func (c *Client) Platforms(ctx context.Context, reference Reference) ([]Platform, error) {
+	data, _, mediaType, err := c.GetManifest(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsIndex(mediaType) {
+		var index Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("parse index %s: %w", reference, err)
+		}
+		var platforms []Platform
+		for _, descriptor := range index.Manifests {
+			if descriptor.Platform == nil || descriptor.Platform.OS == "unknown" {
+				continue
+			}
+			platforms = append(platforms, *descriptor.Platform)
+		}
+		sortPlatforms(platforms)
+		return platforms, nil
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", reference, err)
+	}
+	config, err := c.GetBlob(ctx, reference, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer config.Close()
+
+	var platform Platform
+	if err := json.NewDecoder(config).Decode(&platform); err != nil {
+		return nil, fmt.Errorf("parse image config %s: %w", reference, err)
+	}
+	if platform.OS == "" || platform.Architecture == "" {
+		return nil, fmt.Errorf("image config %s does not declare a platform", reference)
+	}
+	return []Platform{platform}, nil
+}
+
+// GetBlob opens the blob with the given digest in reference's repository.
+// Callers must close the returned reader.
+func (c *Client) GetBlob(ctx context.Context, reference Reference, digest string) (io.ReadCloser, error) {
+	response, err := c.do(ctx, reference, http.MethodGet, "/blobs/"+digest, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func sortPlatforms(platforms []Platform) {
+	sort.SliceStable(platforms, func(i, j int) bool {
+		return platforms[i].String() < platforms[j].String()
+	})
+}
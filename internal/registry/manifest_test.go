@@ -0,0 +1,74 @@
+package registry_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/registry/registrytest"
+)
+
+func TestPlatformsFromIndexAndConfig(t *testing.T) {
+	server := registrytest.New(t)
+	amd64 := server.AddImage("org/app", "", []byte(`{"os":"linux","architecture":"amd64"}`))
+	arm := server.AddImage("org/app", "", []byte(`{"os":"linux","architecture":"arm","variant":"v7"}`))
+	attestation := server.AddImage("org/app", "", []byte(`{}`))
+	server.AddIndex("org/app", "multi", map[string]registry.Platform{
+		amd64:       {OS: "linux", Architecture: "amd64"},
+		arm:         {OS: "linux", Architecture: "arm", Variant: "v7"},
+		attestation: {OS: "unknown", Architecture: "unknown"},
+	})
+	server.AddImage("org/app", "single", []byte(`{"os":"linux","architecture":"arm64"}`))
+
+	client := &registry.Client{}
+
+	reference, _ := registry.ParseReference(server.Host() + "/org/app:multi")
+	platforms, err := client.Platforms(context.Background(), reference)
+	if err != nil {
+		t.Fatalf("Platforms(multi) error: %v", err)
+	}
+	if len(platforms) != 2 || platforms[0].String() != "linux/amd64" || platforms[1].String() != "linux/arm/v7" {
+		t.Fatalf("unexpected platforms for index: %v", platforms)
+	}
+
+	reference.Tag = "single"
+	platforms, err = client.Platforms(context.Background(), reference)
+	if err != nil {
+		t.Fatalf("Platforms(single) error: %v", err)
+	}
+	if len(platforms) != 1 || platforms[0].String() != "linux/arm64" {
+		t.Fatalf("unexpected platforms for single image: %v", platforms)
+	}
+}
+
+func TestPlatformSatisfies(t *testing.T) {
+	cases := []struct {
+		platform string
+		required string
+		want     bool
+	}{
+		{"linux/arm64", "linux/arm64", true},
+		{"linux/arm64/v8", "linux/arm64", true},
+		{"linux/arm64", "linux/arm64/v8", true},
+		{"linux/arm/v6", "linux/arm/v7", false},
+		{"linux/amd64", "linux/arm64", false},
+		{"windows/amd64", "linux/amd64", false},
+	}
+	for _, testCase := range cases {
+		platform, err := registry.ParsePlatform(testCase.platform)
+		if err != nil {
+			t.Fatalf("ParsePlatform(%q): %v", testCase.platform, err)
+		}
+		required, err := registry.ParsePlatform(testCase.required)
+		if err != nil {
+			t.Fatalf("ParsePlatform(%q): %v", testCase.required, err)
+		}
+		if got := platform.Satisfies(required); got != testCase.want {
+			t.Fatalf("%s.Satisfies(%s) = %v, want %v", testCase.platform, testCase.required, got, testCase.want)
+		}
+	}
+
+	if _, err := registry.ParsePlatform("linux"); err == nil {
+		t.Fatalf("expected error for platform without architecture")
+	}
+}
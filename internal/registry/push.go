@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// HeadManifest returns the digest of the manifest reference points at in
+// the registry. Missing manifests are reported with an error satisfying
+// IsNotFound.
+func (c *Client) HeadManifest(ctx context.Context, reference Reference) (string, error) {
+	response, err := c.do(ctx, reference, http.MethodHead, "/manifests/"+reference.Identifier(), nil, map[string]string{"Accept": manifestAccept})
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	return response.Header.Get("Docker-Content-Digest"), nil
+}
+
+// PutManifest uploads a manifest under reference's tag, or under its digest
+// when it has no tag, and returns the digest of data.
+func (c *Client) PutManifest(ctx context.Context, reference Reference, mediaType string, data []byte) (string, error) {
+	identifier := reference.Tag
+	if identifier == "" {
+		identifier = Digest(data)
+	}
+	body := func() io.Reader { return bytes.NewReader(data) }
+	response, err := c.do(ctx, reference, http.MethodPut, "/manifests/"+identifier, body, map[string]string{"Content-Type": mediaType})
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	return Digest(data), nil
+}
+
+// BlobExists reports whether the blob with digest is present in
+// reference's repository.
+func (c *Client) BlobExists(ctx context.Context, reference Reference, digest string) (bool, error) {
+	response, err := c.do(ctx, reference, http.MethodHead, "/blobs/"+digest, nil, nil)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+	return true, nil
+}
+
+// MountBlob asks the registry to link a blob from another repository on the
+// same registry into reference's repository without transferring it. It
+// reports false when the registry declined the mount and an upload is
+// needed instead. The registry then opens an upload session, which is
+// returned for PushBlob to use or CancelUpload to close; it is nil if the
+// registry named none.
+func (c *Client) MountBlob(ctx context.Context, reference Reference, digest, fromRepository string) (bool, *url.URL, error) {
+	query := url.Values{"mount": {digest}, "from": {fromRepository}}
+	response, err := c.do(ctx, reference, http.MethodPost, "/blobs/uploads/?"+query.Encode(), nil, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusCreated {
+		return true, nil, nil
+	}
+	upload, err := response.Location()
+	if err != nil {
+		return false, nil, nil
+	}
+	return false, upload, nil
+}
+
+// CancelUpload closes an upload session that will not be used.
+func (c *Client) CancelUpload(ctx context.Context, reference Reference, upload *url.URL) error {
+	response, err := c.doURL(ctx, reference, http.MethodDelete, upload.String(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("cancel blob upload to %s: %w", reference.Name(), err)
+	}
+	response.Body.Close()
+	return nil
+}
+
+// PushBlob uploads size bytes read from content as the blob with digest
+// using a monolithic upload, in the session upload if one was opened by
+// MountBlob, or else in a new one.
+func (c *Client) PushBlob(ctx context.Context, reference Reference, upload *url.URL, digest string, size int64, content io.Reader) error {
+	location := upload
+	if location == nil {
+		response, err := c.do(ctx, reference, http.MethodPost, "/blobs/uploads/", nil, nil)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+
+		location, err = response.Location()
+		if err != nil {
+			return fmt.Errorf("start blob upload to %s: %w", reference.Name(), err)
+		}
+	}
+	copied := *location
+	location = &copied
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	// The upload session was authorized by the POST above, so the body is
+	// only ever sent once and may be a one-shot stream.
+	body := func() io.Reader { return content }
+	headers := map[string]string{
+		"Content-Type":   "application/octet-stream",
+		"Content-Length": fmt.Sprint(size),
+	}
+	response, err := c.doURL(ctx, reference, http.MethodPut, location.String(), body, headers)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
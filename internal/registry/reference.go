@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry assumed for references without an
+	// explicit registry host, matching the Docker CLI.
+	DefaultRegistry = "docker.io"
+	// DefaultTag is the tag assumed for references without a tag or digest.
+	DefaultTag = "latest"
+)
+
+var (
+	repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern        = regexp.MustCompile(`^\w[\w.-]{0,127}$`)
+	digestPattern     = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+)
+
+// Reference is a parsed container image reference such as
+// "ghcr.io/org/app:v1" or "nginx@sha256:...".
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference using the same defaults as the
+// Docker CLI: images without a registry host live on Docker Hub, and
+// single-component Docker Hub names live under "library/".
+func ParseReference(name string) (Reference, error) {
+	var reference Reference
+	remainder := strings.TrimSpace(name)
+	if remainder == "" {
+		return reference, fmt.Errorf("empty image reference")
+	}
+
+	if index := strings.Index(remainder, "@"); index != -1 {
+		reference.Digest = remainder[index+1:]
+		remainder = remainder[:index]
+		if !digestPattern.MatchString(reference.Digest) {
+			return reference, fmt.Errorf("invalid digest in image reference %q", name)
+		}
+	}
+
+	if colon := strings.LastIndex(remainder, ":"); colon != -1 && colon > strings.LastIndex(remainder, "/") {
+		reference.Tag = remainder[colon+1:]
+		remainder = remainder[:colon]
+		if !tagPattern.MatchString(reference.Tag) {
+			return reference, fmt.Errorf("invalid tag in image reference %q", name)
+		}
+	}
+
+	reference.Registry = DefaultRegistry
+	if slash := strings.Index(remainder, "/"); slash != -1 {
+		first := remainder[:slash]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			reference.Registry = first
+			remainder = remainder[slash+1:]
+		}
+	}
+	if reference.Registry == "index.docker.io" || reference.Registry == "registry-1.docker.io" {
+		reference.Registry = DefaultRegistry
+	}
+	if reference.Registry == DefaultRegistry && !strings.Contains(remainder, "/") {
+		remainder = "library/" + remainder
+	}
+
+	reference.Repository = remainder
+	if !repositoryPattern.MatchString(reference.Repository) {
+		return reference, fmt.Errorf("invalid repository in image reference %q", name)
+	}
+
+	return reference, nil
+}
+
+// Identifier returns the digest when set, otherwise the tag, defaulting to
+// "latest". It is the value used in manifest URLs.
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	if r.Tag != "" {
+		return r.Tag
+	}
+	return DefaultTag
+}
+
+// Name returns the fully qualified repository name without tag or digest.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the fully qualified reference.
+func (r Reference) String() string {
+	name := r.Name()
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+package registry
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	cases := []struct {
+		input      string
+		registry   string
+		repository string
+		tag        string
+		digest     string
+	}{
+		{"nginx", "docker.io", "library/nginx", "", ""},
+		{"nginx:1.25", "docker.io", "library/nginx", "1.25", ""},
+		{"bitnami/redis:7.2", "docker.io", "bitnami/redis", "7.2", ""},
+		{"docker.io/bitnami/redis:7.2", "docker.io", "bitnami/redis", "7.2", ""},
+		{"index.docker.io/library/alpine", "docker.io", "library/alpine", "", ""},
+		{"ghcr.io/org/app:v1", "ghcr.io", "org/app", "v1", ""},
+		{"registry:5000/ns/app:v1", "registry:5000", "ns/app", "v1", ""},
+		{"localhost/app", "localhost", "app", "", ""},
+		{"ghcr.io/org/app:v1@sha256:abcd", "ghcr.io", "org/app", "v1", "sha256:abcd"},
+		{"quay.io/org/app@sha256:abcd", "quay.io", "org/app", "", "sha256:abcd"},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.input, func(t *testing.T) {
+			reference, err := ParseReference(testCase.input)
+			if err != nil {
+				t.Fatalf("ParseReference(%q) error: %v", testCase.input, err)
+			}
+			if reference.Registry != testCase.registry || reference.Repository != testCase.repository || reference.Tag != testCase.tag || reference.Digest != testCase.digest {
+				t.Fatalf("ParseReference(%q) = %+v", testCase.input, reference)
+			}
+		})
+	}
+}
+
+func TestParseReferenceRejectsInvalid(t *testing.T) {
+	for _, input := range []string{"", "UPPER/case", "app:bad tag", "app@nodigest", "{{ .Values.image }}"} {
+		if _, err := ParseReference(input); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
+
+func TestReferenceIdentifierAndString(t *testing.T) {
+	reference, err := ParseReference("nginx")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	if reference.Identifier() != "latest" {
+		t.Fatalf("expected default tag latest, got %q", reference.Identifier())
+	}
+	if reference.String() != "docker.io/library/nginx" {
+		t.Fatalf("unexpected String(): %q", reference.String())
+	}
+
+	reference.Tag = "1.0"
+	reference.Digest = "sha256:abcd"
+	if reference.Identifier() != "sha256:abcd" {
+		t.Fatalf("expected digest identifier, got %q", reference.Identifier())
+	}
+	if reference.String() != "docker.io/library/nginx:1.0@sha256:abcd" {
+		t.Fatalf("unexpected String(): %q", reference.String())
+	}
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Referrers returns the manifests in reference's repository that declare
+// the manifest with digest as their subject, using the OCI referrers API.
+// A non-empty artifactType limits the result to that type, filtering
+// client side when the registry does not. Registries without the API
+// return an error satisfying IsNotFound.
+func (c *Client) Referrers(ctx context.Context, reference Reference, digest, artifactType string) ([]Descriptor, error) {
+	path := "/referrers/" + digest
+	if artifactType != "" {
+		path += "?" + url.Values{"artifactType": {artifactType}}.Encode()
+	}
+	response, err := c.do(ctx, reference, http.MethodGet, path, nil, map[string]string{"Accept": MediaTypeOCIIndex})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var index Index
+	if err := json.NewDecoder(response.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("parse referrers of %s@%s: %w", reference.Name(), digest, err)
+	}
+	if artifactType == "" || response.Header.Get("OCI-Filters-Applied") != "" {
+		return index.Manifests, nil
+	}
+	var filtered []Descriptor
+	for _, descriptor := range index.Manifests {
+		if descriptor.ArtifactType == artifactType {
+			filtered = append(filtered, descriptor)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,450 @@
+// Package registrytest provides an in-memory OCI distribution registry for
+// tests, served over httptest.
+package registrytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tonur/heft/internal/registry"
+)
+
+// Registry is an in-memory registry stand-in. Repositories, manifests and
+// blobs are keyed by name and digest; tags point at manifest digests.
+type Registry struct {
+	Server *httptest.Server
+
+	// Token, when set, makes the registry require a bearer token obtained
+	// from its /token endpoint. Username and Password, when set, must be
+	// presented as basic credentials to that endpoint.
+	Token    string
+	Username string
+	Password string
+
+	// Fail, when set, makes the registry answer matching requests with a
+	// 500 error, simulating an unreliable registry.
+	Fail func(request *http.Request) bool
+
+	// DeclineMounts makes the registry refuse cross-repository blob mounts
+	// and open an upload session instead, as registries do when the
+	// caller may not read the source repository.
+	DeclineMounts bool
+
+	// TagsPageSize, when set, caps the tags returned per tags/list page,
+	// as registries may return fewer than requested.
+	TagsPageSize int
+
+	mutex     sync.Mutex
+	manifests map[string]map[string]manifest // repository -> digest -> manifest
+	tags      map[string]map[string]string   // repository -> tag -> digest
+	blobs     map[string]map[string][]byte   // repository -> digest -> content
+	uploads   int
+	open      map[string]bool // upload sessions not yet finished or cancelled
+	requests  []string
+}
+
+type manifest struct {
+	mediaType string
+	data      []byte
+}
+
+// New starts a registry stand-in. It is closed when the test ends.
+func New(t interface {
+	Helper()
+	Cleanup(func())
+}) *Registry {
+	t.Helper()
+	r := &Registry{
+		manifests: map[string]map[string]manifest{},
+		tags:      map[string]map[string]string{},
+		blobs:     map[string]map[string][]byte{},
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.Server.Close)
+	return r
+}
+
+// Host returns the registry host (127.0.0.1:port) used in image references.
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.Server.URL, "http://")
+}
+
+// AddBlob stores content in repository and returns its digest.
+func (r *Registry) AddBlob(repository string, content []byte) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	digest := registry.Digest(content)
+	if r.blobs[repository] == nil {
+		r.blobs[repository] = map[string][]byte{}
+	}
+	r.blobs[repository][digest] = content
+	return digest
+}
+
+// AddManifest stores a manifest in repository, tags it when tag is not
+// empty, and returns its digest.
+func (r *Registry) AddManifest(repository, tag, mediaType string, data []byte) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	digest := registry.Digest(data)
+	if r.manifests[repository] == nil {
+		r.manifests[repository] = map[string]manifest{}
+	}
+	r.manifests[repository][digest] = manifest{mediaType: mediaType, data: data}
+	if tag != "" {
+		if r.tags[repository] == nil {
+			r.tags[repository] = map[string]string{}
+		}
+		r.tags[repository][tag] = digest
+	}
+	return digest
+}
+
+// AddImage stores a single-platform image with the given config JSON and
+// layers, tags it, and returns the manifest digest.
+func (r *Registry) AddImage(repository, tag string, config []byte, layers ...[]byte) string {
+	manifest := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		Config: registry.Descriptor{
+			MediaType: "application/vnd.oci.image.config.v1+json",
+			Digest:    r.AddBlob(repository, config),
+			Size:      int64(len(config)),
+		},
+		Layers: []registry.Descriptor{},
+	}
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, registry.Descriptor{
+			MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+			Digest:    r.AddBlob(repository, layer),
+			Size:      int64(len(layer)),
+		})
+	}
+	data, _ := json.Marshal(manifest)
+	return r.AddManifest(repository, tag, registry.MediaTypeOCIManifest, data)
+}
+
+// Manifest returns the manifest stored in repository under a tag or digest.
+func (r *Registry) Manifest(repository, reference string) ([]byte, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	digest := reference
+	if !strings.Contains(reference, ":") {
+		digest = r.tags[repository][reference]
+	}
+	stored, ok := r.manifests[repository][digest]
+	return stored.data, ok
+}
+
+// HasBlob reports whether repository contains the blob with digest.
+func (r *Registry) HasBlob(repository, digest string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.blobs[repository][digest]
+	return ok
+}
+
+// OpenUploads returns the paths of the upload sessions that were started
+// but neither finished nor cancelled.
+func (r *Registry) OpenUploads() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var open []string
+	for path := range r.open {
+		open = append(open, path)
+	}
+	sort.Strings(open)
+	return open
+}
+
+// Requests returns the "METHOD path?query" of every request served so far.
+func (r *Registry) Requests() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.requests...)
+}
+
+func (r *Registry) serveHTTP(w http.ResponseWriter, request *http.Request) {
+	r.mutex.Lock()
+	r.requests = append(r.requests, request.Method+" "+request.URL.RequestURI())
+	r.mutex.Unlock()
+
+	if r.Fail != nil && r.Fail(request) {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN")
+		return
+	}
+
+	if request.URL.Path == "/token" {
+		r.serveToken(w, request)
+		return
+	}
+	if r.Token != "" && request.Header.Get("Authorization") != "Bearer "+r.Token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q,service="registrytest"`, r.Server.URL+"/token"))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if request.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	path := strings.TrimPrefix(request.URL.Path, "/v2/")
+	for _, kind := range []string{"/manifests/", "/blobs/", "/tags/list", "/referrers/"} {
+		index := strings.LastIndex(path, kind)
+		if index == -1 {
+			continue
+		}
+		repository, identifier := path[:index], path[index+len(kind):]
+		switch kind {
+		case "/manifests/":
+			r.serveManifest(w, request, repository, identifier)
+		case "/blobs/":
+			r.serveBlob(w, request, repository, identifier)
+		case "/tags/list":
+			r.serveTags(w, request, repository)
+		case "/referrers/":
+			r.serveReferrers(w, request, repository, identifier)
+		}
+		return
+	}
+	http.NotFound(w, request)
+}
+
+func (r *Registry) serveToken(w http.ResponseWriter, request *http.Request) {
+	if r.Username != "" {
+		username, password, ok := request.BasicAuth()
+		if !ok || username != r.Username || password != r.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"token": r.Token})
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, request *http.Request, repository, identifier string) {
+	r.mutex.Lock()
+	digest := identifier
+	if !strings.Contains(identifier, ":") {
+		digest = r.tags[repository][identifier]
+	}
+	stored, ok := r.manifests[repository][digest]
+	r.mutex.Unlock()
+
+	if request.Method == http.MethodPut {
+		r.putManifest(w, request, repository, identifier)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN")
+		return
+	}
+	w.Header().Set("Content-Type", stored.mediaType)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", fmt.Sprint(len(stored.data)))
+	if request.Method == http.MethodGet {
+		_, _ = w.Write(stored.data)
+	}
+}
+
+func (r *Registry) putManifest(w http.ResponseWriter, request *http.Request, repository, identifier string) {
+	data, err := io.ReadAll(request.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID")
+		return
+	}
+	tag := identifier
+	if strings.Contains(identifier, ":") {
+		if identifier != registry.Digest(data) {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID")
+			return
+		}
+		tag = ""
+	}
+	digest := r.AddManifest(repository, tag, request.Header.Get("Content-Type"), data)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, request *http.Request, repository, digest string) {
+	if digest == "uploads/" && request.Method == http.MethodPost {
+		r.startUpload(w, request, repository)
+		return
+	}
+	if strings.HasPrefix(digest, "uploads/") && request.Method == http.MethodPut {
+		r.finishUpload(w, request, repository)
+		return
+	}
+	if strings.HasPrefix(digest, "uploads/") && request.Method == http.MethodDelete {
+		r.mutex.Lock()
+		delete(r.open, request.URL.Path)
+		r.mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	r.mutex.Lock()
+	content, ok := r.blobs[repository][digest]
+	r.mutex.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN")
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+	if request.Method == http.MethodGet {
+		_, _ = w.Write(content)
+	}
+}
+
+func (r *Registry) startUpload(w http.ResponseWriter, request *http.Request, repository string) {
+	query := request.URL.Query()
+	if mount := query.Get("mount"); mount != "" && !r.DeclineMounts {
+		r.mutex.Lock()
+		content, ok := r.blobs[query.Get("from")][mount]
+		r.mutex.Unlock()
+		if ok {
+			r.AddBlob(repository, content)
+			w.Header().Set("Location", "/v2/"+repository+"/blobs/"+mount)
+			w.Header().Set("Docker-Content-Digest", mount)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+	}
+
+	r.mutex.Lock()
+	r.uploads++
+	location := fmt.Sprintf("/v2/%s/blobs/uploads/%d", repository, r.uploads)
+	if r.open == nil {
+		r.open = map[string]bool{}
+	}
+	r.open[location] = true
+	r.mutex.Unlock()
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (r *Registry) finishUpload(w http.ResponseWriter, request *http.Request, repository string) {
+	content, err := io.ReadAll(request.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID")
+		return
+	}
+	digest := request.URL.Query().Get("digest")
+	if digest != registry.Digest(content) {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID")
+		return
+	}
+	r.mutex.Lock()
+	delete(r.open, request.URL.Path)
+	r.mutex.Unlock()
+	r.AddBlob(repository, content)
+	w.Header().Set("Location", "/v2/"+repository+"/blobs/"+digest)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// serveTags lists a repository's tags in lexical order, paginated with the
+// n and last query parameters and a Link header like the distribution API.
+func (r *Registry) serveTags(w http.ResponseWriter, request *http.Request, repository string) {
+	r.mutex.Lock()
+	var tags []string
+	for tag := range r.tags[repository] {
+		tags = append(tags, tag)
+	}
+	r.mutex.Unlock()
+
+	if tags == nil {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN")
+		return
+	}
+	sort.Strings(tags)
+
+	query := request.URL.Query()
+	if last := query.Get("last"); last != "" {
+		tags = tags[sort.SearchStrings(tags, last+"\x00"):]
+	}
+	n, err := strconv.Atoi(query.Get("n"))
+	if err != nil || (r.TagsPageSize > 0 && n > r.TagsPageSize) {
+		n = r.TagsPageSize
+	}
+	if n > 0 && n < len(tags) {
+		tags = tags[:n]
+		next := url.Values{"n": {strconv.Itoa(n)}, "last": {tags[n-1]}}
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?%s>; rel="next"`, repository, next.Encode()))
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"name": repository, "tags": tags})
+}
+
+// serveReferrers lists the manifests in repository whose subject is
+// digest, filtered by the artifactType query parameter, as an OCI index.
+func (r *Registry) serveReferrers(w http.ResponseWriter, request *http.Request, repository, digest string) {
+	artifactType := request.URL.Query().Get("artifactType")
+	index := registry.Index{SchemaVersion: 2, MediaType: registry.MediaTypeOCIIndex, Manifests: []registry.Descriptor{}}
+
+	r.mutex.Lock()
+	for manifestDigest, stored := range r.manifests[repository] {
+		var referrer registry.Manifest
+		if json.Unmarshal(stored.data, &referrer) != nil || referrer.Subject == nil || referrer.Subject.Digest != digest {
+			continue
+		}
+		descriptorType := referrer.ArtifactType
+		if descriptorType == "" {
+			descriptorType = referrer.Config.MediaType
+		}
+		if artifactType != "" && descriptorType != artifactType {
+			continue
+		}
+		index.Manifests = append(index.Manifests, registry.Descriptor{
+			MediaType:    stored.mediaType,
+			ArtifactType: descriptorType,
+			Digest:       manifestDigest,
+			Size:         int64(len(stored.data)),
+			Annotations:  referrer.Annotations,
+		})
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(index.Manifests, func(i, j int) bool { return index.Manifests[i].Digest < index.Manifests[j].Digest })
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	w.Header().Set("Content-Type", registry.MediaTypeOCIIndex)
+	_ = json.NewEncoder(w).Encode(index)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]string{{"code": code}}})
+}
+
+// AddIndex stores an OCI index referencing the given manifest digests with
+// their platforms, tags it, and returns its digest. Each manifest must
+// already exist in repository.
+func (r *Registry) AddIndex(repository, tag string, platforms map[string]registry.Platform) string {
+	index := registry.Index{SchemaVersion: 2, MediaType: registry.MediaTypeOCIIndex, Manifests: []registry.Descriptor{}}
+	r.mutex.Lock()
+	for digest, platform := range platforms {
+		platform := platform
+		stored := r.manifests[repository][digest]
+		index.Manifests = append(index.Manifests, registry.Descriptor{
+			MediaType: stored.mediaType,
+			Digest:    digest,
+			Size:      int64(len(stored.data)),
+			Platform:  &platform,
+		})
+	}
+	r.mutex.Unlock()
+	sort.Slice(index.Manifests, func(i, j int) bool { return index.Manifests[i].Digest < index.Manifests[j].Digest })
+	data, _ := json.Marshal(index)
+	return r.AddManifest(repository, tag, registry.MediaTypeOCIIndex, data)
+}
@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+// tagsPageSize is the number of tags requested per page.
+const tagsPageSize = 1000
+
+var linkNext = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// ListTags returns every tag in reference's repository, following the
+// registry's pagination links.
+func (c *Client) ListTags(ctx context.Context, reference Reference) ([]string, error) {
+	target := c.baseURL(reference.Registry) + "/v2/" + reference.Repository + "/tags/list?" + url.Values{"n": {fmt.Sprint(tagsPageSize)}}.Encode()
+	var tags []string
+	for target != "" {
+		response, err := c.doURL(ctx, reference, http.MethodGet, target, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode tags of %s: %w", reference.Name(), err)
+		}
+		tags = append(tags, page.Tags...)
+
+		next := ""
+		if match := linkNext.FindStringSubmatch(response.Header.Get("Link")); match != nil {
+			base, err := url.Parse(target)
+			if err != nil {
+				return nil, err
+			}
+			link, err := base.Parse(match[1])
+			if err != nil {
+				return nil, fmt.Errorf("tags of %s: invalid link %q: %w", reference.Name(), match[1], err)
+			}
+			next = link.String()
+		}
+		target = next
+	}
+	return tags, nil
+}
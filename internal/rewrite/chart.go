@@ -0,0 +1,203 @@
+package rewrite
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chart holds the parts of a chart that decide its default values: its own
+// values.yaml and those of its subcharts, keyed the way the parent's values
+// address them.
+type chart struct {
+	name      string
+	values    map[string]any
+	subcharts map[string]*chart
+}
+
+type chartDependency struct {
+	Name  string `yaml:"name"`
+	Alias string `yaml:"alias"`
+}
+
+type chartMetadata struct {
+	Name         string            `yaml:"name"`
+	Dependencies []chartDependency `yaml:"dependencies"`
+}
+
+// loadChart reads the chart directory or packaged .tgz at chartPath,
+// including unpacked and packaged subcharts under charts/.
+func loadChart(chartPath string) (*chart, error) {
+	info, err := os.Stat(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(chartPath)
+		if err != nil {
+			return nil, err
+		}
+		return chartFromArchive(data)
+	}
+
+	files := map[string][]byte{}
+	err = filepath.WalkDir(chartPath, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relative, err := filepath.Rel(chartPath, file)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+		if !isChartFile(relative) {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		files[relative] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chartFromFiles(files)
+}
+
+// isChartFile reports whether a file, relative to a chart root, is needed to
+// work out the chart's values.
+func isChartFile(name string) bool {
+	base := path.Base(name)
+	return base == "Chart.yaml" || base == "values.yaml" || (strings.HasPrefix(name, "charts/") && strings.HasSuffix(base, ".tgz"))
+}
+
+func chartFromArchive(data []byte) (*chart, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Strip the top-level chart directory.
+		_, relative, ok := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		if !ok || !isChartFile(relative) {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[relative] = content
+	}
+	return chartFromFiles(files)
+}
+
+// chartFromFiles builds a chart from files keyed by their path relative to
+// the chart root.
+func chartFromFiles(files map[string][]byte) (*chart, error) {
+	var metadata chartMetadata
+	if data, ok := files["Chart.yaml"]; ok {
+		if err := yaml.Unmarshal(data, &metadata); err != nil {
+			return nil, fmt.Errorf("parse Chart.yaml: %w", err)
+		}
+	}
+
+	result := &chart{name: metadata.Name, values: map[string]any{}, subcharts: map[string]*chart{}}
+	if data, ok := files["values.yaml"]; ok {
+		if err := yaml.Unmarshal(data, &result.values); err != nil {
+			return nil, fmt.Errorf("parse values.yaml: %w", err)
+		}
+		if result.values == nil {
+			result.values = map[string]any{}
+		}
+	}
+
+	// Group files of unpacked subcharts by directory and parse packaged ones.
+	subchartFiles := map[string]map[string][]byte{}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rest, ok := strings.CutPrefix(name, "charts/")
+		if !ok {
+			continue
+		}
+		directory, inner, nested := strings.Cut(rest, "/")
+		if !nested {
+			if strings.HasSuffix(rest, ".tgz") {
+				subchart, err := chartFromArchive(files[name])
+				if err != nil {
+					return nil, fmt.Errorf("read subchart %s: %w", name, err)
+				}
+				for _, key := range valuesKeys(metadata, subchart.name) {
+					result.subcharts[key] = subchart
+				}
+			}
+			continue
+		}
+		if subchartFiles[directory] == nil {
+			subchartFiles[directory] = map[string][]byte{}
+		}
+		subchartFiles[directory][inner] = files[name]
+	}
+
+	for directory, subFiles := range subchartFiles {
+		subchart, err := chartFromFiles(subFiles)
+		if err != nil {
+			return nil, fmt.Errorf("read subchart charts/%s: %w", directory, err)
+		}
+		if subchart.name == "" {
+			subchart.name = directory
+		}
+		for _, key := range valuesKeys(metadata, subchart.name) {
+			result.subcharts[key] = subchart
+		}
+	}
+	return result, nil
+}
+
+// valuesKeys returns the keys under which the parent chart's values
+// address the subchart named name: each alias it is declared with, or its
+// name.
+func valuesKeys(parent chartMetadata, name string) []string {
+	var keys []string
+	for _, dependency := range parent.Dependencies {
+		if dependency.Name == name && dependency.Alias != "" {
+			keys = append(keys, dependency.Alias)
+		}
+	}
+	if len(keys) == 0 {
+		keys = append(keys, name)
+	}
+	return keys
+}
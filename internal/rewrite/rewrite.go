@@ -0,0 +1,266 @@
+// Package rewrite produces Helm values that point a chart's images at a
+// mirror registry.
+package rewrite
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tonur/heft/internal/mirror"
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Options controls how values are rewritten.
+type Options struct {
+	// Registry is the mirror registry and optional path prefix, e.g.
+	// "mirror.internal/charts". It has the same meaning as the --to prefix
+	// of a mirror run.
+	Registry string
+	// Mapping names mirrored repositories; it must match the mapping the
+	// images were mirrored with.
+	Mapping mirror.Mapping
+	// ValuesFiles are additional values files, applied in order after the
+	// chart's own values, whose image keys are rewritten too.
+	ValuesFiles []string
+}
+
+// Change records one rewritten values key.
+type Change struct {
+	Key  string `yaml:"key" json:"key"`
+	From string `yaml:"from" json:"from"`
+	To   string `yaml:"to" json:"to"`
+}
+
+// Result holds the override values and the changes they make.
+type Result struct {
+	Values  map[string]any
+	Changes []Change
+}
+
+// Values walks the default values of the chart at chartPath, its subcharts
+// and options.ValuesFiles, and returns values overriding every image key it
+// finds so that the image is pulled from options.Registry:
+//
+//   - image: "repo:tag" strings are replaced as a whole;
+//   - image maps, and other maps with a repository and a tag or digest,
+//     get registry and repository (or name, or image) replaced if they have
+//     a registry key, or else a fully qualified repository;
+//   - imageRepository keys are treated the same way, with imageRegistry as
+//     their registry key;
+//   - other imageRegistry keys, such as global.imageRegistry, get the
+//     mirror host.
+//
+// These are the conventions the static detector finds images by.
+//
+// Images inside lists cannot be overridden key by key in Helm values and
+// are left alone; rendering with the result and checking it with Verify
+// reports them.
+func Values(chartPath string, options Options) (*Result, error) {
+	if options.Registry == "" {
+		return nil, fmt.Errorf("target registry is empty")
+	}
+	host, err := registry.ParseReference(strings.TrimRight(options.Registry, "/") + "/probe")
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry %q: %w", options.Registry, err)
+	}
+
+	loaded, err := loadChart(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("read chart %q: %w", chartPath, err)
+	}
+
+	rewriter := &rewriter{options: options, host: host.Registry, overrides: map[string]any{}, changes: map[string]Change{}}
+	rewriter.walkChart(loaded, nil)
+
+	for _, file := range options.ValuesFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read values file: %w", err)
+		}
+		var values map[string]any
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("parse values file %q: %w", file, err)
+		}
+		rewriter.walkValue(values, nil)
+	}
+
+	result := &Result{Values: rewriter.overrides}
+	for _, change := range rewriter.changes {
+		result.Changes = append(result.Changes, change)
+	}
+	sort.Slice(result.Changes, func(i, j int) bool { return result.Changes[i].Key < result.Changes[j].Key })
+	return result, nil
+}
+
+// Verify returns the rendered images that do not point into registry, i.e.
+// those the rewritten values failed to redirect.
+func Verify(images []scan.ImageFinding, registryPrefix string) []string {
+	prefix := strings.TrimRight(registryPrefix, "/") + "/"
+	var remaining []string
+	for _, image := range images {
+		if image.Source != scan.SourceRendered {
+			continue
+		}
+		name := image.Name
+		if reference, err := registry.ParseReference(image.Name); err == nil {
+			name = reference.Name()
+		}
+		if !strings.HasPrefix(name, prefix) && !strings.HasPrefix(image.Name, prefix) {
+			remaining = append(remaining, image.Name)
+		}
+	}
+	sort.Strings(remaining)
+	return remaining
+}
+
+type rewriter struct {
+	options   Options
+	host      string
+	overrides map[string]any
+	// changes is keyed by values path, so a values file overriding a chart
+	// default replaces its change.
+	changes map[string]Change
+}
+
+// walkChart rewrites a chart's values, addressed under path in the top-level
+// values, and those of its subcharts. Globals are shared by all charts and
+// always live at the top level.
+func (r *rewriter) walkChart(chart *chart, path []string) {
+	values := map[string]any{}
+	for key, value := range chart.values {
+		if key == "global" {
+			r.walkValue(value, []string{"global"})
+			continue
+		}
+		values[key] = value
+	}
+	r.walkValue(values, path)
+	for key, subchart := range chart.subcharts {
+		r.walkChart(subchart, appendPath(path, key))
+	}
+}
+
+func (r *rewriter) walkValue(node any, path []string) {
+	values, ok := node.(map[string]any)
+	if !ok {
+		return
+	}
+	_, hasImageRepository := values["imageRepository"].(string)
+	if hasImageRepository {
+		r.rewriteImageMap(values, path, "imageRegistry", "imageRepository")
+	}
+	for key, value := range values {
+		switch {
+		case hasImageRepository && (key == "imageRepository" || key == "imageRegistry"):
+			// Rewritten together above.
+		case key == "image":
+			r.rewriteImage(value, appendPath(path, key))
+		case isImageMap(value):
+			r.rewriteImage(value, appendPath(path, key))
+		case key == "imageRegistry":
+			if current, ok := value.(string); ok {
+				r.set(appendPath(path, key), current, r.host)
+			}
+		default:
+			r.walkValue(value, appendPath(path, key))
+		}
+	}
+}
+
+func (r *rewriter) rewriteImage(value any, path []string) {
+	switch image := value.(type) {
+	case string:
+		target, ok := r.target(image)
+		if ok {
+			r.set(path, image, target.String())
+		}
+	case map[string]any:
+		r.rewriteImageMap(image, path, "registry", scan.ImageRepositoryKey(image))
+	}
+}
+
+// isImageMap reports whether value is a map the static detector reads as
+// an image although it is not under an image key: one with a repository
+// and a tag or digest.
+func isImageMap(value any) bool {
+	image, ok := value.(map[string]any)
+	if !ok {
+		return false
+	}
+	_, hasTag := image["tag"]
+	_, hasDigest := image["digest"]
+	_, hasRepository := image["repository"].(string)
+	return hasRepository && (hasTag || hasDigest)
+}
+
+// rewriteImageMap rewrites the image a map at path describes with its
+// registryKey and repositoryKey.
+func (r *rewriter) rewriteImageMap(image map[string]any, path []string, registryKey, repositoryKey string) {
+	repository, _ := image[repositoryKey].(string)
+	if repository == "" {
+		return
+	}
+	registryValue, hasRegistry := image[registryKey].(string)
+	source := repository
+	if hasRegistry && registryValue != "" {
+		source = registryValue + "/" + repository
+	}
+	target, ok := r.target(source)
+	if !ok {
+		return
+	}
+	if hasRegistry {
+		r.set(appendPath(path, registryKey), registryValue, target.Registry)
+		r.set(appendPath(path, repositoryKey), repository, target.Repository)
+		return
+	}
+	r.set(appendPath(path, repositoryKey), repository, target.Name())
+}
+
+// target maps an image name from the values to its mirrored reference.
+// Templated and unparseable names are skipped.
+func (r *rewriter) target(name string) (registry.Reference, bool) {
+	if strings.Contains(name, "{{") {
+		return registry.Reference{}, false
+	}
+	source, err := registry.ParseReference(name)
+	if err != nil {
+		return registry.Reference{}, false
+	}
+	target, err := r.options.Mapping.Target(r.options.Registry, source)
+	if err != nil {
+		return registry.Reference{}, false
+	}
+	// Keep the values' own tag handling: an untagged image stays untagged.
+	if source.Tag == "" && source.Digest == "" {
+		target.Tag = ""
+	}
+	return target, true
+}
+
+func (r *rewriter) set(path []string, from, to string) {
+	current := r.overrides
+	for _, key := range path[:len(path)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			current[key] = next
+		}
+		current = next
+	}
+	current[path[len(path)-1]] = to
+
+	key := strings.Join(path, ".")
+	r.changes[key] = Change{Key: key, From: from, To: to}
+}
+
+// appendPath returns path extended by key without sharing path's backing
+// array with other callers.
+func appendPath(path []string, key string) []string {
+	return append(append([]string(nil), path...), key)
+}
@@ -0,0 +1,175 @@
+package rewrite
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tonur/heft/internal/mirror"
+	"github.com/tonur/heft/internal/scan"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func packageFiles(t *testing.T, root string, files map[string]string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		header := &tar.Header{Name: root + "/" + name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buffer.Bytes()
+}
+
+func TestValuesRewritesImageKeys(t *testing.T) {
+	chartDir := t.TempDir()
+	writeFiles(t, chartDir, map[string]string{
+		"Chart.yaml": `apiVersion: v2
+name: app
+version: 0.1.0
+dependencies:
+  - name: redis
+    alias: cache
+`,
+		"values.yaml": `global:
+  imageRegistry: ""
+image:
+  registry: docker.io
+  repository: bitnami/app
+  tag: 1.0.0
+sidecar:
+  image: quay.io/org/sidecar:v2
+templated:
+  image: "{{ .Values.custom }}"
+worker:
+  image:
+    repository: ghcr.io/org/worker
+    tag: latest
+initContainers:
+  - image: busybox:1.36
+`,
+	})
+	subchart := packageFiles(t, "redis", map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: redis\nversion: 1.0.0\n",
+		"values.yaml": "global:\n  imageRegistry: \"\"\nimage:\n  repository: redis\n  tag: \"7.2\"\n",
+	})
+	if err := os.MkdirAll(filepath.Join(chartDir, "charts"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chartDir, "charts", "redis-1.0.0.tgz"), subchart, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	userValues := filepath.Join(t.TempDir(), "prod.yaml")
+	writeFiles(t, filepath.Dir(userValues), map[string]string{"prod.yaml": "extra:\n  image: nginx\n"})
+
+	mapping, err := mirror.NewMapping(mirror.StrategyKeepPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Values(chartDir, Options{Registry: "mirror.internal/m", Mapping: mapping, ValuesFiles: []string{userValues}})
+	if err != nil {
+		t.Fatalf("Values error: %v", err)
+	}
+
+	want := map[string]any{
+		"global":  map[string]any{"imageRegistry": "mirror.internal"},
+		"image":   map[string]any{"registry": "mirror.internal", "repository": "m/bitnami/app"},
+		"sidecar": map[string]any{"image": "mirror.internal/m/org/sidecar:v2"},
+		"worker":  map[string]any{"image": map[string]any{"repository": "mirror.internal/m/org/worker"}},
+		"cache":   map[string]any{"image": map[string]any{"repository": "mirror.internal/m/library/redis"}},
+		"extra":   map[string]any{"image": "mirror.internal/m/library/nginx"},
+	}
+	if !reflect.DeepEqual(result.Values, want) {
+		t.Fatalf("unexpected values:\n got %#v\nwant %#v", result.Values, want)
+	}
+	if len(result.Changes) != 7 || result.Changes[0].Key != "cache.image.repository" || result.Changes[0].From != "redis" {
+		t.Fatalf("unexpected changes: %+v", result.Changes)
+	}
+}
+
+// TestValuesRewritesStaticDetectorKeys verifies that the keys the static
+// detector finds images by are rewritten too.
+func TestValuesRewritesStaticDetectorKeys(t *testing.T) {
+	chartDir := t.TempDir()
+	writeFiles(t, chartDir, map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: app\nversion: 0.1.0\n",
+		"values.yaml": `named:
+  image:
+    name: ghcr.io/org/named
+    tag: v1
+nested:
+  image:
+    registry: quay.io
+    image: org/nested
+    tag: v1
+prefixed:
+  imageRegistry: docker.io
+  imageRepository: bitnami/prefixed
+  imageTag: v1
+qualified:
+  imageRepository: ghcr.io/org/qualified
+proxy:
+  repository: envoyproxy/envoy
+  tag: v1.30.1
+`,
+	})
+
+	mapping, err := mirror.NewMapping(mirror.StrategyKeepPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Values(chartDir, Options{Registry: "mirror.internal/m", Mapping: mapping})
+	if err != nil {
+		t.Fatalf("Values error: %v", err)
+	}
+
+	want := map[string]any{
+		"named":     map[string]any{"image": map[string]any{"name": "mirror.internal/m/org/named"}},
+		"nested":    map[string]any{"image": map[string]any{"registry": "mirror.internal", "image": "m/org/nested"}},
+		"prefixed":  map[string]any{"imageRegistry": "mirror.internal", "imageRepository": "m/bitnami/prefixed"},
+		"qualified": map[string]any{"imageRepository": "mirror.internal/m/org/qualified"},
+		"proxy":     map[string]any{"repository": "mirror.internal/m/envoyproxy/envoy"},
+	}
+	if !reflect.DeepEqual(result.Values, want) {
+		t.Fatalf("unexpected values:\n got %#v\nwant %#v", result.Values, want)
+	}
+}
+
+func TestVerifyReportsImagesOutsideRegistry(t *testing.T) {
+	images := []scan.ImageFinding{
+		{Name: "mirror.internal/m/bitnami/app:1.0.0", Source: scan.SourceRendered},
+		{Name: "busybox:1.36", Source: scan.SourceRendered},
+		{Name: "mirror.internal/other/app:1", Source: scan.SourceRendered},
+		{Name: "docker.io/static/only:1", Source: "static-yaml"},
+	}
+	got := Verify(images, "mirror.internal/m/")
+	want := []string{"busybox:1.36", "mirror.internal/other/app:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Verify() = %v, want %v", got, want)
+	}
+}
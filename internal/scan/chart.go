@@ -0,0 +1,59 @@
+package scan
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readChartMetadata reads Chart.yaml from a chart directory or packaged
+// .tgz. It returns nil when the chart has no readable Chart.yaml.
+func readChartMetadata(chartPath string) *ChartMetadata {
+	data, err := readChartFile(chartPath)
+	if err != nil {
+		return nil
+	}
+	var metadata ChartMetadata
+	if err := yaml.Unmarshal(data, &metadata); err != nil || metadata.Name == "" {
+		return nil
+	}
+	return &metadata
+}
+
+func readChartFile(chartPath string) ([]byte, error) {
+	info, err := os.Stat(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return os.ReadFile(filepath.Join(chartPath, "Chart.yaml"))
+	}
+
+	file, err := os.Open(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(strings.TrimPrefix(header.Name, "./"), "/")
+		if len(parts) == 2 && parts[1] == "Chart.yaml" {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package scan
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadChartMetadata(t *testing.T) {
+	for _, chartPath := range []string{
+		filepath.Join("testdata", "basic-chart"),
+		filepath.Join("testdata", "basic-chart.tgz"),
+	} {
+		metadata := readChartMetadata(chartPath)
+		if metadata == nil || metadata.Name != "basic-chart" || metadata.Version == "" {
+			t.Fatalf("%s: unexpected metadata %+v", chartPath, metadata)
+		}
+	}
+	if metadata := readChartMetadata(t.TempDir()); metadata != nil {
+		t.Fatalf("expected nil metadata without Chart.yaml, got %+v", metadata)
+	}
+}
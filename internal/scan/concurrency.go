@@ -0,0 +1,49 @@
+package scan
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultConcurrency is how many detectors, subcharts and registry lookups
+// a scan runs at once when Options.Concurrency is not set.
+const DefaultConcurrency = 4
+
+func (o Options) concurrency() int {
+	if o.Concurrency < 1 {
+		return DefaultConcurrency
+	}
+	return o.Concurrency
+}
+
+// forEach calls task for every index below n, running at most limit calls
+// at once. The first error cancels the context passed to the other calls
+// and no further calls are started; forEach returns it once the running
+// calls have returned. Tasks record their results by index, so callers
+// see them in a deterministic order.
+func forEach(ctx context.Context, limit, n int, task func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(limit, 1))
+	for i := range n {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := task(ctx, i); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
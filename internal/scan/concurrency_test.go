@@ -0,0 +1,101 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachLimitsConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	done := make([]bool, 10)
+	err := forEach(context.Background(), 3, len(done), func(ctx context.Context, i int) error {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := peak.Load()
+			if current <= previous || peak.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		done[i] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("forEach: %v", err)
+	}
+	if got := peak.Load(); got != 3 {
+		t.Errorf("peak concurrency = %d, want 3", got)
+	}
+	for i, ran := range done {
+		if !ran {
+			t.Errorf("task %d did not run", i)
+		}
+	}
+}
+
+func TestForEachCancelsOnError(t *testing.T) {
+	failure := errors.New("registry is down")
+	var started atomic.Int32
+	err := forEach(context.Background(), 2, 10, func(ctx context.Context, i int) error {
+		started.Add(1)
+		if i == 0 {
+			return failure
+		}
+		<-ctx.Done()
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("forEach error = %v, want %v", err, failure)
+	}
+	if got := started.Load(); got != 2 {
+		t.Errorf("%d tasks started, want 2", got)
+	}
+}
+
+// TestScanRunsDetectorsConcurrently verifies that detectors on a chart and
+// its subcharts overlap, and that findings and diagnostics keep the
+// detector and subchart order whatever order the runs finish in.
+func TestScanRunsDetectorsConcurrently(t *testing.T) {
+	chart := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(chart, "charts", name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	helmBin := fakeHelmBinary(t, t.TempDir())
+
+	slow := &fakeDetector{name: "slow", confidence: ConfidenceHigh, delay: 200 * time.Millisecond, images: []ImageFinding{{Name: "example.com/slow:v1"}}}
+	fast := &fakeDetector{name: "fast", confidence: ConfidenceMedium, images: []ImageFinding{{Name: "example.com/fast:v1"}}}
+
+	started := time.Now()
+	result, err := Scan(Options{ChartPath: chart, HelmBin: helmBin, IncludeOptionalDeps: true, Detectors: []Detector{slow, fast}, Concurrency: 6})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("scan took %s; the slow detector's three runs did not overlap", elapsed)
+	}
+
+	var runs []string
+	for _, diagnostic := range result.Diagnostics.Detectors {
+		runs = append(runs, diagnostic.Subchart+"/"+diagnostic.Name)
+	}
+	want := []string{"/slow", "/fast", "a/slow", "a/fast", "b/slow", "b/fast"}
+	if !reflect.DeepEqual(runs, want) {
+		t.Errorf("diagnostics = %v, want %v", runs, want)
+	}
+	var names []string
+	for _, image := range result.Images {
+		names = append(names, image.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"example.com/fast:v1", "example.com/slow:v1"}) {
+		t.Errorf("images = %v", names)
+	}
+}
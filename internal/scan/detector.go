@@ -0,0 +1,186 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Names of the built-in detectors.
+const (
+	DetectorRendered = "rendered"
+	DetectorStatic   = "static"
+	DetectorRegex    = "regex"
+)
+
+// Detector finds images in a chart. Detectors run in the order they are
+// listed in Options.Detectors; their findings are merged and
+// de-duplicated, preferring higher confidence.
+type Detector interface {
+	// Name identifies the detector, e.g. in --detectors and logs.
+	Name() string
+	// Confidence is the confidence of the detector's findings. Findings
+	// that set no confidence of their own get it. Findings below
+	// Options.MinConfidence are dropped; the built-in detectors are not
+	// run at all when theirs is below it.
+	Confidence() Confidence
+	// Detect returns the images in chart. An error is reported as a
+	// warning as long as another detector finds images.
+	Detect(ctx context.Context, chart Chart) ([]ImageFinding, error)
+}
+
+// Chart is a chart on local disk, with the values it is scanned with.
+type Chart struct {
+	// Path is the chart directory. Remote charts are downloaded first.
+	Path string
+	// Values and ValuesFiles are Helm flags, as in Options.
+	Values      []string
+	ValuesFiles []string
+	// HelmBin is the helm binary; DisableHelmDeps stops detectors from
+	// running 'helm dependency build'.
+	HelmBin         string
+	DisableHelmDeps bool
+	Verbose         bool
+	// Logger receives the detector's log; it is never nil.
+	Logger *slog.Logger
+}
+
+func (c Chart) options() Options {
+	return Options{
+		ChartPath:       c.Path,
+		Values:          c.Values,
+		ValuesFiles:     c.ValuesFiles,
+		HelmBin:         c.HelmBin,
+		DisableHelmDeps: c.DisableHelmDeps,
+		Verbose:         c.Verbose,
+		Logger:          c.Logger,
+	}
+}
+
+func (o Options) chart() Chart {
+	return Chart{
+		Path:            o.ChartPath,
+		Values:          o.Values,
+		ValuesFiles:     o.ValuesFiles,
+		HelmBin:         o.HelmBin,
+		DisableHelmDeps: o.DisableHelmDeps,
+		Verbose:         o.Verbose,
+		Logger:          o.logger(),
+	}
+}
+
+// builtinDetector adapts one of heft's own detection functions.
+type builtinDetector struct {
+	name       string
+	confidence Confidence
+	detect     func(context.Context, Options) ([]ImageFinding, error)
+}
+
+func (d builtinDetector) Name() string           { return d.name }
+func (d builtinDetector) Confidence() Confidence { return d.confidence }
+
+func (d builtinDetector) Detect(ctx context.Context, chart Chart) ([]ImageFinding, error) {
+	return d.detect(ctx, chart.options())
+}
+
+var (
+	detectorsLock sync.RWMutex
+	// detectors holds every registered detector by name; detectorOrder
+	// keeps registration order.
+	detectors     = map[string]Detector{}
+	detectorOrder []string
+)
+
+func init() {
+	for _, detector := range DefaultDetectors() {
+		if err := RegisterDetector(detector); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// DefaultDetectors returns the built-in detectors in order of confidence:
+// rendering the chart with helm, reading its values and templates, and
+// matching image-like strings in its files.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		builtinDetector{name: DetectorRendered, confidence: ConfidenceHigh, detect: detectRendered},
+		builtinDetector{name: DetectorStatic, confidence: ConfidenceMedium, detect: detectStatic},
+		builtinDetector{name: DetectorRegex, confidence: ConfidenceLow, detect: detectRegex},
+	}
+}
+
+// RegisterDetector makes detector available by name to LookupDetectors.
+// Names must be unique.
+func RegisterDetector(detector Detector) error {
+	name := detector.Name()
+	if name == "" || strings.ContainsAny(name, ", ") {
+		return fmt.Errorf("invalid detector name %q", name)
+	}
+	detectorsLock.Lock()
+	defer detectorsLock.Unlock()
+	if _, exists := detectors[name]; exists {
+		return fmt.Errorf("detector %q is already registered", name)
+	}
+	detectors[name] = detector
+	detectorOrder = append(detectorOrder, name)
+	return nil
+}
+
+// RegisteredDetectors returns the names of the registered detectors in
+// registration order.
+func RegisteredDetectors() []string {
+	detectorsLock.RLock()
+	defer detectorsLock.RUnlock()
+	return slices.Clone(detectorOrder)
+}
+
+// LookupDetectors returns the registered detectors with names, in the
+// order given.
+func LookupDetectors(names []string) ([]Detector, error) {
+	detectorsLock.RLock()
+	defer detectorsLock.RUnlock()
+	var found []Detector
+	for _, name := range names {
+		detector, ok := detectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q (available: %s)", name, strings.Join(detectorOrder, ", "))
+		}
+		found = append(found, detector)
+	}
+	return found, nil
+}
+
+// detectorsFor returns the detectors a scan with options runs: its
+// Detectors, or the defaults.
+func detectorsFor(options Options) []Detector {
+	if options.Detectors == nil {
+		return DefaultDetectors()
+	}
+	return options.Detectors
+}
+
+// belowMinConfidence reports whether every finding of detector would be
+// filtered out by the scan's minimum confidence. Only the built-in
+// detectors are known to report nothing above their confidence; others,
+// such as plugins, may set a higher one per finding and always run.
+func belowMinConfidence(detector Detector, options Options) bool {
+	if _, ok := detector.(builtinDetector); !ok {
+		return false
+	}
+	return confidenceRank(detector.Confidence()) < confidenceRank(options.MinConfidence)
+}
+
+func confidenceRank(confidence Confidence) int {
+	switch confidence {
+	case ConfidenceHigh:
+		return 3
+	case ConfidenceMedium:
+		return 2
+	default:
+		return 1
+	}
+}
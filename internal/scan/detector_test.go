@@ -0,0 +1,131 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeDetector struct {
+	name       string
+	confidence Confidence
+	images     []ImageFinding
+	err        error
+	// delay is how long Detect takes.
+	delay time.Duration
+
+	mutex  sync.Mutex
+	charts []string
+}
+
+func (d *fakeDetector) Name() string           { return d.name }
+func (d *fakeDetector) Confidence() Confidence { return d.confidence }
+
+func (d *fakeDetector) Detect(ctx context.Context, chart Chart) ([]ImageFinding, error) {
+	d.mutex.Lock()
+	d.charts = append(d.charts, chart.Path)
+	d.mutex.Unlock()
+	time.Sleep(d.delay)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return append([]ImageFinding(nil), d.images...), nil
+}
+
+// TestScanRunsConfiguredDetectors verifies that a scan runs exactly the
+// detectors in Options.Detectors, fills in their confidence and drops
+// findings below the minimum confidence, keeping those a detector rates
+// above its own confidence.
+func TestScanRunsConfiguredDetectors(t *testing.T) {
+	chart := t.TempDir()
+	custom := &fakeDetector{name: "custom", confidence: ConfidenceMedium, images: []ImageFinding{{Name: "example.com/custom:v1", Source: "custom"}}}
+	low := &fakeDetector{name: "low", confidence: ConfidenceLow, images: []ImageFinding{
+		{Name: "example.com/low:v1"},
+		{Name: "example.com/sure:v1", Confidence: ConfidenceHigh, Source: "low"},
+	}}
+
+	result, err := Scan(Options{ChartPath: chart, MinConfidence: ConfidenceMedium, Detectors: []Detector{custom, low}})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	want := []ImageFinding{
+		{Name: "example.com/custom:v1", Confidence: ConfidenceMedium, Source: "custom"},
+		{Name: "example.com/sure:v1", Confidence: ConfidenceHigh, Source: "low"},
+	}
+	if !reflect.DeepEqual(result.Images, want) {
+		t.Errorf("images = %+v, want %+v", result.Images, want)
+	}
+	if !reflect.DeepEqual(custom.charts, []string{chart}) || !reflect.DeepEqual(low.charts, []string{chart}) {
+		t.Errorf("custom ran on %v, low ran on %v", custom.charts, low.charts)
+	}
+}
+
+func TestDetectorRegistry(t *testing.T) {
+	if got := RegisteredDetectors(); !reflect.DeepEqual(got[:3], []string{DetectorRendered, DetectorStatic, DetectorRegex}) {
+		t.Fatalf("RegisteredDetectors() = %v", got)
+	}
+	if err := RegisterDetector(&fakeDetector{name: DetectorStatic}); err == nil {
+		t.Error("expected an error registering a duplicate name")
+	}
+	if err := RegisterDetector(&fakeDetector{name: "a,b"}); err == nil {
+		t.Error("expected an error registering an invalid name")
+	}
+
+	detectors, err := LookupDetectors([]string{DetectorRegex, DetectorRendered})
+	if err != nil {
+		t.Fatalf("LookupDetectors: %v", err)
+	}
+	if len(detectors) != 2 || detectors[0].Name() != DetectorRegex || detectors[1].Name() != DetectorRendered {
+		t.Errorf("LookupDetectors returned %v", detectors)
+	}
+	if _, err := LookupDetectors([]string{"missing"}); err == nil || !strings.Contains(err.Error(), "available: rendered, static, regex") {
+		t.Errorf("LookupDetectors(missing) error = %v", err)
+	}
+}
+
+// TestScanRecordsDiagnostics verifies that each detector's outcome is
+// reported with the result, and that failures on the chart are listed as
+// detector errors.
+func TestScanRecordsDiagnostics(t *testing.T) {
+	chart := t.TempDir()
+	rendered := &fakeDetector{name: DetectorRendered, confidence: ConfidenceHigh, err: errors.New("template: missing value")}
+	static := &fakeDetector{name: DetectorStatic, confidence: ConfidenceMedium, images: []ImageFinding{{Name: "a:v1"}, {Name: "b:v1"}}}
+	// The built-in regex detector is skipped below its confidence.
+	regex := DefaultDetectors()[2]
+
+	result, err := Scan(Options{ChartPath: chart, MinConfidence: ConfidenceMedium, Detectors: []Detector{rendered, static, regex}})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	diagnostics := result.Diagnostics
+	if diagnostics == nil || diagnostics.RenderedSucceeded || len(diagnostics.Detectors) != 3 {
+		t.Fatalf("diagnostics = %+v", diagnostics)
+	}
+	statuses := []DetectorStatus{}
+	for _, detector := range diagnostics.Detectors {
+		statuses = append(statuses, detector.Status)
+	}
+	if want := []DetectorStatus{DetectorFailed, DetectorOK, DetectorSkipped}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if diagnostics.Detectors[0].Error != "template: missing value" || diagnostics.Detectors[1].Images != 2 {
+		t.Errorf("detectors = %+v", diagnostics.Detectors)
+	}
+	if errs := result.DetectorErrors(); !reflect.DeepEqual(errs, []string{"rendered: template: missing value"}) {
+		t.Errorf("DetectorErrors() = %v", errs)
+	}
+
+	rendered.err = nil
+	rendered.images = []ImageFinding{{Name: "a:v1"}}
+	result, err = Scan(Options{ChartPath: chart, Detectors: []Detector{rendered}})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if !result.Diagnostics.RenderedSucceeded || len(result.DetectorErrors()) != 0 {
+		t.Errorf("diagnostics = %+v", result.Diagnostics)
+	}
+}
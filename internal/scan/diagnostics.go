@@ -0,0 +1,84 @@
+package scan
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DetectorStatus is the outcome of running a detector on a chart.
+type DetectorStatus string
+
+const (
+	DetectorOK      DetectorStatus = "ok"
+	DetectorFailed  DetectorStatus = "failed"
+	DetectorSkipped DetectorStatus = "skipped"
+)
+
+// Diagnostics reports how the detectors fared on a chart, so callers can
+// tell a complete scan from one that fell back to static or regex
+// detection.
+type Diagnostics struct {
+	// RenderedSucceeded is set when the chart rendered with helm, so its
+	// high-confidence images are complete.
+	RenderedSucceeded bool                 `yaml:"renderedSucceeded" json:"renderedSucceeded"`
+	Detectors         []DetectorDiagnostic `yaml:"detectors" json:"detectors"`
+}
+
+// DetectorDiagnostic is the outcome of one detector on the scanned chart
+// or, when Subchart is set, on one of its optional subcharts.
+type DetectorDiagnostic struct {
+	Name           string         `yaml:"name" json:"name"`
+	Subchart       string         `yaml:"subchart,omitempty" json:"subchart,omitempty"`
+	Status         DetectorStatus `yaml:"status" json:"status"`
+	DurationMillis int64          `yaml:"durationMs" json:"durationMs"`
+	Images         int            `yaml:"images" json:"images"`
+	// Error is why the detector failed or was skipped.
+	Error string `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// Failures returns the detectors that failed on the scanned chart itself;
+// failures on optional subcharts, which often cannot be rendered on their
+// own, are left out.
+func (d *Diagnostics) Failures() []DetectorDiagnostic {
+	if d == nil {
+		return nil
+	}
+	var failures []DetectorDiagnostic
+	for _, detector := range d.Detectors {
+		if detector.Status == DetectorFailed && detector.Subchart == "" {
+			failures = append(failures, detector)
+		}
+	}
+	return failures
+}
+
+// DetectorErrors describes every detector failure in the result, including
+// those of its releases, as "detector: error".
+func (r *ScanResult) DetectorErrors() []string {
+	var errs []string
+	for _, failure := range r.Diagnostics.Failures() {
+		errs = append(errs, fmt.Sprintf("%s: %s", failure.Name, failure.Error))
+	}
+	for _, release := range r.Releases {
+		for _, failure := range release.Diagnostics.Failures() {
+			errs = append(errs, fmt.Sprintf("release %s: %s: %s", release.Name, failure.Name, failure.Error))
+		}
+	}
+	return errs
+}
+
+func newDetectorDiagnostic(detector Detector, subchart string, started time.Time, images []ImageFinding, err error) DetectorDiagnostic {
+	diagnostic := DetectorDiagnostic{
+		Name:           detector.Name(),
+		Subchart:       subchart,
+		Status:         DetectorOK,
+		DurationMillis: time.Since(started).Milliseconds(),
+		Images:         len(images),
+	}
+	if err != nil {
+		diagnostic.Status = DetectorFailed
+		diagnostic.Error = strings.TrimSpace(err.Error())
+	}
+	return diagnostic
+}
@@ -0,0 +1,302 @@
+package scan
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of GitOps objects that declare releases.
+const (
+	KindApplication = "Application"
+	KindHelmRelease = "HelmRelease"
+)
+
+// manifestObject is a Kubernetes object decoded from a manifest.
+type manifestObject map[string]any
+
+func (o manifestObject) kind() string       { return stringField(o, "kind") }
+func (o manifestObject) apiVersion() string { return stringField(o, "apiVersion") }
+func (o manifestObject) name() string       { return stringField(mapField(o, "metadata"), "name") }
+func (o manifestObject) namespace() string  { return stringField(mapField(o, "metadata"), "namespace") }
+
+// decodeObjects decodes every object in a YAML stream, expanding Lists.
+// Documents that do not parse are skipped.
+func decodeObjects(data []byte) []manifestObject {
+	var objects []manifestObject
+	for _, document := range splitDocuments(data) {
+		var object map[string]any
+		if err := yaml.Unmarshal(document.data, &object); err != nil || object == nil {
+			continue
+		}
+		objects = append(objects, expandList(object)...)
+	}
+	return objects
+}
+
+func expandList(object map[string]any) []manifestObject {
+	if !strings.HasSuffix(stringField(object, "kind"), "List") {
+		return []manifestObject{object}
+	}
+	var objects []manifestObject
+	items, _ := object["items"].([]any)
+	for _, item := range items {
+		if itemObject, ok := item.(map[string]any); ok {
+			objects = append(objects, expandList(itemObject)...)
+		}
+	}
+	return objects
+}
+
+// releasesFromObjects returns a release for each Helm chart deployed by an
+// Argo CD Application or a Flux HelmRelease among objects. The
+// HelmRepository, OCIRepository, ConfigMap and Secret objects they refer to
+// are looked up among objects too. Releases that cannot be resolved are
+// reported as warnings and skipped.
+func releasesFromObjects(objects []manifestObject, logger *slog.Logger) []Release {
+	var releases []Release
+	for _, object := range objects {
+		group, _, _ := strings.Cut(object.apiVersion(), "/")
+		var found []Release
+		var err error
+		switch {
+		case object.kind() == KindApplication && group == "argoproj.io":
+			found, err = applicationReleases(object, logger)
+		case object.kind() == KindHelmRelease && group == "helm.toolkit.fluxcd.io":
+			var release Release
+			if release, err = helmReleaseRelease(object, objects); err == nil {
+				found = []Release{release}
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			logger.Warn("skipping release", "kind", object.kind(), "name", object.name(), "error", err)
+			continue
+		}
+		releases = append(releases, found...)
+	}
+	return releases
+}
+
+// applicationReleases returns the Helm chart sources of an Argo CD
+// Application. Sources from Git repositories are skipped with a warning.
+func applicationReleases(application manifestObject, logger *slog.Logger) ([]Release, error) {
+	spec := mapField(application, "spec")
+	sources := []any{}
+	if source := mapField(spec, "source"); source != nil {
+		sources = append(sources, source)
+	}
+	if list, ok := spec["sources"].([]any); ok {
+		sources = append(sources, list...)
+	}
+
+	var charts []map[string]any
+	for _, source := range sources {
+		source, _ := source.(map[string]any)
+		if stringField(source, "chart") == "" {
+			logger.Warn("skipping source that is not a Helm chart repository", "kind", KindApplication, "name", application.name(), "repoURL", stringField(source, "repoURL"))
+			continue
+		}
+		charts = append(charts, source)
+	}
+	if len(charts) == 0 {
+		return nil, fmt.Errorf("no Helm chart sources")
+	}
+
+	var releases []Release
+	for _, source := range charts {
+		chart := stringField(source, "chart")
+		release := Release{
+			Name:       application.name(),
+			Kind:       KindApplication,
+			Namespace:  stringField(mapField(spec, "destination"), "namespace"),
+			Repository: stringField(source, "repoURL"),
+			Chart:      chart,
+			Version:    stringField(source, "targetRevision"),
+		}
+		if len(charts) > 1 {
+			release.Name += "/" + chart
+		}
+		// Argo CD takes OCI repositories without a scheme.
+		if !strings.Contains(release.Repository, "://") {
+			release.Repository = "oci://" + release.Repository
+		}
+
+		helm := mapField(source, "helm")
+		if files, _ := helm["valueFiles"].([]any); len(files) > 0 {
+			logger.Warn("valueFiles are not supported and are ignored", "kind", KindApplication, "name", application.name())
+		}
+		if text := stringField(helm, "values"); text != "" {
+			var values map[string]any
+			if err := yaml.Unmarshal([]byte(text), &values); err != nil {
+				return nil, fmt.Errorf("parse helm.values: %w", err)
+			}
+			release.Values = append(release.Values, values)
+		}
+		if values := mapField(helm, "valuesObject"); values != nil {
+			release.Values = append(release.Values, values)
+		}
+		parameters, _ := helm["parameters"].([]any)
+		for _, parameter := range parameters {
+			parameter, _ := parameter.(map[string]any)
+			flag := "--set="
+			if forceString, _ := parameter["forceString"].(bool); forceString {
+				flag = "--set-string="
+			}
+			release.Set = append(release.Set, flag+stringField(parameter, "name")+"="+stringField(parameter, "value"))
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// helmReleaseRelease returns the chart and values of a Flux HelmRelease,
+// resolving its source and valuesFrom references among objects.
+func helmReleaseRelease(helmRelease manifestObject, objects []manifestObject) (Release, error) {
+	spec := mapField(helmRelease, "spec")
+	namespace := helmRelease.namespace()
+	release := Release{
+		Name:      helmRelease.name(),
+		Kind:      KindHelmRelease,
+		Namespace: namespace,
+	}
+	if target := stringField(spec, "targetNamespace"); target != "" {
+		release.Namespace = target
+	}
+
+	if chartRef := mapField(spec, "chartRef"); chartRef != nil {
+		if kind := stringField(chartRef, "kind"); kind != "OCIRepository" {
+			return release, fmt.Errorf("chartRef of kind %q is not supported", kind)
+		}
+		repository, err := findObject(objects, "OCIRepository", stringField(chartRef, "name"), referenceNamespace(chartRef, namespace))
+		if err != nil {
+			return release, err
+		}
+		release.Chart = stringField(mapField(repository, "spec"), "url")
+		ref := mapField(mapField(repository, "spec"), "ref")
+		switch {
+		case stringField(ref, "digest") != "":
+			release.Chart += "@" + stringField(ref, "digest")
+		case stringField(ref, "tag") != "":
+			release.Chart += ":" + stringField(ref, "tag")
+		case stringField(ref, "semver") != "":
+			return release, fmt.Errorf("OCIRepository %q selects its tag by semver, which is not supported", repository.name())
+		}
+	} else {
+		chartSpec := mapField(mapField(spec, "chart"), "spec")
+		sourceRef := mapField(chartSpec, "sourceRef")
+		if kind := stringField(sourceRef, "kind"); kind != "HelmRepository" {
+			return release, fmt.Errorf("charts from a %s are not supported", kind)
+		}
+		repository, err := findObject(objects, "HelmRepository", stringField(sourceRef, "name"), referenceNamespace(sourceRef, namespace))
+		if err != nil {
+			return release, err
+		}
+		release.Repository = stringField(mapField(repository, "spec"), "url")
+		release.Chart = stringField(chartSpec, "chart")
+		release.Version = stringField(chartSpec, "version")
+	}
+	if release.Chart == "" {
+		return release, fmt.Errorf("no chart")
+	}
+
+	valuesFrom, _ := spec["valuesFrom"].([]any)
+	for _, reference := range valuesFrom {
+		reference, _ := reference.(map[string]any)
+		value, err := referencedValue(objects, reference, namespace)
+		if err != nil {
+			if optional, _ := reference["optional"].(bool); optional {
+				continue
+			}
+			return release, err
+		}
+		if targetPath := stringField(reference, "targetPath"); targetPath != "" {
+			release.Set = append(release.Set, "--set-string="+targetPath+"="+value)
+			continue
+		}
+		var values map[string]any
+		if err := yaml.Unmarshal([]byte(value), &values); err != nil {
+			return release, fmt.Errorf("parse values from %s %q: %w", stringField(reference, "kind"), stringField(reference, "name"), err)
+		}
+		release.Values = append(release.Values, values)
+	}
+	if values := mapField(spec, "values"); values != nil {
+		release.Values = append(release.Values, values)
+	}
+	return release, nil
+}
+
+// referencedValue returns the value a HelmRelease valuesFrom entry points
+// at in a ConfigMap or Secret.
+func referencedValue(objects []manifestObject, reference map[string]any, namespace string) (string, error) {
+	kind, name := stringField(reference, "kind"), stringField(reference, "name")
+	if kind != "ConfigMap" && kind != "Secret" {
+		return "", fmt.Errorf("valuesFrom of kind %q is not supported", kind)
+	}
+	object, err := findObject(objects, kind, name, namespace)
+	if err != nil {
+		return "", err
+	}
+	key := stringField(reference, "valuesKey")
+	if key == "" {
+		key = "values.yaml"
+	}
+	if kind == "Secret" {
+		if value, ok := mapField(object, "stringData")[key].(string); ok {
+			return value, nil
+		}
+		if encoded, ok := mapField(object, "data")[key].(string); ok {
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return "", fmt.Errorf("decode %s %q key %q: %w", kind, name, key, err)
+			}
+			return string(decoded), nil
+		}
+	} else if value, ok := mapField(object, "data")[key].(string); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("%s %q has no key %q", kind, name, key)
+}
+
+// findObject returns the object of kind and name in namespace. Objects
+// without a namespace match any namespace.
+func findObject(objects []manifestObject, kind, name, namespace string) (manifestObject, error) {
+	for _, object := range objects {
+		if object.kind() != kind || object.name() != name {
+			continue
+		}
+		if object.namespace() == "" || namespace == "" || object.namespace() == namespace {
+			return object, nil
+		}
+	}
+	return nil, fmt.Errorf("%s %q not found in the input", kind, name)
+}
+
+// referenceNamespace returns the namespace of a Flux object reference,
+// which defaults to the referring object's namespace.
+func referenceNamespace(reference map[string]any, namespace string) string {
+	if referenced := stringField(reference, "namespace"); referenced != "" {
+		return referenced
+	}
+	return namespace
+}
+
+func mapField(object map[string]any, key string) map[string]any {
+	value, _ := object[key].(map[string]any)
+	return value
+}
+
+func stringField(object map[string]any, key string) string {
+	switch value := object[key].(type) {
+	case string:
+		return value
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
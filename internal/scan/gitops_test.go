@@ -0,0 +1,239 @@
+package scan
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testGitOpsManifests = `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: redis
+  namespace: argocd
+spec:
+  destination:
+    namespace: cache
+  source:
+    repoURL: registry-1.docker.io/bitnamicharts
+    chart: redis
+    targetRevision: 19.0.1
+    helm:
+      values: |
+        architecture: standalone
+      valuesObject:
+        auth:
+          enabled: false
+      parameters:
+        - name: image.tag
+          value: "7.2"
+          forceString: true
+---
+apiVersion: source.toolkit.fluxcd.io/v1
+kind: HelmRepository
+metadata:
+  name: podinfo
+  namespace: flux-system
+spec:
+  url: https://stefanprodan.github.io/podinfo
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: podinfo-values
+  namespace: flux-system
+data:
+  values.yaml: |
+    replicaCount: 2
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: podinfo-secret
+  namespace: flux-system
+data:
+  token: c2VjcmV0
+---
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: podinfo
+  namespace: flux-system
+spec:
+  targetNamespace: apps
+  chart:
+    spec:
+      chart: podinfo
+      version: ">=6.0.0"
+      sourceRef:
+        kind: HelmRepository
+        name: podinfo
+  valuesFrom:
+    - kind: ConfigMap
+      name: podinfo-values
+    - kind: Secret
+      name: podinfo-secret
+      valuesKey: token
+      targetPath: auth.token
+    - kind: ConfigMap
+      name: missing
+      optional: true
+  values:
+    ui:
+      color: blue
+---
+apiVersion: source.toolkit.fluxcd.io/v1beta2
+kind: OCIRepository
+metadata:
+  name: nginx
+  namespace: flux-system
+spec:
+  url: oci://ghcr.io/org/charts/nginx
+  ref:
+    tag: 1.2.3
+---
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: nginx
+  namespace: flux-system
+spec:
+  chartRef:
+    kind: OCIRepository
+    name: nginx
+`
+
+// TestReleasesFromObjects verifies that Applications and HelmReleases are
+// turned into releases with their chart, values and parameters, resolving
+// Flux sources and valuesFrom among the input objects.
+func TestReleasesFromObjects(t *testing.T) {
+	releases := releasesFromObjects(decodeObjects([]byte(testGitOpsManifests)), slog.New(slog.DiscardHandler))
+	want := []Release{
+		{
+			Name:       "redis",
+			Kind:       KindApplication,
+			Namespace:  "cache",
+			Repository: "oci://registry-1.docker.io/bitnamicharts",
+			Chart:      "redis",
+			Version:    "19.0.1",
+			Values: []map[string]any{
+				{"architecture": "standalone"},
+				{"auth": map[string]any{"enabled": false}},
+			},
+			Set: []string{"--set-string=image.tag=7.2"},
+		},
+		{
+			Name:       "podinfo",
+			Kind:       KindHelmRelease,
+			Namespace:  "apps",
+			Repository: "https://stefanprodan.github.io/podinfo",
+			Chart:      "podinfo",
+			Version:    ">=6.0.0",
+			Values: []map[string]any{
+				{"replicaCount": 2},
+				{"ui": map[string]any{"color": "blue"}},
+			},
+			Set: []string{"--set-string=auth.token=secret"},
+		},
+		{
+			Name:      "nginx",
+			Kind:      KindHelmRelease,
+			Namespace: "flux-system",
+			Chart:     "oci://ghcr.io/org/charts/nginx:1.2.3",
+		},
+	}
+	if !reflect.DeepEqual(releases, want) {
+		t.Fatalf("releases = %#v, want %#v", releases, want)
+	}
+}
+
+// TestScanHelmReleaseFetchesChartFromRepository verifies that a manifest
+// with a HelmRelease scans the chart from its HelmRepository and labels
+// the result with the release, alongside the plain workloads in the file.
+func TestScanHelmReleaseFetchesChartFromRepository(t *testing.T) {
+	archive := createTestTarGz(t, map[string]string{
+		"web/Chart.yaml":  "apiVersion: v2\nname: web\nversion: 1.1.0\n",
+		"web/values.yaml": "image:\n  repository: ghcr.io/org/web\n  tag: v1.1.0\n",
+	})
+	defer os.Remove(archive)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			w.Write([]byte(`entries:
+  web:
+    - version: 1.1.0
+      urls: [charts/web-1.1.0.tgz]
+    - version: 1.0.0
+      urls: [charts/web-1.0.0.tgz]
+`))
+		case "/charts/web-1.1.0.tgz":
+			http.ServeFile(w, r, archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	manifests := `apiVersion: source.toolkit.fluxcd.io/v1
+kind: HelmRepository
+metadata:
+  name: charts
+spec:
+  url: ` + server.URL + `
+---
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: web
+spec:
+  chart:
+    spec:
+      chart: web
+      version: 1.x
+      sourceRef:
+        kind: HelmRepository
+        name: charts
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+spec:
+  containers:
+    - name: shell
+      image: alpine:3.19
+`
+	path := filepath.Join(t.TempDir(), "releases.yaml")
+	if err := os.WriteFile(path, []byte(manifests), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ScanContext(context.Background(), Options{ChartPath: path, HelmBin: "false"})
+	if err != nil {
+		t.Fatalf("ScanContext: %v", err)
+	}
+	if len(result.Releases) != 1 {
+		t.Fatalf("releases = %+v, want one", result.Releases)
+	}
+	release := result.Releases[0]
+	if release.Name != "web" || release.Kind != KindHelmRelease || !strings.HasSuffix(release.ChartRef, "/charts/web-1.1.0.tgz") {
+		t.Errorf("release = %+v", release)
+	}
+	if release.Chart == nil || release.Chart.Version != "1.1.0" {
+		t.Errorf("release chart = %+v, want version 1.1.0", release.Chart)
+	}
+
+	var names []string
+	for _, image := range result.Images {
+		names = append(names, image.Name)
+	}
+	if want := []string{"alpine:3.19", "ghcr.io/org/web:v1.1.0"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("images = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,25 @@
+package scan
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// logWriter receives the log of scans whose Options carry no Logger. It is
+// a variable so tests can capture it.
+var logWriter io.Writer = os.Stderr
+
+// logger returns the scan's logger: Options.Logger or, without one, a text
+// logger on stderr that reports warnings, and debug messages when Verbose
+// is set.
+func (o Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	level := slog.LevelWarn
+	if o.Verbose {
+		level = slog.LevelDebug
+	}
+	return slog.New(slog.NewTextHandler(logWriter, &slog.HandlerOptions{Level: level}))
+}
@@ -0,0 +1,340 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// stdin is read when the chart reference is "-". It is a variable so
+// tests can substitute it.
+var stdin io.Reader = os.Stdin
+
+// inputKind is what a scan reference points at.
+type inputKind int
+
+const (
+	inputChart inputKind = iota
+	inputManifests
+	inputKustomization
+	inputStdin
+)
+
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// inputKindOf classifies ref. Remote references, packaged charts and
+// directories with a Chart.yaml, values.yaml or templates directory are
+// charts; "-" is stdin; directories with a kustomization file are Kustomize
+// overlays; other YAML or JSON files, and directories holding them, are
+// plain manifests.
+func inputKindOf(ref string) inputKind {
+	if ref == "-" {
+		return inputStdin
+	}
+	if isRemoteChartRef(ref) {
+		return inputChart
+	}
+	info, err := os.Stat(ref)
+	if err != nil {
+		return inputChart
+	}
+	if !info.IsDir() {
+		if isManifestFile(ref) {
+			return inputManifests
+		}
+		return inputChart
+	}
+	for _, name := range []string{"Chart.yaml", "values.yaml", "templates"} {
+		if _, err := os.Stat(filepath.Join(ref, name)); err == nil {
+			return inputChart
+		}
+	}
+	for _, name := range kustomizationFiles {
+		if _, err := os.Stat(filepath.Join(ref, name)); err == nil {
+			return inputKustomization
+		}
+	}
+	// A directory without manifests is left to helm, which reports why it
+	// is not a chart.
+	if entries, _ := os.ReadDir(ref); slices.ContainsFunc(entries, func(entry os.DirEntry) bool {
+		return !entry.IsDir() && isManifestFile(entry.Name())
+	}) {
+		return inputManifests
+	}
+	return inputChart
+}
+
+func isManifestFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// scanManifestInput extracts images from plain manifests, stdin or a
+// Kustomize build instead of a chart. When the input declares releases,
+// such as Argo CD Applications or Flux HelmReleases, their charts are
+// scanned with their values too. Otherwise Helm values do not apply to
+// these inputs and are ignored.
+func scanManifestInput(ctx context.Context, kind inputKind, options Options) (*ScanResult, error) {
+	var images []ImageFinding
+	var objects []manifestObject
+	switch kind {
+	case inputStdin:
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read manifests from stdin: %w", err)
+		}
+		images = imagesFromManifests(data, "", SourceManifest)
+		objects = decodeObjects(data)
+	case inputKustomization:
+		data, err := buildKustomization(options.ChartPath)
+		if err != nil {
+			return nil, err
+		}
+		images = imagesFromManifests(data, "", SourceKustomize)
+		objects = decodeObjects(data)
+	default:
+		var err error
+		if images, objects, err = readManifestPath(options.ChartPath); err != nil {
+			return nil, err
+		}
+	}
+	logger := options.logger()
+	logger.Debug("read manifests", "input", options.ChartPath, "images", len(images))
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("scan of %q interrupted: %w", options.ChartPath, err)
+	}
+	if releases := releasesFromObjects(objects, logger); len(releases) > 0 {
+		return scanManifestReleases(ctx, releases, images, options)
+	}
+
+	if len(options.Values) > 0 || len(options.ValuesFiles) > 0 {
+		logger.Warn("Helm values are ignored for inputs that are not charts", "input", options.ChartPath)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("%w in %q", ErrNoImages, options.ChartPath)
+	}
+	return finalizeManifestImages(ctx, images, options)
+}
+
+// scanManifestReleases scans the releases declared by manifests and adds
+// the images of the workloads declared alongside them.
+func scanManifestReleases(ctx context.Context, releases []Release, images []ImageFinding, options Options) (*ScanResult, error) {
+	result, err := ScanReleases(ctx, releases, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) > 0 {
+		workloads, err := finalizeManifestImages(ctx, images, options)
+		if err != nil {
+			return nil, err
+		}
+		result.Images = distinctImages(append(result.Images, workloads.Images...))
+	}
+	return result, nil
+}
+
+func finalizeManifestImages(ctx context.Context, images []ImageFinding, options Options) (*ScanResult, error) {
+	result, err := finalizeScanResult(images, nil, options.MinConfidence, options.logger())
+	if err != nil {
+		return nil, err
+	}
+	if options.ResolveDigests || options.ResolvePlatforms {
+		if err := resolveImages(ctx, result.Images, options); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// readManifestPath reads a manifest file, or every YAML and JSON file
+// under a directory, and returns the images and objects they contain.
+func readManifestPath(root string) ([]ImageFinding, []manifestObject, error) {
+	var images []ImageFinding
+	var objects []manifestObject
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isManifestFile(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		images = append(images, imagesFromManifests(data, path, SourceManifest)...)
+		objects = append(objects, decodeObjects(data)...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("read manifests: %w", err)
+	}
+	return images, objects, nil
+}
+
+// buildKustomization renders a Kustomize directory in-process, applying
+// its images transformers, and returns the resulting YAML stream.
+func buildKustomization(path string) ([]byte, error) {
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := kustomizer.Run(filesys.MakeFsOnDisk(), path)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize build %s: %w", path, err)
+	}
+	data, err := resources.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("kustomize build %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// imagesFromManifests extracts the container images of the workloads in a
+// YAML stream of Kubernetes objects. Documents that do not parse are
+// skipped. When file is set, findings record it and the line of each
+// image.
+func imagesFromManifests(data []byte, file string, source SourceKind) []ImageFinding {
+	var images []ImageFinding
+	for _, document := range splitDocuments(data) {
+		var root yaml.Node
+		if err := yaml.Unmarshal(document.data, &root); err != nil || len(root.Content) == 0 {
+			continue
+		}
+		collectObjectImages(root.Content[0], func(image ImageFinding, line int) {
+			image.Source = source
+			if file != "" {
+				image.File = file
+				image.Line = document.line + line - 1
+			}
+			images = append(images, image)
+		})
+	}
+	return images
+}
+
+type manifestDocument struct {
+	data []byte
+	// line is the line of the file the document starts on.
+	line int
+}
+
+// splitDocuments splits a YAML stream at "---" separator lines, keeping
+// the starting line of each document.
+func splitDocuments(data []byte) []manifestDocument {
+	var documents []manifestDocument
+	start, startLine := 0, 1
+	line := 1
+	for offset := 0; offset < len(data); line++ {
+		end := bytes.IndexByte(data[offset:], '\n')
+		next := len(data)
+		if end != -1 {
+			next = offset + end + 1
+		}
+		text := strings.TrimRight(string(data[offset:next]), "\r\n")
+		if text == "---" || strings.HasPrefix(text, "--- ") {
+			documents = append(documents, manifestDocument{data: data[start:offset], line: startLine})
+			start, startLine = next, line+1
+		}
+		offset = next
+	}
+	documents = append(documents, manifestDocument{data: data[start:], line: startLine})
+	return documents
+}
+
+// podSpecPaths lists where each workload kind keeps its pod spec.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// collectObjectImages calls found for each container image in object, or
+// in the items of a List.
+func collectObjectImages(object *yaml.Node, found func(ImageFinding, int)) {
+	kind := scalarValue(mappingValue(object, "kind"))
+	if kind == "" {
+		return
+	}
+	if strings.HasSuffix(kind, "List") {
+		if items := mappingValue(object, "items"); items != nil && items.Kind == yaml.SequenceNode {
+			for _, item := range items.Content {
+				collectObjectImages(item, found)
+			}
+		}
+		return
+	}
+	path, ok := podSpecPaths[kind]
+	if !ok {
+		return
+	}
+	podSpec := object
+	for _, key := range path {
+		podSpec = mappingValue(podSpec, key)
+	}
+	if podSpec == nil {
+		return
+	}
+
+	metadata := mappingValue(object, "metadata")
+	name := scalarValue(mappingValue(metadata, "name"))
+	namespace := scalarValue(mappingValue(metadata, "namespace"))
+	for _, field := range []string{"containers", "initContainers", "ephemeralContainers"} {
+		containers := mappingValue(podSpec, field)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, container := range containers.Content {
+			image := mappingValue(container, "image")
+			if scalarValue(image) == "" {
+				continue
+			}
+			found(ImageFinding{
+				Name:       image.Value,
+				Confidence: ConfidenceHigh,
+				Resource: &Resource{
+					Kind:      kind,
+					Name:      name,
+					Namespace: namespace,
+					Container: scalarValue(mappingValue(container, "name")),
+				},
+			}, image.Line)
+		}
+	}
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// scalarValue returns the value of a scalar node, or "".
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
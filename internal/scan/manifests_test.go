@@ -0,0 +1,129 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: apps
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: ghcr.io/org/web:v1
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+            - name: init
+              image: busybox:1.36
+---
+apiVersion: v1
+kind: List
+items:
+  - kind: Pod
+    metadata:
+      name: debug
+    spec:
+      containers:
+        - name: shell
+          image: alpine:3.19
+`
+
+// TestScanManifestFileReportsLinesAndResources verifies that a plain
+// manifest file is scanned without helm, including CronJobs and Lists,
+// with the file and line of each image.
+func TestScanManifestFileReportsLinesAndResources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(testManifests), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ScanContext(context.Background(), Options{ChartPath: path, HelmBin: "/nonexistent/helm"})
+	if err != nil {
+		t.Fatalf("ScanContext() returned error: %v", err)
+	}
+
+	lines := map[string]int{}
+	for _, image := range result.Images {
+		if image.Source != SourceManifest || image.File != path || image.Confidence != ConfidenceHigh {
+			t.Fatalf("unexpected finding: %+v", image)
+		}
+		lines[image.Name] = image.Line
+	}
+	want := map[string]int{"ghcr.io/org/web:v1": 11, "busybox:1.36": 24, "alpine:3.19": 35}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("unexpected image lines: %v", lines)
+	}
+	if result.Images[0].Resource == nil {
+		t.Fatalf("expected resources on findings")
+	}
+}
+
+// TestScanManifestDirectoryAndStdin verifies that directories of manifests
+// and "-" for stdin are scanned.
+func TestScanManifestDirectoryAndStdin(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(directory, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, "nested", "pod.yml"), []byte("kind: Pod\nspec:\n  containers:\n    - image: nginx:1.25\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ScanContext(context.Background(), Options{ChartPath: directory})
+	if err != nil {
+		t.Fatalf("ScanContext() returned error: %v", err)
+	}
+	if len(result.Images) != 1 || result.Images[0].Name != "nginx:1.25" {
+		t.Fatalf("unexpected images: %+v", result.Images)
+	}
+
+	old := stdin
+	defer func() { stdin = old }()
+	stdin = strings.NewReader(testManifests)
+	result, err = ScanContext(context.Background(), Options{ChartPath: "-"})
+	if err != nil {
+		t.Fatalf("ScanContext() returned error: %v", err)
+	}
+	if len(result.Images) != 3 || result.Images[0].File != "" {
+		t.Fatalf("unexpected images from stdin: %+v", result.Images)
+	}
+}
+
+// TestScanKustomizationAppliesImageTransformers verifies that Kustomize
+// directories are built in-process with their images transformers.
+func TestScanKustomizationAppliesImageTransformers(t *testing.T) {
+	directory := t.TempDir()
+	for name, content := range map[string]string{
+		"kustomization.yaml": "resources:\n  - deployment.yaml\nimages:\n  - name: ghcr.io/org/web\n    newName: mirror.internal/org/web\n    newTag: v2\n",
+		"deployment.yaml":    strings.SplitN(testManifests, "---", 2)[0],
+	} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := ScanContext(context.Background(), Options{ChartPath: directory})
+	if err != nil {
+		t.Fatalf("ScanContext() returned error: %v", err)
+	}
+	if len(result.Images) != 1 || result.Images[0].Name != "mirror.internal/org/web:v2" || result.Images[0].Source != SourceKustomize {
+		t.Fatalf("unexpected images: %+v", result.Images)
+	}
+}
@@ -0,0 +1,56 @@
+package scan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tonur/heft/internal/registry"
+)
+
+// CheckPlatforms returns an error naming every image that does not support
+// all of the required platforms (for example "linux/arm64"). Images whose
+// platforms could not be resolved count as unsupported. Images must have
+// been scanned with ResolvePlatforms enabled.
+func CheckPlatforms(images []ImageFinding, required []string) error {
+	var wanted []registry.Platform
+	for _, value := range required {
+		platform, err := registry.ParsePlatform(value)
+		if err != nil {
+			return err
+		}
+		wanted = append(wanted, platform)
+	}
+
+	var problems []string
+	for _, image := range images {
+		if image.ResolveError != "" {
+			problems = append(problems, fmt.Sprintf("%s: platforms unknown: %s", image.Name, image.ResolveError))
+			continue
+		}
+
+		var missing []string
+		for _, platform := range wanted {
+			if !supportsPlatform(image.Platforms, platform) {
+				missing = append(missing, platform.String())
+			}
+		}
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: missing %s (has %s)", image.Name, strings.Join(missing, ", "), strings.Join(image.Platforms, ", ")))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d image(s) lack required platforms:\n  %s", len(problems), strings.Join(problems, "\n  "))
+}
+
+func supportsPlatform(platforms []string, required registry.Platform) bool {
+	for _, value := range platforms {
+		platform, err := registry.ParsePlatform(value)
+		if err == nil && platform.Satisfies(required) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package scan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPlatforms(t *testing.T) {
+	images := []ImageFinding{
+		{Name: "multi", Platforms: []string{"linux/amd64", "linux/arm64/v8"}},
+		{Name: "single", Platforms: []string{"linux/amd64"}},
+		{Name: "unknown", ResolveError: "manifest unknown"},
+	}
+
+	if err := CheckPlatforms(images[:1], []string{"linux/amd64", "linux/arm64"}); err != nil {
+		t.Fatalf("expected multi-arch image to satisfy requirements, got %v", err)
+	}
+
+	err := CheckPlatforms(images, []string{"linux/arm64"})
+	if err == nil {
+		t.Fatalf("expected error for images lacking linux/arm64")
+	}
+	message := err.Error()
+	if !strings.Contains(message, "2 image(s)") || !strings.Contains(message, "single: missing linux/arm64") || !strings.Contains(message, "unknown: platforms unknown") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(message, "multi:") {
+		t.Fatalf("multi-arch image should not be reported: %v", err)
+	}
+
+	if err := CheckPlatforms(images, []string{"arm64"}); err == nil {
+		t.Fatalf("expected error for invalid platform")
+	}
+}
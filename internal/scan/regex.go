@@ -1,6 +1,7 @@
 package scan
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
@@ -10,7 +11,7 @@ import (
 )
 
 // detectRegex performs a heuristic scan for image-like patterns in chart files.
-func detectRegex(opts Options) ([]ImageFinding, error) {
+func detectRegex(ctx context.Context, opts Options) ([]ImageFinding, error) {
 	var results []ImageFinding
 
 	root := opts.ChartPath
@@ -34,6 +35,9 @@ func detectRegex(opts Options) ([]ImageFinding, error) {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if d.IsDir() {
 			return nil
 		}
@@ -61,7 +65,7 @@ func detectRegex(opts Options) ([]ImageFinding, error) {
 				results = append(results, ImageFinding{
 					Name:       m,
 					Confidence: ConfidenceLow,
-					Source:     SourceKind("regex-scan"),
+					Source:     SourceRegex,
 					File:       path,
 					Line:       i + 1,
 				})
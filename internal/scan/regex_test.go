@@ -1,13 +1,14 @@
 package scan
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
 )
 
 func TestDetectRegexEmptyChartPath(t *testing.T) {
-	if _, err := detectRegex(Options{ChartPath: ""}); err == nil {
+	if _, err := detectRegex(context.Background(), Options{ChartPath: ""}); err == nil {
 		t.Fatalf("expected error for empty chart path, got nil")
 	}
 }
@@ -48,7 +49,7 @@ func TestDetectRegexSkipsTestsAndSnapshotsAndFiltersJunk(t *testing.T) {
 		t.Fatalf("WriteFile junk.yaml: %v", err)
 	}
 
-	results, err := detectRegex(Options{ChartPath: root})
+	results, err := detectRegex(context.Background(), Options{ChartPath: root})
 	if err != nil {
 		t.Fatalf("detectRegex error: %v", err)
 	}
@@ -0,0 +1,134 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Release is a chart deployed with its own values, as declared by an Argo
+// CD Application, a Flux HelmRelease or a helmfile.
+type Release struct {
+	Name      string
+	Kind      string
+	Namespace string
+	// Chart is a chart reference as accepted by Options.ChartPath. When
+	// Repository is set, Chart is the chart's name in that repository and
+	// Version its version constraint.
+	Chart      string
+	Repository string
+	Version    string
+	// Values are values documents applied in order, before the values in
+	// Options.
+	Values []map[string]any
+	// Set holds Helm --set style flags, as in Options.Values.
+	Set []string
+}
+
+// ScanReleases scans the chart of every release with its values and the
+// scan options, and returns a result with one ReleaseResult per release
+// and the distinct images of all of them. A release that fails is recorded
+// with its error; an error is returned only if every release failed.
+func ScanReleases(ctx context.Context, releases []Release, options Options) (*ScanResult, error) {
+	result := &ScanResult{Images: []ImageFinding{}}
+	var errs []error
+	for _, release := range releases {
+		released, err := scanRelease(ctx, release, options)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("scan of release %q interrupted: %w", release.Name, ctx.Err())
+			}
+			released.Error = err.Error()
+			errs = append(errs, fmt.Errorf("release %q: %w", release.Name, err))
+			options.logger().Warn("release failed", "release", release.Name, "kind", release.Kind, "error", err)
+		}
+		result.Releases = append(result.Releases, released)
+		result.Images = append(result.Images, released.Images...)
+	}
+	if len(releases) > 0 && len(errs) == len(releases) {
+		return nil, errors.Join(errs...)
+	}
+	result.Images = distinctImages(result.Images)
+	return result, nil
+}
+
+func scanRelease(ctx context.Context, release Release, options Options) (ReleaseResult, error) {
+	released := ReleaseResult{Name: release.Name, Kind: release.Kind, Namespace: release.Namespace, ChartRef: release.Chart, Images: []ImageFinding{}}
+	if release.Repository != "" {
+		ref, err := RepositoryChartRef(ctx, release.Repository, release.Chart, release.Version)
+		if err != nil {
+			return released, err
+		}
+		released.ChartRef = ref
+	}
+
+	valuesFiles, cleanup, err := writeReleaseValues(release.Values)
+	if err != nil {
+		return released, err
+	}
+	defer cleanup()
+
+	releaseOptions := options
+	releaseOptions.ChartPath = released.ChartRef
+	releaseOptions.ValuesFiles = append(valuesFiles, options.ValuesFiles...)
+	releaseOptions.Values = append(append([]string(nil), release.Set...), options.Values...)
+	options.logger().Debug("scanning release", "release", release.Name, "kind", release.Kind, "chart", released.ChartRef)
+	scanned, err := ScanContext(ctx, releaseOptions)
+	if err != nil {
+		return released, err
+	}
+	released.Chart = scanned.Chart
+	released.Images = scanned.Images
+	released.Diagnostics = scanned.Diagnostics
+	return released, nil
+}
+
+// writeReleaseValues writes each values document to a temporary file and
+// returns them as Helm --values flags.
+func writeReleaseValues(values []map[string]any) ([]string, func(), error) {
+	if len(values) == 0 {
+		return nil, func() {}, nil
+	}
+	directory, err := os.MkdirTemp("", "heft-release-values-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(directory) }
+
+	var flags []string
+	for i, document := range values {
+		data, err := yaml.Marshal(document)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("encode release values: %w", err)
+		}
+		path := filepath.Join(directory, fmt.Sprintf("values-%d.yaml", i))
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("write release values: %w", err)
+		}
+		flags = append(flags, "--values="+path)
+	}
+	return flags, cleanup, nil
+}
+
+// distinctImages removes findings with the same name, keeping the first,
+// and sorts them by name. Unlike dedupeImages it keeps different tags of a
+// repository, which different releases may well use.
+func distinctImages(images []ImageFinding) []ImageFinding {
+	seen := map[string]bool{}
+	distinct := []ImageFinding{}
+	for _, image := range images {
+		if !seen[image.Name] {
+			seen[image.Name] = true
+			distinct = append(distinct, image)
+		}
+	}
+	sort.SliceStable(distinct, func(i, j int) bool { return distinct[i].Name < distinct[j].Name })
+	return distinct
+}
@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,23 +18,50 @@ func isRemoteChartRef(ref string) bool {
 	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "oci://")
 }
 
+// FetchChart makes the chart at ref available on the local filesystem and
+// returns its path, which is a chart directory or a packaged .tgz. Remote
+// references are downloaded and extracted into a temporary directory that
+// cleanup removes; local paths are returned unchanged.
+func FetchChart(ctx context.Context, ref string) (path string, cleanup func(), err error) {
+	if !isRemoteChartRef(ref) {
+		if _, err := os.Stat(ref); err != nil {
+			return "", nil, fmt.Errorf("chart %q: %w", ref, err)
+		}
+		return ref, func() {}, nil
+	}
+	root, err := fetchAndExtractChart(ctx, ref)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch remote chart %q: %w", ref, err)
+	}
+	return root, func() { os.RemoveAll(filepath.Dir(root)) }, nil
+}
+
 // helmPullCommand is a variable to allow tests to stub the helm pull
 // invocation used for OCI chart references.
-var helmPullCommand = func(ref, tmpDir string) *exec.Cmd {
+var helmPullCommand = func(ctx context.Context, ref, tmpDir string) *exec.Cmd {
 	helm := "helm"
-	return exec.Command(helm, "pull", ref, "--untar", "--untardir", tmpDir)
+	return helmCommand(ctx, helm, "pull", ref, "--untar", "--untardir", tmpDir)
 }
 
-func fetchAndExtractChart(ref string) (string, error) {
+// fetchAndExtractChart downloads ref into a fresh temporary directory and
+// returns the extracted chart root inside it. Callers own the parent of the
+// returned path and must remove it when done; on error nothing is left
+// behind.
+func fetchAndExtractChart(ctx context.Context, ref string) (root string, err error) {
 	tmpDir, err := os.MkdirTemp("", "heft-chart-*")
 	if err != nil {
 		return "", fmt.Errorf("create temp dir: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(tmpDir)
+		}
+	}()
 
 	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
 		// Download the chart archive and extract it.
 		tgzPath := filepath.Join(tmpDir, "chart.tgz")
-		if err := downloadFile(ref, tgzPath); err != nil {
+		if err := downloadFile(ctx, ref, tgzPath); err != nil {
 			return "", fmt.Errorf("download chart: %w", err)
 		}
 
@@ -45,7 +73,7 @@ func fetchAndExtractChart(ref string) (string, error) {
 	}
 
 	if strings.HasPrefix(ref, "oci://") {
-		command := helmPullCommand(ref, tmpDir)
+		command := helmPullCommand(ctx, ref, tmpDir)
 		command.Env = os.Environ()
 		var stderr bytes.Buffer
 		command.Stderr = &stderr
@@ -68,8 +96,12 @@ func fetchAndExtractChart(ref string) (string, error) {
 	return "", fmt.Errorf("unsupported remote chart ref: %q", ref)
 }
 
-func downloadFile(url, dest string) error {
-	resp, err := http.Get(url)
+func downloadFile(ctx context.Context, url, dest string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(request)
 	if err != nil {
 		return err
 	}
@@ -3,6 +3,7 @@ package scan
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	"errors"
 	"io"
 	"net/http"
@@ -73,7 +74,7 @@ func TestDownloadFileAndExtractTarGz(t *testing.T) {
 	}
 	tmpFile.Close()
 
-	if err := downloadFile(srv.URL, tmpFile.Name()); err != nil {
+	if err := downloadFile(context.Background(), srv.URL, tmpFile.Name()); err != nil {
 		t.Fatalf("downloadFile error: %v", err)
 	}
 
@@ -112,7 +113,7 @@ func TestFetchAndExtractChart(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	chartPath, err := fetchAndExtractChart(srv.URL)
+	chartPath, err := fetchAndExtractChart(context.Background(), srv.URL)
 	if err != nil {
 		t.Fatalf("fetchAndExtractChart error: %v", err)
 	}
@@ -127,7 +128,7 @@ func TestFetchAndExtractChart(t *testing.T) {
 // TestFetchAndExtractChartUnsupportedRef ensures unsupported schemes
 // produce a clear error.
 func TestFetchAndExtractChartUnsupportedRef(t *testing.T) {
-	if _, err := fetchAndExtractChart("ftp://example.com/chart.tgz"); err == nil {
+	if _, err := fetchAndExtractChart(context.Background(), "ftp://example.com/chart.tgz"); err == nil {
 		t.Fatalf("expected error for unsupported ref, got nil")
 	}
 }
@@ -145,7 +146,7 @@ func TestDownloadFileNetworkError(t *testing.T) {
 	// We cannot inject the client directly, but we can point downloadFile
 	// at an invalid URL so that http.Get fails quickly. Using a malformed
 	// scheme triggers an immediate error.
-	if err := downloadFile("http://[::1]:namedport", ""); err == nil {
+	if err := downloadFile(context.Background(), "http://[::1]:namedport", ""); err == nil {
 		t.Fatalf("expected error for invalid URL, got nil")
 	}
 }
@@ -159,7 +160,7 @@ func TestFetchAndExtractChartHTTPError(t *testing.T) {
 	}))
 	defer testServer.Close()
 
-	if _, err := fetchAndExtractChart(testServer.URL); err == nil {
+	if _, err := fetchAndExtractChart(context.Background(), testServer.URL); err == nil {
 		t.Fatalf("expected error for HTTP 502 response, got nil")
 	}
 }
@@ -299,7 +300,7 @@ func TestFetchAndExtractChartHTTPSuccess(t *testing.T) {
 	}))
 	defer server.Close()
 
-	root, err := fetchAndExtractChart(server.URL)
+	root, err := fetchAndExtractChart(context.Background(), server.URL)
 	if err != nil {
 		t.Fatalf("fetchAndExtractChart returned error: %v", err)
 	}
@@ -320,11 +321,11 @@ func TestFetchAndExtractChartOCIFailureWithStub(t *testing.T) {
 	old := helmPullCommand
 	defer func() { helmPullCommand = old }()
 
-	helmPullCommand = func(ref, tmpDir string) *exec.Cmd {
+	helmPullCommand = func(ctx context.Context, ref, tmpDir string) *exec.Cmd {
 		return exec.Command("sh", "-c", "exit 1")
 	}
 
-	if _, err := fetchAndExtractChart("oci://example.com/mychart"); err == nil {
+	if _, err := fetchAndExtractChart(context.Background(), "oci://example.com/mychart"); err == nil {
 		t.Fatalf("expected error for failing OCI helm pull")
 	}
 }
@@ -336,7 +337,7 @@ func TestFetchAndExtractChartOCISuccessWithStub(t *testing.T) {
 	old := helmPullCommand
 	defer func() { helmPullCommand = old }()
 
-	helmPullCommand = func(ref, tmpDir string) *exec.Cmd {
+	helmPullCommand = func(ctx context.Context, ref, tmpDir string) *exec.Cmd {
 		// Create a fake chart directory that fetchAndExtractChart will
 		// discover after the stubbed helm command "succeeds".
 		if err := os.MkdirAll(filepath.Join(tmpDir, "mychart"), 0o755); err != nil {
@@ -345,7 +346,7 @@ func TestFetchAndExtractChartOCISuccessWithStub(t *testing.T) {
 		return exec.Command("sh", "-c", "exit 0")
 	}
 
-	root, err := fetchAndExtractChart("oci://example.com/mychart")
+	root, err := fetchAndExtractChart(context.Background(), "oci://example.com/mychart")
 	if err != nil {
 		t.Fatalf("expected no error for stubbed OCI success, got %v", err)
 	}
@@ -2,9 +2,9 @@ package scan
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -59,12 +59,38 @@ func dependencyNamesWithConditions(chartPath string) []string {
 	return names
 }
 
+// hasMissingDependencies reports whether the chart directory at chartPath
+// declares dependencies that are neither packaged nor unpacked under
+// charts/, so rendering it will run 'helm dependency build'.
+func hasMissingDependencies(chartPath string) bool {
+	data, err := os.ReadFile(filepath.Join(chartPath, "Chart.yaml"))
+	if err != nil {
+		return false
+	}
+	var meta chartMetadata
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return false
+	}
+	for _, dependency := range meta.Dependencies {
+		chartsDir := filepath.Join(chartPath, "charts")
+		if info, err := os.Stat(filepath.Join(chartsDir, dependency.Name)); err == nil && info.IsDir() {
+			continue
+		}
+		if archives, _ := filepath.Glob(filepath.Join(chartsDir, dependency.Name+"-*.tgz")); len(archives) > 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
 // detectRendered invokes `helm template` and extracts images from rendered YAML.
-func detectRendered(options Options) ([]ImageFinding, error) {
+func detectRendered(ctx context.Context, options Options) ([]ImageFinding, error) {
 	helm := options.HelmBin
 	if helm == "" {
 		helm = "helm"
 	}
+	logger := options.logger().With("chart", options.ChartPath, "detector", DetectorRendered)
 
 	template := func() ([]byte, error) {
 		arguments := []string{"template", "heft-scan"}
@@ -77,19 +103,15 @@ func detectRendered(options Options) ([]ImageFinding, error) {
 		chartRef := options.ChartPath
 		arguments = append(arguments, chartRef)
 
-		if options.Verbose {
-			fmt.Fprintf(os.Stderr, "heft: detectRendered: helm %s %s\n", helm, strings.Join(arguments, " "))
-		}
+		logger.Debug("running helm", "helm", helm, "args", arguments)
 
-		command := exec.Command(helm, arguments...)
+		command := helmCommand(ctx, helm, arguments...)
 		var stdout, stderr bytes.Buffer
 		command.Stdout = &stdout
 		command.Stderr = &stderr
 
 		if err := command.Run(); err != nil {
-			if options.Verbose {
-				fmt.Fprintf(os.Stderr, "heft: detectRendered: helm error: %s\n", stderr.String())
-			}
+			logger.Debug("helm failed", "helm", helm, "args", arguments, "error", err, "stderr", stderr.String())
 			return nil, fmt.Errorf("helm template failed: %w: %s", err, stderr.String())
 		}
 		return stdout.Bytes(), nil
@@ -103,8 +125,8 @@ func detectRendered(options Options) ([]ImageFinding, error) {
 		}
 		// If this looks like a missing dependency error on a local chart dir,
 		// try a best-effort "helm dependency build" once and retry template.
-		if !isRemoteChartRef(options.ChartPath) && (strings.Contains(err.Error(), "helm dependency build") || strings.Contains(err.Error(), "missing in charts/ directory")) {
-			dependencyCommand := exec.Command(helm, "dependency", "build", options.ChartPath)
+		if ctx.Err() == nil && !isRemoteChartRef(options.ChartPath) && (strings.Contains(err.Error(), "helm dependency build") || strings.Contains(err.Error(), "missing in charts/ directory")) {
+			dependencyCommand := helmCommand(ctx, helm, "dependency", "build", options.ChartPath)
 			var dependencyStderr bytes.Buffer
 			dependencyCommand.Stderr = &dependencyStderr
 			if dependencyErr := dependencyCommand.Run(); dependencyErr == nil {
@@ -119,70 +141,5 @@ func detectRendered(options Options) ([]ImageFinding, error) {
 		}
 	}
 
-	documents := bytes.Split(output, []byte("---"))
-	var images []ImageFinding
-
-	for _, document := range documents {
-		if len(bytes.TrimSpace(document)) == 0 {
-			continue
-		}
-
-		var metadata map[string]any
-		if err := yaml.Unmarshal(document, &metadata); err != nil {
-			continue
-		}
-
-		kind, _ := metadata["kind"].(string)
-		if kind == "" {
-			continue
-		}
-
-		var podSpec any
-		spec, _ := metadata["spec"].(map[string]any)
-		switch kind {
-		case "Deployment", "StatefulSet", "DaemonSet", "Job", "CronJob", "ReplicaSet", "ReplicationController":
-			if template, ok := spec["template"].(map[string]any); ok {
-				podSpec, _ = template["spec"]
-			}
-		case "Pod":
-			podSpec = spec
-		}
-
-		podSpecMap, ok := podSpec.(map[string]any)
-		if !ok {
-			continue
-		}
-
-		extractFromContainerList := func(list any) {
-			array, ok := list.([]any)
-			if !ok {
-				return
-			}
-			for _, item := range array {
-				m, ok := item.(map[string]any)
-				if !ok {
-					continue
-				}
-				if image, ok := m["image"].(string); ok && image != "" {
-					images = append(images, ImageFinding{
-						Name:       image,
-						Confidence: ConfidenceHigh,
-						Source:     SourceRendered,
-					})
-				}
-			}
-		}
-
-		if c, ok := podSpecMap["containers"]; ok {
-			extractFromContainerList(c)
-		}
-		if c, ok := podSpecMap["initContainers"]; ok {
-			extractFromContainerList(c)
-		}
-		if c, ok := podSpecMap["ephemeralContainers"]; ok {
-			extractFromContainerList(c)
-		}
-	}
-
-	return images, nil
+	return imagesFromManifests(output, "", SourceRendered), nil
 }
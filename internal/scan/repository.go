@@ -0,0 +1,112 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// repositoryIndex is the part of a Helm repository index.yaml used to find
+// chart archives.
+type repositoryIndex struct {
+	Entries map[string][]struct {
+		Version string   `yaml:"version"`
+		URLs    []string `yaml:"urls"`
+	} `yaml:"entries"`
+}
+
+// RepositoryChartRef returns a chart reference FetchChart and ScanContext
+// accept for chart in a Helm repository. For oci:// repositories the
+// reference is built from the repository URL; for HTTP(S) repositories
+// the repository's index.yaml is downloaded and the archive URL of the
+// newest version matching the version constraint is returned. An empty
+// version selects the newest release.
+func RepositoryChartRef(ctx context.Context, repository, chart, version string) (string, error) {
+	repository = strings.TrimSuffix(repository, "/")
+	if strings.HasPrefix(repository, "oci://") {
+		ref := repository + "/" + chart
+		if version != "" {
+			ref += ":" + version
+		}
+		return ref, nil
+	}
+	if !strings.HasPrefix(repository, "http://") && !strings.HasPrefix(repository, "https://") {
+		return "", fmt.Errorf("unsupported chart repository %q", repository)
+	}
+
+	data, err := fetchBytes(ctx, repository+"/index.yaml")
+	if err != nil {
+		return "", fmt.Errorf("fetch index of %s: %w", repository, err)
+	}
+	var index repositoryIndex
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return "", fmt.Errorf("parse index of %s: %w", repository, err)
+	}
+	entries, ok := index.Entries[chart]
+	if !ok {
+		return "", fmt.Errorf("chart %q not found in %s", chart, repository)
+	}
+
+	var constraint *semver.Constraints
+	if version != "" && version != "*" {
+		if constraint, err = semver.NewConstraint(version); err != nil {
+			return "", fmt.Errorf("invalid version %q for chart %q: %w", version, chart, err)
+		}
+	}
+	var best *semver.Version
+	bestURL := ""
+	for _, entry := range entries {
+		if entry.Version == version && len(entry.URLs) > 0 {
+			best, bestURL = nil, entry.URLs[0]
+			break
+		}
+		parsed, err := semver.NewVersion(entry.Version)
+		if err != nil || len(entry.URLs) == 0 {
+			continue
+		}
+		if constraint == nil && parsed.Prerelease() != "" {
+			continue
+		}
+		if constraint != nil && !constraint.Check(parsed) {
+			continue
+		}
+		if best == nil || parsed.GreaterThan(best) {
+			best, bestURL = parsed, entry.URLs[0]
+		}
+	}
+	if bestURL == "" {
+		return "", fmt.Errorf("no version of chart %q in %s matches %q", chart, repository, version)
+	}
+
+	base, err := url.Parse(repository + "/")
+	if err != nil {
+		return "", err
+	}
+	archive, err := base.Parse(bestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid chart URL %q in %s: %w", bestURL, repository, err)
+	}
+	return archive.String(), nil
+}
+
+func fetchBytes(ctx context.Context, target string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", response.StatusCode, target)
+	}
+	return io.ReadAll(response.Body)
+}
@@ -0,0 +1,85 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tonur/heft/internal/registry"
+)
+
+// newRegistryClient is a variable to allow tests to substitute the
+// registry client used for digest and platform resolution.
+var newRegistryClient = registry.NewClient
+
+// resolveImages queries the registry of every image for the details
+// requested in options: its manifest digest (recorded along with a pinned
+// "name@digest" reference) and the platforms it supports. Images that
+// cannot be resolved keep their name and carry a ResolveError instead; only
+// a cancelled context aborts resolution. Up to options.concurrency()
+// images are resolved at once.
+func resolveImages(ctx context.Context, images []ImageFinding, options Options) error {
+	logger := options.logger()
+	client, err := newRegistryClient()
+	if err != nil {
+		logger.Warn("using anonymous registry access", "error", err)
+	}
+
+	err = forEach(ctx, options.concurrency(), len(images), func(ctx context.Context, i int) error {
+		image := &images[i]
+
+		err := resolveImage(ctx, client, image, options)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			image.ResolveError = err.Error()
+			logger.Warn("could not resolve image", "image", image.Name, "error", err)
+			return nil
+		}
+
+		logger.Debug("resolved image", "image", image.Name, "digest", image.Digest, "platforms", image.Platforms)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("resolve images: %w", err)
+	}
+	return nil
+}
+
+func resolveImage(ctx context.Context, client *registry.Client, image *ImageFinding, options Options) error {
+	reference, err := registry.ParseReference(image.Name)
+	if err != nil {
+		return err
+	}
+
+	if options.ResolveDigests {
+		digest, err := client.ResolveDigest(ctx, reference)
+		if err != nil {
+			return err
+		}
+		image.Digest = digest
+		image.Pinned = pinnedName(image.Name, digest)
+	}
+
+	if options.ResolvePlatforms {
+		platforms, err := client.Platforms(ctx, reference)
+		if err != nil {
+			return err
+		}
+		image.Platforms = make([]string, 0, len(platforms))
+		for _, platform := range platforms {
+			image.Platforms = append(image.Platforms, platform.String())
+		}
+	}
+
+	return nil
+}
+
+// pinnedName appends digest to name, replacing any digest already present.
+func pinnedName(name, digest string) string {
+	if index := strings.Index(name, "@"); index != -1 {
+		name = name[:index]
+	}
+	return name + "@" + digest
+}
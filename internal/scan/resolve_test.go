@@ -0,0 +1,81 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/registry/registrytest"
+)
+
+func TestResolveImagesPinsDigestsAndReportsFailures(t *testing.T) {
+	server := registrytest.New(t)
+	digest := server.AddImage("org/app", "v1", []byte(`{}`))
+
+	oldClient := newRegistryClient
+	defer func() { newRegistryClient = oldClient }()
+	newRegistryClient = func() (*registry.Client, error) { return &registry.Client{}, nil }
+
+	oldWriter := logWriter
+	defer func() { logWriter = oldWriter }()
+	var buffer bytes.Buffer
+	logWriter = &buffer
+
+	images := []ImageFinding{
+		{Name: server.Host() + "/org/app:v1", Confidence: ConfidenceHigh},
+		{Name: server.Host() + "/org/app:missing", Confidence: ConfidenceHigh},
+		{Name: "{{ .Values.image }}", Confidence: ConfidenceLow},
+	}
+
+	if err := resolveImages(context.Background(), images, Options{ResolveDigests: true}); err != nil {
+		t.Fatalf("resolveImages error: %v", err)
+	}
+
+	if images[0].Digest != digest {
+		t.Fatalf("expected digest %s, got %+v", digest, images[0])
+	}
+	if images[0].Pinned != server.Host()+"/org/app:v1@"+digest {
+		t.Fatalf("unexpected pinned reference %q", images[0].Pinned)
+	}
+	for _, unresolved := range images[1:] {
+		if unresolved.Digest != "" || unresolved.ResolveError == "" {
+			t.Fatalf("expected resolve error for %+v", unresolved)
+		}
+	}
+	if !strings.Contains(buffer.String(), "image="+server.Host()+"/org/app:missing") {
+		t.Fatalf("expected warning for unresolved image, got %q", buffer.String())
+	}
+}
+
+func TestPinnedNameReplacesExistingDigest(t *testing.T) {
+	if got := pinnedName("app:v1@sha256:old", "sha256:new"); got != "app:v1@sha256:new" {
+		t.Fatalf("unexpected pinned name %q", got)
+	}
+}
+
+func TestResolveImagesListsPlatforms(t *testing.T) {
+	server := registrytest.New(t)
+	amd64 := server.AddImage("org/app", "", []byte(`{"os":"linux","architecture":"amd64"}`))
+	arm64 := server.AddImage("org/app", "", []byte(`{"os":"linux","architecture":"arm64"}`))
+	server.AddIndex("org/app", "v1", map[string]registry.Platform{
+		amd64: {OS: "linux", Architecture: "amd64"},
+		arm64: {OS: "linux", Architecture: "arm64"},
+	})
+
+	oldClient := newRegistryClient
+	defer func() { newRegistryClient = oldClient }()
+	newRegistryClient = func() (*registry.Client, error) { return &registry.Client{}, nil }
+
+	images := []ImageFinding{{Name: server.Host() + "/org/app:v1", Confidence: ConfidenceHigh}}
+	if err := resolveImages(context.Background(), images, Options{ResolvePlatforms: true}); err != nil {
+		t.Fatalf("resolveImages error: %v", err)
+	}
+	if images[0].Digest != "" {
+		t.Fatalf("did not expect a digest without ResolveDigests, got %q", images[0].Digest)
+	}
+	if strings.Join(images[0].Platforms, ",") != "linux/amd64,linux/arm64" {
+		t.Fatalf("unexpected platforms: %v", images[0].Platforms)
+	}
+}
@@ -2,44 +2,50 @@ package scan
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 )
 
-var logWriter io.Writer = os.Stderr
+// commandWaitDelay bounds how long a cancelled helm subprocess may keep its
+// output pipes open before Wait gives up on it.
+var commandWaitDelay = 5 * time.Second
 
-type detectorConfig struct {
-	name string
-	run  func(Options) ([]ImageFinding, error)
+// Scan runs the detectors in order of confidence and returns a ScanResult.
+// It is equivalent to ScanContext with a background context.
+func Scan(options Options) (*ScanResult, error) {
+	return ScanContext(context.Background(), options)
 }
 
-func defaultDetectors() []detectorConfig {
-	return []detectorConfig{
-		{name: "rendered-manifest", run: detectRendered},
-		{name: "static-chart", run: detectStatic},
-		{name: "regex", run: detectRegex},
-	}
-}
+// ScanContext runs the detectors in order of confidence and returns a
+// ScanResult. It degrades gracefully: if higher-confidence detectors fail,
+// lower confidence detectors are still attempted. An error is returned only
+// if no detector produced any images or if ctx is done before the scan
+// completes. Cancelling ctx kills any running helm subprocess and aborts
+// outstanding downloads; temporary chart directories are always removed
+// before ScanContext returns.
+func ScanContext(ctx context.Context, options Options) (*ScanResult, error) {
+	logger := options.logger()
+	logger.Debug("scanning", "chart", options.ChartPath, "includeOptionalDeps", options.IncludeOptionalDeps)
 
-// Scan runs the detectors in order of confidence and returns a ScanResult.
-// It degrades gracefully: if higher-confidence detectors fail, lower
-// confidence detectors are still attempted. An error is returned only if
-// no detector produced any images.
-func Scan(options Options) (*ScanResult, error) {
-	if options.Verbose {
-		fmt.Fprintf(logWriter, "heft: scan: chart=%q includeOptionalDeps=%v\n", options.ChartPath, options.IncludeOptionalDeps)
+	// Plain manifests, stdin and Kustomize overlays are not charts; extract
+	// their images directly.
+	if kind := inputKindOf(options.ChartPath); kind != inputChart {
+		return scanManifestInput(ctx, kind, options)
 	}
 
 	// Normalize remote chart references by downloading and extracting them
 	// into a local directory so that all detectors can operate consistently.
 	if isRemoteChartRef(options.ChartPath) {
-		localRoot, err := fetchAndExtractChart(options.ChartPath)
+		localRoot, err := fetchAndExtractChart(ctx, options.ChartPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch remote chart %q: %w", options.ChartPath, err)
 		}
+		defer os.RemoveAll(filepath.Dir(localRoot))
 		options.ChartPath = localRoot
 	}
 
@@ -47,39 +53,89 @@ func Scan(options Options) (*ScanResult, error) {
 	// dependencies so that conditional subcharts (including remote/OCI ones)
 	// are available locally before running rendered-manifest detection.
 	if options.IncludeOptionalDeps {
-		if err := buildOptionalDependencies(options); err != nil {
+		if err := buildOptionalDependencies(ctx, options); err != nil {
 			return nil, err
 		}
 	}
 
+	var runs []*detectorRun
+	for _, detector := range detectorsFor(options) {
+		run := &detectorRun{detector: detector, options: options}
+		if belowMinConfidence(detector, options) {
+			run.skipped = true
+			run.diagnostic = DetectorDiagnostic{
+				Name:   detector.Name(),
+				Status: DetectorSkipped,
+				Error:  fmt.Sprintf("%s confidence is below the minimum of %s", detector.Confidence(), options.MinConfidence),
+			}
+		}
+		runs = append(runs, run)
+	}
+	chartRuns := len(runs)
+	if options.IncludeOptionalDeps {
+		// When including optional dependencies, also scan each subchart under
+		// charts/<name> if it exists locally. This complements the scan of the
+		// parent chart and matches behavior like running heft scan
+		// ./charts/<name> explicitly for each subchart.
+		runs = append(runs, subchartRuns(options)...)
+	}
+	runDetectors(ctx, runs, options.concurrency())
+
+	// Collect findings in run order, whatever order the runs finished in.
 	var all []ImageFinding
 	var warnings []error
-
-	for _, detector := range defaultDetectors() {
-		images, warn := runDetector(detector.name, options, detector.run)
-		all = append(all, images...)
-		if warn != nil {
-			warnings = append(warnings, warn)
+	diagnostics := &Diagnostics{Detectors: []DetectorDiagnostic{}}
+	for i, run := range runs {
+		all = append(all, run.images...)
+		diagnostics.Detectors = append(diagnostics.Detectors, run.diagnostic)
+		// Subcharts are optional, so their detector errors are not warnings.
+		if i >= chartRuns || run.skipped {
+			continue
+		}
+		if run.err != nil {
+			warnings = append(warnings, run.err)
+		} else if run.detector.Name() == DetectorRendered {
+			diagnostics.RenderedSucceeded = true
 		}
+	}
+
+	// A cancelled or timed out scan must not be mistaken for a complete one,
+	// even if some detectors managed to report images before it stopped.
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("scan of %q interrupted: %w", options.ChartPath, err)
+	}
+
+	result, err := finalizeScanResult(all, warnings, options.MinConfidence, logger)
+	if err != nil {
+		return nil, err
+	}
+	result.Chart = readChartMetadata(options.ChartPath)
+	result.Diagnostics = diagnostics
 
-		if detector.name == "rendered-manifest" && options.IncludeOptionalDeps {
-			// When including optional dependencies, also scan each subchart under
-			// charts/<name> if it exists locally. This complements the main
-			// rendered-manifest scan of the parent chart and matches behavior like
-			// running heft scan ./charts/<name> explicitly for each subchart.
-			all = append(all, scanOptionalSubcharts(options)...)
+	if options.ResolveDigests || options.ResolvePlatforms {
+		if err := resolveImages(ctx, result.Images, options); err != nil {
+			return nil, err
 		}
 	}
 
-	return finalizeScanResult(all, warnings, options.MinConfidence)
+	return result, nil
 }
 
-func buildOptionalDependencies(options Options) error {
+// helmCommand builds a helm invocation bound to ctx. The process is killed
+// when ctx is done, and Wait returns at most commandWaitDelay later even if
+// helm left children holding its output pipes.
+func helmCommand(ctx context.Context, helm string, arguments ...string) *exec.Cmd {
+	command := exec.CommandContext(ctx, helm, arguments...)
+	command.WaitDelay = commandWaitDelay
+	return command
+}
+
+func buildOptionalDependencies(ctx context.Context, options Options) error {
 	helm := options.HelmBin
 	if helm == "" {
 		helm = "helm"
 	}
-	dependencyCommand := exec.Command(helm, "dependency", "build", options.ChartPath)
+	dependencyCommand := helmCommand(ctx, helm, "dependency", "build", options.ChartPath)
 	dependencyCommand.Env = os.Environ()
 	var dependencyErrorOutput bytes.Buffer
 	dependencyCommand.Stderr = &dependencyErrorOutput
@@ -89,33 +145,43 @@ func buildOptionalDependencies(options Options) error {
 	return nil
 }
 
-func runDetector(name string, options Options, detector func(Options) ([]ImageFinding, error)) ([]ImageFinding, error) {
-	images, err := detector(options)
+// runDetector runs detector on the chart at options.ChartPath, which is
+// the named subchart of the scanned chart if subchart is set, and gives
+// its findings the detector's confidence where they set none.
+func runDetector(ctx context.Context, detector Detector, options Options, subchart string) ([]ImageFinding, DetectorDiagnostic, error) {
+	name := detector.Name()
+	logger := options.logger().With("chart", options.ChartPath, "detector", name)
+	if subchart != "" {
+		logger = logger.With("subchart", subchart)
+	}
+	started := time.Now()
+	images, err := detector.Detect(ctx, options.chart())
 	if err != nil {
 		wrapped := fmt.Errorf("%s detector failed: %w", name, err)
-		if options.Verbose {
-			fmt.Fprintf(logWriter, "heft: %s: chart=%q error=%v\n", name, options.ChartPath, err)
-		}
-		return nil, wrapped
+		logger.Debug("detector failed", "duration", time.Since(started), "error", err)
+		return nil, newDetectorDiagnostic(detector, subchart, started, nil, err), wrapped
 	}
 
-	if options.Verbose {
-		fmt.Fprintf(logWriter, "heft: %s: chart=%q images=%d\n", name, options.ChartPath, len(images))
+	for i := range images {
+		if images[i].Confidence == "" {
+			images[i].Confidence = detector.Confidence()
+		}
 	}
+	logger.Debug("detector finished", "duration", time.Since(started), "images", len(images))
 
-	return images, nil
+	return images, newDetectorDiagnostic(detector, subchart, started, images, nil), nil
 }
 
-func finalizeScanResult(all []ImageFinding, warnings []error, min Confidence) (*ScanResult, error) {
+func finalizeScanResult(all []ImageFinding, warnings []error, min Confidence, logger *slog.Logger) (*ScanResult, error) {
 	if len(all) == 0 {
 		if len(warnings) > 0 {
 			return nil, warnings[0]
 		}
-		return nil, fmt.Errorf("no images found by any detector")
+		return nil, fmt.Errorf("%w by any detector", ErrNoImages)
 	}
 
 	for _, w := range warnings {
-		fmt.Fprintln(logWriter, "heft: warning:", w)
+		logger.Warn("detector failed", "error", w)
 	}
 
 	deduped := dedupeImages(all)
@@ -133,14 +199,30 @@ func finalizeScanResult(all []ImageFinding, warnings []error, min Confidence) (*
 	return &ScanResult{Images: deduped}, nil
 }
 
-func scanOptionalSubcharts(options Options) []ImageFinding {
-	var all []ImageFinding
+// detectorRun is one detector to run on the scanned chart or one of its
+// subcharts, and its outcome.
+type detectorRun struct {
+	detector Detector
+	options  Options
+	subchart string
+	// skipped runs are not run; diagnostic says why.
+	skipped bool
+
+	images     []ImageFinding
+	diagnostic DetectorDiagnostic
+	err        error
+}
+
+// subchartRuns returns a run of every detector above the minimum
+// confidence for each unpacked subchart under charts/.
+func subchartRuns(options Options) []*detectorRun {
 	chartsDir := filepath.Join(options.ChartPath, "charts")
 	entries, err := os.ReadDir(chartsDir)
 	if err != nil {
 		return nil
 	}
 
+	var runs []*detectorRun
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -149,37 +231,39 @@ func scanOptionalSubcharts(options Options) []ImageFinding {
 		depOptions := options
 		depOptions.ChartPath = depChartPath
 
-		if options.Verbose {
-			fmt.Fprintf(logWriter, "heft: scan: subchart=%q\n", depChartPath)
-		}
-
-		if images, err := detectRendered(depOptions); err == nil {
-			if options.Verbose {
-				fmt.Fprintf(logWriter, "heft: detectRendered: chart=%q images=%d\n", depChartPath, len(images))
-			}
-			all = append(all, images...)
-		} else if options.Verbose {
-			fmt.Fprintf(logWriter, "heft: detectRendered: chart=%q error=%v\n", depChartPath, err)
-		}
+		options.logger().Debug("scanning subchart", "chart", options.ChartPath, "subchart", entry.Name(), "path", depChartPath)
 
-		if images, err := detectStatic(depOptions); err == nil {
-			if options.Verbose {
-				fmt.Fprintf(logWriter, "heft: detectStatic: chart=%q images=%d\n", depChartPath, len(images))
+		for _, detector := range detectorsFor(options) {
+			if belowMinConfidence(detector, options) {
+				continue
 			}
-			all = append(all, images...)
-		} else if options.Verbose {
-			fmt.Fprintf(logWriter, "heft: detectStatic: chart=%q error=%v\n", depChartPath, err)
+			runs = append(runs, &detectorRun{detector: detector, options: depOptions, subchart: entry.Name()})
 		}
+	}
+	return runs
+}
 
-		if images, err := detectRegex(depOptions); err == nil {
-			if options.Verbose {
-				fmt.Fprintf(logWriter, "heft: detectRegex: chart=%q images=%d\n", depChartPath, len(images))
-			}
-			all = append(all, images...)
-		} else if options.Verbose {
-			fmt.Fprintf(logWriter, "heft: detectRegex: chart=%q error=%v\n", depChartPath, err)
+// runDetectors runs every run that is not skipped, at most concurrency at
+// a time. Rendered runs that will build missing chart dependencies go
+// first, on their own, because the other detectors read the charts/
+// directory helm writes to. Runs not started before ctx is done are
+// left empty.
+func runDetectors(ctx context.Context, runs []*detectorRun, concurrency int) {
+	var first, rest []*detectorRun
+	for _, run := range runs {
+		switch {
+		case run.skipped:
+		case run.detector.Name() == DetectorRendered && !run.options.DisableHelmDeps && hasMissingDependencies(run.options.ChartPath):
+			first = append(first, run)
+		default:
+			rest = append(rest, run)
 		}
 	}
-
-	return all
+	for _, phase := range [][]*detectorRun{first, rest} {
+		_ = forEach(ctx, concurrency, len(phase), func(ctx context.Context, i int) error {
+			run := phase[i]
+			run.images, run.diagnostic, run.err = runDetector(ctx, run.detector, run.options, run.subchart)
+			return nil
+		})
+	}
 }
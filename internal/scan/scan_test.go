@@ -2,13 +2,16 @@ package scan
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 // fakeHelmBinary builds a small helm-like binary that understands
@@ -101,7 +104,7 @@ func TestScanOptionalSubchartsNoChartsDirReturnsNil(t *testing.T) {
 	// No charts/ subdirectory created.
 	options := Options{ChartPath: root}
 
-	results := scanOptionalSubcharts(options)
+	results := subchartRuns(options)
 	if results != nil {
 		t.Fatalf("expected nil when charts dir is missing, got %v", results)
 	}
@@ -133,13 +136,14 @@ func TestScanOptionalSubchartsSkipsNonDirectoriesAndLogs(t *testing.T) {
 
 	options := Options{ChartPath: root, Verbose: true}
 
-	// We do not assert on the number of results because that depends on
-	// other detectors; we only verify that the non-directory is skipped
-	// and that we log about the subchart path.
-	_ = scanOptionalSubcharts(options)
+	// The non-directory is skipped: only the subchart gets detector runs,
+	// and we log about its path.
+	if runs := subchartRuns(options); len(runs) != len(DefaultDetectors()) {
+		t.Fatalf("expected one run per detector for the subchart, got %d", len(runs))
+	}
 
 	logged := buf.String()
-	if !bytes.Contains([]byte(logged), []byte("subchart=\""+subchartDir+"\"")) {
+	if !bytes.Contains([]byte(logged), []byte("path="+subchartDir)) {
 		t.Fatalf("expected verbose log for subchart %s, got: %s", subchartDir, logged)
 	}
 }
@@ -244,7 +248,7 @@ func TestCollectStaticImagesFromValuesYAML(t *testing.T) {
 		t.Fatalf("failed to write temp values.yaml: %v", err)
 	}
 
-	images, err := detectStatic(Options{ChartPath: directory})
+	images, err := detectStatic(context.Background(), Options{ChartPath: directory})
 	if err != nil {
 		t.Fatalf("detectStatic returned error: %v", err)
 	}
@@ -276,7 +280,7 @@ func TestDetectRegexSkipsTestsAndJunkTags(t *testing.T) {
 		t.Fatalf("failed to write values file: %v", err)
 	}
 
-	images, err := detectRegex(Options{ChartPath: directory})
+	images, err := detectRegex(context.Background(), Options{ChartPath: directory})
 	if err != nil {
 		t.Fatalf("detectRegex returned error: %v", err)
 	}
@@ -338,7 +342,7 @@ func TestFinalizeScanResultNoImagesWithWarnings(t *testing.T) {
 	t.Helper()
 
 	warn := errors.New("detector failed")
-	_, err := finalizeScanResult(nil, []error{warn}, "")
+	_, err := finalizeScanResult(nil, []error{warn}, "", slog.New(slog.DiscardHandler))
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -350,7 +354,7 @@ func TestFinalizeScanResultNoImagesWithWarnings(t *testing.T) {
 func TestFinalizeScanResultNoImagesNoWarnings(t *testing.T) {
 	t.Helper()
 
-	_, err := finalizeScanResult(nil, nil, "")
+	_, err := finalizeScanResult(nil, nil, "", slog.New(slog.DiscardHandler))
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -360,16 +364,13 @@ func TestFinalizeScanResultNoImagesNoWarnings(t *testing.T) {
 }
 
 func TestFinalizeScanResultLogsWarningsAndReturnsImages(t *testing.T) {
-	prevWriter := logWriter
-	defer func() { logWriter = prevWriter }()
-
 	var buffer bytes.Buffer
-	logWriter = &buffer
+	logger := slog.New(slog.NewTextHandler(&buffer, nil))
 
 	images := []ImageFinding{{Name: "high", Confidence: ConfidenceHigh}}
 	warnings := []error{errors.New("first"), errors.New("second")}
 
-	result, err := finalizeScanResult(images, warnings, "")
+	result, err := finalizeScanResult(images, warnings, "", logger)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -378,7 +379,7 @@ func TestFinalizeScanResultLogsWarningsAndReturnsImages(t *testing.T) {
 	}
 
 	output := buffer.String()
-	if !strings.Contains(output, "heft: warning:") || !strings.Contains(output, "first") || !strings.Contains(output, "second") {
+	if !strings.Contains(output, "level=WARN") || !strings.Contains(output, "first") || !strings.Contains(output, "second") {
 		t.Fatalf("warnings not logged as expected: %q", output)
 	}
 }
@@ -390,7 +391,7 @@ func TestFinalizeScanResultAppliesMinConfidenceFilter(t *testing.T) {
 		{Name: "low", Confidence: ConfidenceLow},
 	}
 
-	result, err := finalizeScanResult(images, nil, ConfidenceHigh)
+	result, err := finalizeScanResult(images, nil, ConfidenceHigh, slog.New(slog.DiscardHandler))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -398,7 +399,7 @@ func TestFinalizeScanResultAppliesMinConfidenceFilter(t *testing.T) {
 		t.Fatalf("expected only high confidence image, got %+v", result.Images)
 	}
 
-	result, err = finalizeScanResult(images, nil, ConfidenceMedium)
+	result, err = finalizeScanResult(images, nil, ConfidenceMedium, slog.New(slog.DiscardHandler))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -406,7 +407,7 @@ func TestFinalizeScanResultAppliesMinConfidenceFilter(t *testing.T) {
 		t.Fatalf("expected high and medium images, got %+v", result.Images)
 	}
 
-	result, err = finalizeScanResult(images, nil, ConfidenceLow)
+	result, err = finalizeScanResult(images, nil, ConfidenceLow, slog.New(slog.DiscardHandler))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -414,3 +415,37 @@ func TestFinalizeScanResultAppliesMinConfidenceFilter(t *testing.T) {
 		t.Fatalf("expected all images, got %+v", result.Images)
 	}
 }
+
+// TestScanContextTimeoutStopsHelm ensures a hung helm subprocess is killed
+// when the context deadline passes and that the scan reports the deadline
+// rather than partial results.
+func TestScanContextTimeoutStopsHelm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell-script helm stub requires a POSIX shell")
+	}
+
+	chartRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartRoot, "values.yaml"), []byte("image:\n  repository: example.com/foo/bar\n  tag: v1\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile values.yaml: %v", err)
+	}
+
+	helmBin := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(helmBin, []byte("#!/bin/sh\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatalf("WriteFile fake helm: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := ScanContext(ctx, Options{ChartPath: chartRoot, HelmBin: helmBin, DisableHelmDeps: true})
+	if err == nil {
+		t.Fatalf("expected error when the scan times out, got nil")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("scan took %v; helm was not stopped on timeout", elapsed)
+	}
+}
@@ -1,19 +1,21 @@
 package scan
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
 
 // detectStatic performs a best-effort static analysis of chart YAML files
 // when rendering is not available or incomplete.
-func detectStatic(opts Options) ([]ImageFinding, error) {
+func detectStatic(ctx context.Context, opts Options) ([]ImageFinding, error) {
 	var results []ImageFinding
 
 	root := opts.ChartPath
@@ -21,6 +23,8 @@ func detectStatic(opts Options) ([]ImageFinding, error) {
 		return nil, fmt.Errorf("chart path is empty")
 	}
 
+	registry := globalImageRegistry(opts)
+
 	// Walk the chart directory and inspect YAML files.
 	// We intentionally avoid following symlinks or special file types.
 	//
@@ -30,6 +34,9 @@ func detectStatic(opts Options) ([]ImageFinding, error) {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if d.IsDir() {
 			return nil
 		}
@@ -44,17 +51,19 @@ func detectStatic(opts Options) ([]ImageFinding, error) {
 			// Best-effort: skip unreadable files.
 			return nil
 		}
+		scope := staticScope{file: path, registry: registry}
+		if filepath.Base(path) == "values.yaml" {
+			scope.defaultTag = chartDefaultTag(filepath.Dir(path))
+		}
 
-		// Split possible multi-doc YAML
-		for _, doc := range bytes.Split(data, []byte("---")) {
-			if len(bytes.TrimSpace(doc)) == 0 {
-				continue
-			}
-			var m map[string]any
-			if err := yaml.Unmarshal(doc, &m); err != nil {
+		// Inspect each document of possibly multi-document YAML.
+		for _, document := range splitDocuments(data) {
+			var root yaml.Node
+			if err := yaml.Unmarshal(document.data, &root); err != nil {
 				continue
 			}
-			collectStaticImages(m, path, &results)
+			scope.line = document.line
+			collectStaticImages(&root, nil, "", scope, &results)
 		}
 
 		return nil
@@ -66,45 +75,299 @@ func detectStatic(opts Options) ([]ImageFinding, error) {
 	return results, nil
 }
 
-// collectStaticImages recursively walks YAML structures looking for common
-// image patterns.
-func collectStaticImages(node any, file string, results *[]ImageFinding) {
-	switch value := node.(type) {
-	case map[string]any:
-		// Check direct "image" key
-		if imageValue, ok := value["image"]; ok {
-			if name, ok := imageValue.(string); ok && name != "" && !strings.Contains(name, "{{") {
-				*results = append(*results, ImageFinding{
-					Name:       name,
-					Confidence: ConfidenceMedium,
-					Source:     SourceKind("static-yaml"),
-					File:       file,
-				})
+// Image conventions recognized by the static detector. Maps found under an
+// "image" key, or holding both a repository and a tag or digest, describe
+// an image as registry, repository (or name, or image), tag and digest
+// keys. Maps may also hold an image string with a sibling tag, or
+// imageRegistry, imageRepository, imageTag and imageDigest keys.
+var (
+	imageRepositoryKeys = []string{"repository", "name", "image"}
+	siblingTagKeys      = []string{"tag", "imageTag"}
+)
+
+// staticScope is what the static detector knows about the document it
+// reads.
+type staticScope struct {
+	file string
+	// line is the line of the file the document starts on.
+	line int
+	// registry is the global.imageRegistry override, which replaces the
+	// registry of image maps that have one, as Bitnami charts do.
+	registry string
+	// defaultTag is the tag templates usually fall back to for images in
+	// a chart's values.yaml: its appVersion, or else its version.
+	defaultTag string
+}
+
+// collectStaticImages recursively walks a YAML node looking for common
+// image patterns. keyNode is the key node was found under, nil for list
+// items and the document root, and path is node's key path, such as
+// "controller.sidecars[0]".
+func collectStaticImages(node, keyNode *yaml.Node, path string, scope staticScope, results *[]ImageFinding) {
+	// add records an image found at the key path of at, which is a key
+	// node of the mapping or, failing that, the mapping itself.
+	add := func(name string, tagInferred bool, at *yaml.Node, keyPath string) {
+		*results = append(*results, ImageFinding{
+			Name:        name,
+			Confidence:  ConfidenceMedium,
+			Source:      SourceStatic,
+			File:        scope.file,
+			Line:        scope.line + at.Line - 1,
+			Column:      at.Column,
+			KeyPath:     keyPath,
+			TagInferred: tagInferred,
+		})
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectStaticImages(child, keyNode, path, scope, results)
+		}
+	case yaml.AliasNode:
+		collectStaticImages(node.Alias, keyNode, path, scope, results)
+	case yaml.MappingNode:
+		value, keys := mappingScalars(node)
+		at := keyNode
+		if at == nil {
+			at = node
+		}
+		key := ""
+		if keyNode != nil {
+			key = keyNode.Value
+		}
+
+		_, hasTag := value["tag"]
+		_, hasDigest := value["digest"]
+		if _, ok := value["repository"].(string); key == "image" || (ok && (hasTag || hasDigest)) {
+			if name, tagInferred, ok := imageFromMap(value, scope); ok {
+				add(name, tagInferred, at, path)
+				return
 			}
-			if imageProperties, ok := imageValue.(map[string]any); ok {
-				repository, _ := imageProperties["repository"].(string)
-				tag, _ := imageProperties["tag"].(string)
-				if repository != "" && !strings.Contains(repository, "{{") {
-					name := repository
-					if tag != "" && !strings.Contains(tag, "{{") {
-						name = fmt.Sprintf("%s:%s", repository, tag)
+		}
+
+		if name := scalarField(value, "image"); name != "" && !isTemplated(name) {
+			tagInferred := false
+			if !hasTagOrDigest(name) {
+				for _, tagKey := range siblingTagKeys {
+					if _, ok := value[tagKey]; !ok {
+						continue
 					}
-					*results = append(*results, ImageFinding{
-						Name:       name,
-						Confidence: ConfidenceMedium,
-						Source:     SourceKind("static-yaml"),
-						File:       file,
-					})
+					if tag := scalarField(value, tagKey); tag != "" && !isTemplated(tag) {
+						name += ":" + tag
+					} else if emptyField(value, tagKey) && scope.defaultTag != "" {
+						name += ":" + scope.defaultTag
+						tagInferred = true
+					}
+					break
 				}
 			}
+			add(name, tagInferred, keys["image"], keyPath(path, "image"))
 		}
+		if scalarField(value, "imageRepository") != "" {
+			prefixed := map[string]any{}
+			for _, part := range []string{"Registry", "Repository", "Tag", "Digest"} {
+				if partValue, ok := value["image"+part]; ok {
+					prefixed[strings.ToLower(part)] = partValue
+				}
+			}
+			if name, tagInferred, ok := imageFromMap(prefixed, scope); ok {
+				add(name, tagInferred, keys["imageRepository"], keyPath(path, "imageRepository"))
+			}
+		}
+
 		// Recurse into children
-		for _, child := range value {
-			collectStaticImages(child, file, results)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childKey := node.Content[i]
+			collectStaticImages(node.Content[i+1], childKey, keyPath(path, childKey.Value), scope, results)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			collectStaticImages(item, nil, fmt.Sprintf("%s[%d]", path, i), scope, results)
+		}
+	}
+}
+
+// mappingScalars returns the values of a mapping node's keys, decoded for
+// scalars and as the node itself otherwise, and the key nodes by key.
+func mappingScalars(node *yaml.Node) (map[string]any, map[string]*yaml.Node) {
+	values := map[string]any{}
+	keys := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, child := node.Content[i], node.Content[i+1]
+		keys[key.Value] = key
+		var value any = child
+		if child.Kind == yaml.ScalarNode {
+			if err := child.Decode(&value); err != nil {
+				value = child.Value
+			}
+		}
+		values[key.Value] = value
+	}
+	return values, keys
+}
+
+// keyPath appends key to a values key path: with a dot, or in brackets if
+// key is not a plain identifier, as in `podLabels["app.kubernetes.io/name"]`.
+func keyPath(path, key string) string {
+	if key == "" || strings.ContainsFunc(key, func(r rune) bool {
+		return !(r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	}) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// imageFromMap returns the image an image map refers to, as a chart
+// template would compose it: registry/repository, followed by @digest if
+// there is one, otherwise by :tag. An empty or null tag is the scope's
+// defaultTag, which is reported as inferred. A templated tag or digest is
+// left out; a templated repository or registry makes the image unknown.
+func imageFromMap(image map[string]any, scope staticScope) (name string, tagInferred, ok bool) {
+	repository := scalarField(image, ImageRepositoryKey(image))
+	if repository == "" || isTemplated(repository) {
+		return "", false, false
+	}
+
+	registry := scalarField(image, "registry")
+	if _, hasRegistry := image["registry"]; hasRegistry && scope.registry != "" {
+		registry = scope.registry
+	}
+	if isTemplated(registry) {
+		return "", false, false
+	}
+
+	name = repository
+	if registry != "" {
+		name = strings.TrimSuffix(registry, "/") + "/" + repository
+	}
+	if hasTagOrDigest(name) {
+		return name, false, true
+	}
+	if digest := scalarField(image, "digest"); digest != "" && !isTemplated(digest) {
+		return name + "@" + digest, false, true
+	}
+	tag := scalarField(image, "tag")
+	switch {
+	case tag != "" && !isTemplated(tag):
+		return name + ":" + tag, false, true
+	case emptyField(image, "tag") && scope.defaultTag != "":
+		return name + ":" + scope.defaultTag, true, true
+	}
+	return name, false, true
+}
+
+// ImageRepositoryKey returns the key holding the repository of an image
+// map as the static detector reads it: "repository", or else "name" or
+// "image", or "" if the map has none of them.
+func ImageRepositoryKey(image map[string]any) string {
+	for _, key := range imageRepositoryKeys {
+		if scalarField(image, key) != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// chartDefaultTag returns the appVersion of the chart in directory, or its
+// version if it has no appVersion, or "" if directory holds no chart.
+func chartDefaultTag(directory string) string {
+	metadata := readChartMetadata(directory)
+	if metadata == nil {
+		return ""
+	}
+	if metadata.AppVersion != "" {
+		return metadata.AppVersion
+	}
+	return metadata.Version
+}
+
+// globalImageRegistry returns the global.imageRegistry a chart is rendered
+// with: from its values.yaml, overridden by values files and then by --set
+// flags, in order.
+func globalImageRegistry(options Options) string {
+	const key = "global.imageRegistry"
+	registry := ""
+	files := []string{filepath.Join(options.ChartPath, "values.yaml")}
+	for _, file := range options.ValuesFiles {
+		files = append(files, strings.TrimPrefix(file, "--values="))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
 		}
-	case []any:
-		for _, item := range value {
-			collectStaticImages(item, file, results)
+		var values map[string]any
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			continue
+		}
+		if global, ok := values["global"].(map[string]any); ok {
+			if _, ok := global["imageRegistry"]; ok {
+				registry = scalarField(global, "imageRegistry")
+			}
+		}
+	}
+	for _, flag := range options.Values {
+		flag = strings.TrimPrefix(strings.TrimPrefix(flag, "--set-string="), "--set=")
+		for _, assignment := range splitSetFlag(flag) {
+			if name, value, ok := strings.Cut(assignment, "="); ok && name == key {
+				registry = value
+			}
 		}
 	}
+	return registry
+}
+
+// splitSetFlag splits a --set flag value into its comma-separated
+// key=value assignments, honoring backslash-escaped commas.
+func splitSetFlag(flag string) []string {
+	var assignments []string
+	var current strings.Builder
+	for i := 0; i < len(flag); i++ {
+		switch {
+		case flag[i] == '\\' && i+1 < len(flag) && flag[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case flag[i] == ',':
+			assignments = append(assignments, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(flag[i])
+		}
+	}
+	return append(assignments, current.String())
+}
+
+// scalarField returns a string, number or boolean value of object as a
+// string, and "" for anything else.
+func scalarField(object map[string]any, key string) string {
+	switch value := object[key].(type) {
+	case string:
+		return value
+	case int, int64, uint64, float64, bool:
+		return fmt.Sprint(value)
+	default:
+		return ""
+	}
+}
+
+// emptyField reports whether object has key set to an empty string or null.
+func emptyField(object map[string]any, key string) bool {
+	value, ok := object[key]
+	return ok && (value == nil || value == "")
+}
+
+// hasTagOrDigest reports whether an image name carries a tag or digest.
+func hasTagOrDigest(name string) bool {
+	if strings.Contains(name, "@") {
+		return true
+	}
+	return strings.Contains(name[strings.LastIndex(name, "/")+1:], ":")
+}
+
+func isTemplated(value string) bool {
+	return strings.Contains(value, "{{")
 }
@@ -1,13 +1,15 @@
 package scan
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
 func TestDetectStaticEmptyChartPath(t *testing.T) {
-	if _, err := detectStatic(Options{ChartPath: ""}); err == nil {
+	if _, err := detectStatic(context.Background(), Options{ChartPath: ""}); err == nil {
 		t.Fatalf("expected error for empty chart path, got nil")
 	}
 }
@@ -35,7 +37,7 @@ containers:
 		t.Fatalf("WriteFile values.yaml: %v", err)
 	}
 
-	results, err := detectStatic(Options{ChartPath: chartDir})
+	results, err := detectStatic(context.Background(), Options{ChartPath: chartDir})
 	if err != nil {
 		t.Fatalf("detectStatic error: %v", err)
 	}
@@ -64,3 +66,182 @@ containers:
 		t.Fatalf("templated image should not be included in results")
 	}
 }
+
+func TestDetectStaticComposesImageConventions(t *testing.T) {
+	chartDir := t.TempDir()
+	values := `global:
+  imageRegistry: ""
+image:
+  registry: docker.io
+  repository: bitnami/redis
+  tag: 7.2.4
+  digest: ""
+metrics:
+  image:
+    registry: docker.io
+    repository: bitnami/redis-exporter
+    tag: 1.58.0
+    digest: sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+sidecar:
+  image:
+    name: ghcr.io/example/sidecar
+    tag: 2
+proxy:
+  image:
+    image: quay.io/example/proxy
+busybox:
+  repository: busybox
+  tag: "1.36"
+init:
+  image: alpine
+  imageTag: "3.19"
+agent:
+  imageRegistry: registry.example.com
+  imageRepository: agent
+  imageTag: "{{ .Chart.AppVersion }}"
+`
+	if err := os.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte(values), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(options Options) map[string]bool {
+		t.Helper()
+		results, err := detectStatic(context.Background(), options)
+		if err != nil {
+			t.Fatalf("detectStatic: %v", err)
+		}
+		found := map[string]bool{}
+		for _, result := range results {
+			found[result.Name] = true
+		}
+		return found
+	}
+
+	found := names(Options{ChartPath: chartDir})
+	for _, want := range []string{
+		"docker.io/bitnami/redis:7.2.4",
+		"docker.io/bitnami/redis-exporter@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"ghcr.io/example/sidecar:2",
+		"quay.io/example/proxy",
+		"busybox:1.36",
+		"alpine:3.19",
+		"registry.example.com/agent",
+	} {
+		if !found[want] {
+			t.Errorf("missing %s in %v", want, found)
+		}
+	}
+
+	override := filepath.Join(t.TempDir(), "override.yaml")
+	if err := os.WriteFile(override, []byte("global:\n  imageRegistry: mirror.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	found = names(Options{ChartPath: chartDir, ValuesFiles: []string{"--values=" + override}})
+	if !found["mirror.example.com/bitnami/redis:7.2.4"] || found["docker.io/bitnami/redis:7.2.4"] {
+		t.Errorf("values file override not applied: %v", found)
+	}
+	if !found["mirror.example.com/agent"] || !found["ghcr.io/example/sidecar:2"] {
+		t.Errorf("override applies only to images with a registry key: %v", found)
+	}
+
+	found = names(Options{ChartPath: chartDir, ValuesFiles: []string{"--values=" + override}, Values: []string{"--set=replicas=2,global.imageRegistry=set.example.com"}})
+	if !found["set.example.com/bitnami/redis:7.2.4"] {
+		t.Errorf("--set override not applied: %v", found)
+	}
+}
+
+func TestSplitSetFlag(t *testing.T) {
+	got := splitSetFlag(`a=1,b=x\,y,c=3`)
+	want := []string{"a=1", "b=x,y", "c=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitSetFlag = %q, want %q", got, want)
+	}
+}
+
+func TestDetectStaticInfersEmptyTagsFromAppVersion(t *testing.T) {
+	chartDir := t.TempDir()
+	subchartDir := filepath.Join(chartDir, "charts", "cache")
+	if err := os.MkdirAll(subchartDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(chartDir, "Chart.yaml"):       "apiVersion: v2\nname: app\nversion: 1.0.0\nappVersion: \"2.3.4\"\n",
+		filepath.Join(chartDir, "values.yaml"):      "image:\n  repository: ghcr.io/example/app\n  tag: \"\"\nworker:\n  image:\n    repository: ghcr.io/example/worker\n    tag: v9\nproxy:\n  image:\n    repository: ghcr.io/example/proxy\n",
+		filepath.Join(subchartDir, "Chart.yaml"):    "apiVersion: v2\nname: cache\nversion: 0.5.0\n",
+		filepath.Join(subchartDir, "values.yaml"):   "image:\n  repository: ghcr.io/example/cache\n  tag:\n",
+		filepath.Join(chartDir, "ci", "extra.yaml"): "image:\n  repository: ghcr.io/example/extra\n  tag: \"\"\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := detectStatic(context.Background(), Options{ChartPath: chartDir})
+	if err != nil {
+		t.Fatalf("detectStatic: %v", err)
+	}
+	inferred := map[string]bool{}
+	for _, result := range results {
+		inferred[result.Name] = result.TagInferred
+	}
+	want := map[string]bool{
+		"ghcr.io/example/app:2.3.4":   true,
+		"ghcr.io/example/worker:v9":   false,
+		"ghcr.io/example/cache:0.5.0": true,
+		// A missing tag key is left alone, like a missing sibling tag.
+		"ghcr.io/example/proxy": false,
+		// Only a chart's values.yaml falls back to its appVersion.
+		"ghcr.io/example/extra": false,
+	}
+	if !reflect.DeepEqual(inferred, want) {
+		t.Errorf("images = %v, want %v", inferred, want)
+	}
+}
+
+func TestDetectStaticRecordsKeyPathsAndPositions(t *testing.T) {
+	chartDir := t.TempDir()
+	values := `controller:
+  image:
+    repository: ghcr.io/example/controller
+    tag: v1
+  sidecars:
+    - name: proxy
+      image: envoyproxy/envoy:v1.30.1
+podAnnotations:
+  example.com/debug:
+    image: busybox:1.36
+---
+extra:
+  imageRepository: ghcr.io/example/extra
+  imageTag: v2
+`
+	if err := os.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte(values), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := detectStatic(context.Background(), Options{ChartPath: chartDir})
+	if err != nil {
+		t.Fatalf("detectStatic: %v", err)
+	}
+	type position struct {
+		keyPath      string
+		line, column int
+	}
+	got := map[string]position{}
+	for _, result := range results {
+		got[result.Name] = position{result.KeyPath, result.Line, result.Column}
+	}
+	want := map[string]position{
+		"ghcr.io/example/controller:v1": {"controller.image", 2, 3},
+		"envoyproxy/envoy:v1.30.1":      {"controller.sidecars[0].image", 7, 7},
+		"busybox:1.36":                  {`podAnnotations["example.com/debug"].image`, 10, 5},
+		"ghcr.io/example/extra:v2":      {"extra.imageRepository", 13, 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("positions = %v, want %v", got, want)
+	}
+}
@@ -1,6 +1,9 @@
 package scan
 
-import "fmt"
+import (
+	"errors"
+	"log/slog"
+)
 
 type Confidence string
 
@@ -12,6 +15,15 @@ const (
 	ConfidenceLow    Confidence = "low"
 
 	SourceRendered SourceKind = "rendered-manifest"
+	// SourceStatic marks images inferred from values and templates without
+	// rendering.
+	SourceStatic SourceKind = "static-yaml"
+	// SourceRegex marks heuristic matches in chart files.
+	SourceRegex SourceKind = "regex-scan"
+	// SourceManifest marks images in plain Kubernetes manifests.
+	SourceManifest SourceKind = "manifest"
+	// SourceKustomize marks images in the output of a Kustomize build.
+	SourceKustomize SourceKind = "kustomize"
 )
 
 type ImageFinding struct {
@@ -20,10 +32,66 @@ type ImageFinding struct {
 	Source     SourceKind `yaml:"source" json:"source"`
 	File       string     `yaml:"file,omitempty" json:"file,omitempty"`
 	Line       int        `yaml:"line,omitempty" json:"line,omitempty"`
+	Column     int        `yaml:"column,omitempty" json:"column,omitempty"`
+	// KeyPath is the key path of a static image in its file, such as
+	// "controller.sidecars[0].image"; for values files, the value to
+	// override.
+	KeyPath string `yaml:"keyPath,omitempty" json:"keyPath,omitempty"`
+	// TagInferred is set when the static detector took the tag from the
+	// chart's appVersion because its values leave the tag empty.
+	TagInferred bool `yaml:"tagInferred,omitempty" json:"tagInferred,omitempty"`
+
+	// Digest, Pinned and Platforms are set when the image is resolved
+	// against its registry; ResolveError records why resolution failed.
+	Digest       string   `yaml:"digest,omitempty" json:"digest,omitempty"`
+	Pinned       string   `yaml:"pinned,omitempty" json:"pinned,omitempty"`
+	Platforms    []string `yaml:"platforms,omitempty" json:"platforms,omitempty"`
+	ResolveError string   `yaml:"resolveError,omitempty" json:"resolveError,omitempty"`
+
+	// Resource is the rendered object the image was found in.
+	Resource *Resource `yaml:"resource,omitempty" json:"resource,omitempty"`
+}
+
+// Resource identifies the Kubernetes object and container a rendered image
+// belongs to.
+type Resource struct {
+	Kind      string `yaml:"kind" json:"kind"`
+	Name      string `yaml:"name,omitempty" json:"name,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Container string `yaml:"container,omitempty" json:"container,omitempty"`
+}
+
+// ChartMetadata is the part of the scanned chart's Chart.yaml reported with
+// the result.
+type ChartMetadata struct {
+	Name       string `yaml:"name" json:"name"`
+	Version    string `yaml:"version" json:"version"`
+	AppVersion string `yaml:"appVersion,omitempty" json:"appVersion,omitempty"`
 }
 
 type ScanResult struct {
 	Images []ImageFinding `yaml:"images" json:"images"`
+	Chart  *ChartMetadata `yaml:"chart,omitempty" json:"chart,omitempty"`
+	// Releases holds the scan of each release when the input declares
+	// releases, such as Argo CD Applications; Images then lists the images
+	// of all releases.
+	Releases []ReleaseResult `yaml:"releases,omitempty" json:"releases,omitempty"`
+	// Diagnostics reports how each detector fared on a chart. It is not
+	// set for manifest inputs, which are read without detectors.
+	Diagnostics *Diagnostics `yaml:"diagnostics,omitempty" json:"diagnostics,omitempty"`
+}
+
+// ReleaseResult is the scan of one release. Error records why the
+// release's chart could not be scanned.
+type ReleaseResult struct {
+	Name        string         `yaml:"name" json:"name"`
+	Kind        string         `yaml:"kind" json:"kind"`
+	Namespace   string         `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	ChartRef    string         `yaml:"chartRef" json:"chartRef"`
+	Chart       *ChartMetadata `yaml:"chart,omitempty" json:"chart,omitempty"`
+	Images      []ImageFinding `yaml:"images" json:"images"`
+	Diagnostics *Diagnostics   `yaml:"diagnostics,omitempty" json:"diagnostics,omitempty"`
+	Error       string         `yaml:"error,omitempty" json:"error,omitempty"`
 }
 
 // Options controls a scan invocation.
@@ -39,11 +107,22 @@ type Options struct {
 	IncludeOptionalDeps bool
 	MinConfidence       Confidence
 	Verbose             bool
+	// ResolveDigests queries each image's registry for its manifest digest
+	// and records it on the finding.
+	ResolveDigests bool
+	// ResolvePlatforms queries each image's registry for the OS/architecture
+	// platforms it supports.
+	ResolvePlatforms bool
+	// Detectors are run in order on charts; nil means DefaultDetectors.
+	Detectors []Detector
+	// Concurrency is how many detectors, subcharts and registry lookups
+	// run at once; values below one mean DefaultConcurrency. Results do
+	// not depend on it.
+	Concurrency int
+	// Logger receives the scan's log. Without one, warnings, and with
+	// Verbose debug messages, are written to stderr.
+	Logger *slog.Logger
 }
 
-// Run is deprecated; the CLI is now implemented with Cobra in internal/cli.
-// It is kept only for compatibility with any existing callers and will be
-// removed in a future version.
-func Run() error {
-	return fmt.Errorf("scan.Run is deprecated; use the heft CLI entrypoint instead")
-}
+// ErrNoImages is returned, wrapped, when a scan finds no images.
+var ErrNoImages = errors.New("no images found")
@@ -1,9 +0,0 @@
-package scan
-
-import "testing"
-
-func TestRunIsDeprecated(t *testing.T) {
-	if err := Run(); err == nil {
-		t.Fatalf("expected error from Run, got nil")
-	}
-}
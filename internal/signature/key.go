@@ -0,0 +1,62 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// PublicKey verifies cosign signatures.
+type PublicKey struct {
+	key crypto.PublicKey
+}
+
+// LoadPublicKey reads a PEM encoded public key as written by
+// 'cosign generate-key-pair' (ECDSA P-256) or an RSA or Ed25519 key.
+func LoadPublicKey(path string) (*PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	return ParsePublicKey(data)
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("parse key: expected a PEM encoded PUBLIC KEY")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse key: %w", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return &PublicKey{key: key}, nil
+	default:
+		return nil, fmt.Errorf("parse key: unsupported key type %T", key)
+	}
+}
+
+// verify checks signature over payload. ECDSA and RSA signatures are over
+// the payload's SHA-256 digest, as cosign signs them.
+func (k *PublicKey) verify(payload, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil ||
+			rsa.VerifyPSS(key, crypto.SHA256, digest[:], signature, nil) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, signature)
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+// Package signature verifies cosign signatures of images with a public
+// key, without contacting a transparency log.
+package signature
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Cosign media types and annotations.
+const (
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	ArtifactTypeSignature  = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	AnnotationSignature    = "dev.cosignproject.cosign/signature"
+)
+
+// maxPayloadSize bounds the signature payloads read from a registry.
+const maxPayloadSize = 1 << 20
+
+// Status is the outcome of verifying an image.
+type Status string
+
+const (
+	// StatusSigned means at least one signature verified with the key.
+	StatusSigned Status = "signed"
+	// StatusUnsigned means no cosign signature was found.
+	StatusUnsigned Status = "unsigned"
+	// StatusInvalid means signatures exist but none verified with the key
+	// for the image's digest.
+	StatusInvalid Status = "invalid"
+	// StatusError means the image could not be checked.
+	StatusError Status = "error"
+)
+
+// Result is the verification outcome of one image.
+type Result struct {
+	Image      string `yaml:"image" json:"image"`
+	Digest     string `yaml:"digest,omitempty" json:"digest,omitempty"`
+	Status     Status `yaml:"status" json:"status"`
+	Signatures int    `yaml:"signatures" json:"signatures"`
+	Message    string `yaml:"message,omitempty" json:"message,omitempty"`
+}
+
+// Summary counts results by status.
+type Summary struct {
+	Images   int `yaml:"images" json:"images"`
+	Signed   int `yaml:"signed" json:"signed"`
+	Unsigned int `yaml:"unsigned" json:"unsigned"`
+	Invalid  int `yaml:"invalid" json:"invalid"`
+	Failed   int `yaml:"failed" json:"failed"`
+}
+
+// Report is the outcome of Verify.
+type Report struct {
+	Summary Summary  `yaml:"summary" json:"summary"`
+	Images  []Result `yaml:"images" json:"images"`
+}
+
+// Options controls verification.
+type Options struct {
+	Key    *PublicKey
+	Client *registry.Client
+}
+
+// payload is the cosign simple signing payload.
+type payload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// Verify checks the cosign signatures of every image. Signatures are looked
+// up under the "sha256-<hex>.sig" tag cosign pushes by default and, when
+// that tag does not exist, through the OCI referrers API.
+func Verify(ctx context.Context, images []scan.ImageFinding, options Options) *Report {
+	client := options.Client
+	if client == nil {
+		client = &registry.Client{}
+	}
+
+	report := &Report{Images: []Result{}}
+	for _, image := range images {
+		result := verifyImage(ctx, client, options.Key, image.Name)
+		report.Images = append(report.Images, result)
+		report.Summary.Images++
+		switch result.Status {
+		case StatusSigned:
+			report.Summary.Signed++
+		case StatusUnsigned:
+			report.Summary.Unsigned++
+		case StatusInvalid:
+			report.Summary.Invalid++
+		default:
+			report.Summary.Failed++
+		}
+	}
+	return report
+}
+
+func verifyImage(ctx context.Context, client *registry.Client, key *PublicKey, name string) Result {
+	result := Result{Image: name}
+	fail := func(err error) Result {
+		result.Status, result.Message = StatusError, err.Error()
+		return result
+	}
+
+	reference, err := registry.ParseReference(name)
+	if err != nil {
+		return fail(err)
+	}
+	if reference.Tag == "" && reference.Digest == "" {
+		reference.Tag = registry.DefaultTag
+	}
+	if result.Digest, err = client.ResolveDigest(ctx, reference); err != nil {
+		return fail(err)
+	}
+
+	manifests, err := signatureManifests(ctx, client, reference, result.Digest)
+	if err != nil {
+		return fail(err)
+	}
+
+	var problems []string
+	for _, manifest := range manifests {
+		for _, layer := range manifest.Layers {
+			encoded, ok := layer.Annotations[AnnotationSignature]
+			if layer.MediaType != MediaTypeSimpleSigning || !ok {
+				continue
+			}
+			result.Signatures++
+			if problem := verifyLayer(ctx, client, key, reference, result.Digest, layer, encoded); problem != "" {
+				problems = append(problems, problem)
+				continue
+			}
+			result.Status = StatusSigned
+			return result
+		}
+	}
+
+	if result.Signatures == 0 {
+		result.Status, result.Message = StatusUnsigned, "no cosign signature found"
+		return result
+	}
+	result.Status, result.Message = StatusInvalid, strings.Join(problems, "; ")
+	return result
+}
+
+// signatureManifests returns the cosign signature manifests of the image
+// with digest in reference's repository.
+func signatureManifests(ctx context.Context, client *registry.Client, reference registry.Reference, digest string) ([]registry.Manifest, error) {
+	signatureReference := registry.Reference{
+		Registry:   reference.Registry,
+		Repository: reference.Repository,
+		Tag:        strings.Replace(digest, ":", "-", 1) + ".sig",
+	}
+	data, _, _, err := client.GetManifest(ctx, signatureReference)
+	if err == nil {
+		var manifest registry.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("parse signature manifest %s: %w", signatureReference, err)
+		}
+		return []registry.Manifest{manifest}, nil
+	}
+	if !registry.IsNotFound(err) {
+		return nil, err
+	}
+
+	descriptors, err := client.Referrers(ctx, reference, digest, ArtifactTypeSignature)
+	if registry.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifests []registry.Manifest
+	for _, descriptor := range descriptors {
+		referrer := registry.Reference{Registry: reference.Registry, Repository: reference.Repository, Digest: descriptor.Digest}
+		data, _, _, err := client.GetManifest(ctx, referrer)
+		if err != nil {
+			return nil, err
+		}
+		var manifest registry.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("parse signature manifest %s: %w", referrer, err)
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
+
+// verifyLayer checks one signature layer and returns why it is invalid, or
+// "" when it verifies for digest.
+func verifyLayer(ctx context.Context, client *registry.Client, key *PublicKey, reference registry.Reference, digest string, layer registry.Descriptor, encoded string) string {
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "signature is not base64"
+	}
+	blob, err := client.GetBlob(ctx, reference, layer.Digest)
+	if err != nil {
+		return fmt.Sprintf("fetch payload: %v", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(blob, maxPayloadSize))
+	blob.Close()
+	if err != nil {
+		return fmt.Sprintf("fetch payload: %v", err)
+	}
+	if registry.Digest(data) != layer.Digest {
+		return "payload digest mismatch"
+	}
+	if !key.verify(data, signature) {
+		return "signature does not match the key"
+	}
+
+	var signed payload
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return "payload is not a cosign simple signing payload"
+	}
+	if signed.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Sprintf("signature is for %s", signed.Critical.Image.DockerManifestDigest)
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+)
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, *PublicKey) {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParsePublicKey() returned error: %v", err)
+	}
+	return private, public
+}
+
+// sign pushes a cosign signature of the image with digest, under the
+// .sig tag or, with referrer set, as an OCI referrer.
+func sign(t *testing.T, server *registrytest.Registry, repository, digest string, key *ecdsa.PrivateKey, referrer bool) {
+	t.Helper()
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, repository, digest))
+	sum := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := []byte(`{}`)
+	manifest := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		Config:        registry.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: server.AddBlob(repository, config), Size: int64(len(config))},
+		Layers: []registry.Descriptor{{
+			MediaType:   MediaTypeSimpleSigning,
+			Digest:      server.AddBlob(repository, payload),
+			Size:        int64(len(payload)),
+			Annotations: map[string]string{AnnotationSignature: base64.StdEncoding.EncodeToString(signature)},
+		}},
+	}
+	tag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	if referrer {
+		manifest.ArtifactType = ArtifactTypeSignature
+		manifest.Subject = &registry.Descriptor{MediaType: registry.MediaTypeOCIManifest, Digest: digest}
+		tag = ""
+	}
+	data, _ := json.Marshal(manifest)
+	server.AddManifest(repository, tag, registry.MediaTypeOCIManifest, data)
+}
+
+// TestVerifyReportsSignedUnsignedAndInvalid verifies signatures found by
+// tag and through the referrers API, and that a signature by another key
+// or for another digest is invalid.
+func TestVerifyReportsSignedUnsignedAndInvalid(t *testing.T) {
+	server := registrytest.New(t)
+	key, public := newKey(t)
+	otherKey, _ := newKey(t)
+
+	tagged := server.AddImage("org/tagged", "v1", []byte(`{"architecture":"amd64"}`))
+	sign(t, server, "org/tagged", tagged, key, false)
+	referred := server.AddImage("org/referred", "v1", []byte(`{"architecture":"arm64"}`))
+	sign(t, server, "org/referred", referred, key, true)
+	server.AddImage("org/unsigned", "v1", []byte(`{}`))
+	forged := server.AddImage("org/forged", "v1", []byte(`{"os":"linux"}`))
+	sign(t, server, "org/forged", forged, otherKey, false)
+
+	var images []scan.ImageFinding
+	for _, repository := range []string{"tagged", "referred", "unsigned", "forged"} {
+		images = append(images, scan.ImageFinding{Name: server.Host() + "/org/" + repository + ":v1"})
+	}
+	report := Verify(context.Background(), images, Options{Key: public})
+
+	want := []Status{StatusSigned, StatusSigned, StatusUnsigned, StatusInvalid}
+	for i, result := range report.Images {
+		if result.Status != want[i] {
+			t.Errorf("%s: status %s (%s), want %s", result.Image, result.Status, result.Message, want[i])
+		}
+	}
+	if report.Images[0].Digest != tagged {
+		t.Errorf("expected the resolved digest to be reported, got %q", report.Images[0].Digest)
+	}
+	if report.Summary != (Summary{Images: 4, Signed: 2, Unsigned: 1, Invalid: 1}) {
+		t.Errorf("unexpected summary: %+v", report.Summary)
+	}
+}
@@ -0,0 +1,271 @@
+package vulns
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Advisory is an OSV vulnerability record, reduced to the fields used for
+// matching OS packages.
+type Advisory struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected         []Affected     `json:"affected"`
+	DatabaseSpecific map[string]any `json:"database_specific"`
+}
+
+// Affected lists the affected versions of one package.
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges []struct {
+		Type   string  `json:"type"`
+		Events []Event `json:"events"`
+	} `json:"ranges"`
+	Versions          []string       `json:"versions"`
+	EcosystemSpecific map[string]any `json:"ecosystem_specific"`
+}
+
+// Event is an OSV range event; exactly one field is set.
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+// Database is a local set of advisories indexed by package name.
+type Database struct {
+	advisories []*Advisory
+	byPackage  map[string][]int
+}
+
+// LoadDatabase reads OSV advisories from path: a JSON file holding one
+// advisory or an array of them, a .zip of such files as published in the
+// OSV ecosystem exports, or a directory searched recursively for both.
+func LoadDatabase(path string) (*Database, error) {
+	database := &Database{byPackage: map[string][]int{}}
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return nil
+		case strings.HasSuffix(file, ".zip"):
+			return database.addZip(file)
+		case strings.HasSuffix(file, ".json") || file == path:
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			return database.add(file, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load vulnerability database: %w", err)
+	}
+	if len(database.advisories) == 0 {
+		return nil, fmt.Errorf("load vulnerability database: no advisories found in %s", path)
+	}
+	return database, nil
+}
+
+func (d *Database) addZip(path string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, ".json") {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+		if err := d.add(path+"/"+file.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Database) add(name string, data []byte) error {
+	var advisories []*Advisory
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &advisories); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	} else {
+		var advisory Advisory
+		if err := json.Unmarshal(trimmed, &advisory); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		advisories = append(advisories, &advisory)
+	}
+
+	for _, advisory := range advisories {
+		if advisory.ID == "" {
+			continue
+		}
+		index := len(d.advisories)
+		d.advisories = append(d.advisories, advisory)
+		seen := map[string]bool{}
+		for _, affected := range advisory.Affected {
+			if name := affected.Package.Name; !seen[name] {
+				seen[name] = true
+				d.byPackage[name] = append(d.byPackage[name], index)
+			}
+		}
+	}
+	return nil
+}
+
+// Len returns the number of advisories loaded.
+func (d *Database) Len() int {
+	return len(d.advisories)
+}
+
+// Match returns the vulnerabilities affecting pkg, one per advisory.
+func (d *Database) Match(pkg Package) []Vulnerability {
+	var vulnerabilities []Vulnerability
+	for _, index := range d.byPackage[pkg.Name] {
+		advisory := d.advisories[index]
+		for _, affected := range advisory.Affected {
+			if affected.Package.Name != pkg.Name || !ecosystemMatches(affected.Package.Ecosystem, pkg.Ecosystem) {
+				continue
+			}
+			fixed, ok := affected.affects(pkg.Version)
+			if !ok {
+				continue
+			}
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:       advisory.ID,
+				Aliases:  advisory.Aliases,
+				Package:  pkg.Name,
+				Version:  pkg.Version,
+				Fixed:    fixed,
+				Severity: advisory.severity(affected),
+				Summary:  advisory.Summary,
+			})
+			break
+		}
+	}
+	return vulnerabilities
+}
+
+// ecosystemMatches reports whether an advisory's ecosystem covers a
+// package's. "Ubuntu:22.04:LTS" covers "Ubuntu:22.04".
+func ecosystemMatches(advisory, pkg string) bool {
+	return advisory == pkg || strings.HasPrefix(advisory, pkg+":")
+}
+
+// affects reports whether version is affected and, if so, the version
+// that fixes it, evaluating OSV ranges as the OSV schema specifies.
+func (a Affected) affects(version string) (string, bool) {
+	for _, listed := range a.Versions {
+		if listed == version {
+			return "", true
+		}
+	}
+	for _, versionRange := range a.Ranges {
+		if versionRange.Type != "ECOSYSTEM" {
+			continue
+		}
+		events := append([]Event(nil), versionRange.Events...)
+		sort.SliceStable(events, func(i, j int) bool {
+			return compareEvents(events[i], events[j]) < 0
+		})
+
+		affected, fixed := false, ""
+	events:
+		for _, event := range events {
+			switch {
+			case event.Introduced != "":
+				if event.Introduced != "0" && compareVersions(version, event.Introduced) < 0 {
+					break events
+				}
+				affected = true
+			case event.Fixed != "":
+				if compareVersions(version, event.Fixed) < 0 {
+					if affected {
+						fixed = event.Fixed
+					}
+					break events
+				}
+				affected = false
+			case event.LastAffected != "":
+				if compareVersions(version, event.LastAffected) <= 0 {
+					break events
+				}
+				affected = false
+			}
+		}
+		if affected {
+			return fixed, true
+		}
+	}
+	return "", false
+}
+
+// compareEvents orders range events by version, with "0" first.
+func compareEvents(a, b Event) int {
+	aVersion, bVersion := a.version(), b.version()
+	switch {
+	case aVersion == bVersion:
+		return 0
+	case aVersion == "0":
+		return -1
+	case bVersion == "0":
+		return 1
+	}
+	return compareVersions(aVersion, bVersion)
+}
+
+func (e Event) version() string {
+	return e.Introduced + e.Fixed + e.LastAffected
+}
+
+// severity rates an advisory by its CVSS v3 vector or, lacking one, by the
+// severity, priority or urgency label of its source.
+func (a *Advisory) severity(affected Affected) Severity {
+	for _, severity := range a.Severity {
+		if strings.HasPrefix(severity.Type, "CVSS_V3") {
+			if score, err := cvss3Score(severity.Score); err == nil {
+				return cvssSeverity(score)
+			}
+		}
+	}
+	for _, fields := range []map[string]any{affected.EcosystemSpecific, a.DatabaseSpecific} {
+		for _, key := range []string{"severity", "priority", "urgency"} {
+			if label, ok := fields[key].(string); ok {
+				if severity := normalizeSeverity(label); severity != SeverityUnknown {
+					return severity
+				}
+			}
+		}
+	}
+	return SeverityUnknown
+}
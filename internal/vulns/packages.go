@@ -0,0 +1,295 @@
+package vulns
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/tonur/heft/internal/registry"
+)
+
+// Package is an installed OS package. Name and Version are those of the
+// source package when known, as distribution advisories are keyed by it.
+type Package struct {
+	Ecosystem string `yaml:"ecosystem" json:"ecosystem"`
+	Name      string `yaml:"name" json:"name"`
+	Version   string `yaml:"version" json:"version"`
+}
+
+// Package database files read from image layers.
+const (
+	apkInstalled = "lib/apk/db/installed"
+	dpkgStatus   = "var/lib/dpkg/status"
+	dpkgStatusD  = "var/lib/dpkg/status.d/"
+)
+
+var osReleaseFiles = []string{"etc/os-release", "usr/lib/os-release"}
+
+// ImagePackages pulls the layers of the image at reference for platform
+// and returns the OS packages recorded in its apk or dpkg database.
+func ImagePackages(ctx context.Context, client *registry.Client, reference registry.Reference, platform registry.Platform) ([]Package, error) {
+	manifest, err := imageManifest(ctx, client, reference, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	for _, layer := range manifest.Layers {
+		blob, err := client.GetBlob(ctx, reference, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		err = readLayer(blob, files)
+		blob.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read layer %s of %s: %w", layer.Digest, reference, err)
+		}
+	}
+	return installedPackages(files)
+}
+
+// imageManifest fetches the manifest of reference, selecting platform from
+// an index.
+func imageManifest(ctx context.Context, client *registry.Client, reference registry.Reference, platform registry.Platform) (*registry.Manifest, error) {
+	data, _, mediaType, err := client.GetManifest(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	if registry.IsIndex(mediaType) {
+		var index registry.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("parse index %s: %w", reference, err)
+		}
+		selected := ""
+		for _, descriptor := range index.Manifests {
+			if descriptor.Platform != nil && descriptor.Platform.Satisfies(platform) {
+				selected = descriptor.Digest
+				break
+			}
+		}
+		if selected == "" {
+			return nil, fmt.Errorf("image %s has no %s manifest", reference, platform)
+		}
+		platformReference := reference
+		platformReference.Digest = selected
+		if data, _, _, err = client.GetManifest(ctx, platformReference); err != nil {
+			return nil, err
+		}
+	}
+	var manifest registry.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", reference, err)
+	}
+	return &manifest, nil
+}
+
+// readLayer applies a tar or gzipped tar layer to files, keeping only the
+// package database and os-release files and honouring whiteouts.
+func readLayer(blob io.Reader, files map[string][]byte) error {
+	reader := bufio.NewReader(blob)
+	if magic, _ := reader.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		blob = gzipReader
+	} else {
+		blob = reader
+	}
+
+	archive := tar.NewReader(blob)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		directory, base := path.Split(name)
+		switch {
+		case base == ".wh..wh..opq":
+			for file := range files {
+				if strings.HasPrefix(file, directory) {
+					delete(files, file)
+				}
+			}
+			continue
+		case strings.HasPrefix(base, ".wh."):
+			delete(files, directory+strings.TrimPrefix(base, ".wh."))
+			continue
+		}
+		if header.Typeflag != tar.TypeReg || !packageFile(name) {
+			continue
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		files[name] = data
+	}
+}
+
+func packageFile(name string) bool {
+	for _, file := range osReleaseFiles {
+		if name == file {
+			return true
+		}
+	}
+	return name == apkInstalled || name == dpkgStatus || strings.HasPrefix(name, dpkgStatusD)
+}
+
+// installedPackages parses the package databases in files, tagging each
+// package with the OSV ecosystem of the distribution in os-release.
+func installedPackages(files map[string][]byte) ([]Package, error) {
+	var osRelease []byte
+	for _, file := range osReleaseFiles {
+		if data, ok := files[file]; ok {
+			osRelease = data
+			break
+		}
+	}
+	if osRelease == nil {
+		return nil, fmt.Errorf("no os-release file found; only Linux distribution images are supported")
+	}
+	id, versionID := parseOSRelease(osRelease)
+	ecosystem, err := distributionEcosystem(id, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []Package
+	if data, ok := files[apkInstalled]; ok {
+		packages = append(packages, parseAPKInstalled(data)...)
+	}
+	for name, data := range files {
+		if name == dpkgStatus || strings.HasPrefix(name, dpkgStatusD) {
+			packages = append(packages, parseDpkgStatus(data)...)
+		}
+	}
+	for i := range packages {
+		packages[i].Ecosystem = ecosystem
+	}
+	return dedupePackages(packages), nil
+}
+
+// parseOSRelease returns the ID and VERSION_ID of an os-release file.
+func parseOSRelease(data []byte) (id, versionID string) {
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			id = value
+		case "VERSION_ID":
+			versionID = value
+		}
+	}
+	return id, versionID
+}
+
+// distributionEcosystem returns the OSV ecosystem of a distribution, such
+// as "Alpine:v3.19" or "Debian:12".
+func distributionEcosystem(id, versionID string) (string, error) {
+	switch id {
+	case "alpine":
+		parts := strings.SplitN(versionID, ".", 3)
+		if len(parts) < 2 {
+			return "", fmt.Errorf("unrecognised Alpine version %q", versionID)
+		}
+		return "Alpine:v" + parts[0] + "." + parts[1], nil
+	case "debian":
+		if versionID == "" {
+			return "", fmt.Errorf("Debian testing and unstable images are not supported")
+		}
+		return "Debian:" + strings.SplitN(versionID, ".", 2)[0], nil
+	case "ubuntu":
+		return "Ubuntu:" + versionID, nil
+	case "wolfi":
+		return "Wolfi", nil
+	case "chainguard":
+		return "Chainguard", nil
+	default:
+		return "", fmt.Errorf("unsupported distribution %q", id)
+	}
+}
+
+// parseAPKInstalled reads an apk installed database, using each package's
+// origin as its name.
+func parseAPKInstalled(data []byte) []Package {
+	var packages []Package
+	for _, block := range strings.Split(string(data), "\n\n") {
+		var name, origin, version string
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "P:"):
+				name = line[2:]
+			case strings.HasPrefix(line, "o:"):
+				origin = line[2:]
+			case strings.HasPrefix(line, "V:"):
+				version = line[2:]
+			}
+		}
+		if origin != "" {
+			name = origin
+		}
+		if name != "" && version != "" {
+			packages = append(packages, Package{Name: name, Version: version})
+		}
+	}
+	return packages
+}
+
+// parseDpkgStatus reads a dpkg status file, using the source package and
+// version when the binary package names one.
+func parseDpkgStatus(data []byte) []Package {
+	var packages []Package
+	for _, stanza := range strings.Split(string(data), "\n\n") {
+		fields := map[string]string{}
+		for _, line := range strings.Split(stanza, "\n") {
+			if key, value, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, " ") {
+				fields[key] = strings.TrimSpace(value)
+			}
+		}
+		if status, ok := fields["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			continue
+		}
+		name, version := fields["Package"], fields["Version"]
+		if source := fields["Source"]; source != "" {
+			sourceName, sourceVersion, hasVersion := strings.Cut(source, " ")
+			name = sourceName
+			if hasVersion {
+				version = strings.Trim(sourceVersion, "()")
+			}
+		}
+		if name != "" && version != "" {
+			packages = append(packages, Package{Name: name, Version: version})
+		}
+	}
+	return packages
+}
+
+func dedupePackages(packages []Package) []Package {
+	seen := map[Package]bool{}
+	var unique []Package
+	for _, pkg := range packages {
+		if !seen[pkg] {
+			seen[pkg] = true
+			unique = append(unique, pkg)
+		}
+	}
+	return unique
+}
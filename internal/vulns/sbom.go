@@ -0,0 +1,104 @@
+package vulns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ReadSBOM returns the OS packages listed in a CycloneDX or SPDX JSON SBOM,
+// identified by their apk and deb package URLs. Other packages are ignored.
+func ReadSBOM(path string) ([]Package, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read sbom: %w", err)
+	}
+	var document struct {
+		// CycloneDX
+		Components []struct {
+			PURL string `json:"purl"`
+		} `json:"components"`
+		// SPDX
+		Packages []struct {
+			ExternalRefs []struct {
+				ReferenceType    string `json:"referenceType"`
+				ReferenceLocator string `json:"referenceLocator"`
+			} `json:"externalRefs"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("sbom %s: %w", path, err)
+	}
+
+	var purls []string
+	for _, component := range document.Components {
+		purls = append(purls, component.PURL)
+	}
+	for _, spdxPackage := range document.Packages {
+		for _, reference := range spdxPackage.ExternalRefs {
+			if reference.ReferenceType == "purl" {
+				purls = append(purls, reference.ReferenceLocator)
+			}
+		}
+	}
+
+	var packages []Package
+	for _, purl := range purls {
+		if pkg, ok := purlPackage(purl); ok {
+			packages = append(packages, pkg)
+		}
+	}
+	if len(packages) == 0 {
+		return nil, fmt.Errorf("sbom %s lists no apk or deb packages", path)
+	}
+	return dedupePackages(packages), nil
+}
+
+// purlPackage converts an apk or deb package URL such as
+// pkg:deb/debian/libssl3@3.0.11-1?distro=debian-12&upstream=openssl to a
+// source package in its OSV ecosystem.
+func purlPackage(purl string) (Package, bool) {
+	rest, ok := strings.CutPrefix(purl, "pkg:")
+	if !ok {
+		return Package{}, false
+	}
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	rest, _, _ = strings.Cut(rest, "#")
+	query, _ := url.ParseQuery(rawQuery)
+
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) != 3 || (parts[0] != "apk" && parts[0] != "deb") {
+		return Package{}, false
+	}
+	nameVersion, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return Package{}, false
+	}
+	name, version, ok := strings.Cut(nameVersion, "@")
+	if !ok {
+		return Package{}, false
+	}
+	if upstream := query.Get("upstream"); upstream != "" {
+		// Syft records the source package as name or name@version.
+		upstreamName, upstreamVersion, hasVersion := strings.Cut(upstream, "@")
+		name = upstreamName
+		if hasVersion {
+			version = upstreamVersion
+		}
+	}
+
+	// The distro qualifier is "alpine-3.19.0" as written by Syft or just
+	// the version, "3.19.0", as written by Trivy.
+	distro := query.Get("distro")
+	id, versionID := parts[1], distro
+	if prefix, suffix, ok := strings.Cut(distro, "-"); ok && prefix != "" && (prefix[0] < '0' || prefix[0] > '9') {
+		id, versionID = prefix, suffix
+	}
+	ecosystem, err := distributionEcosystem(id, versionID)
+	if err != nil {
+		return Package{}, false
+	}
+	return Package{Ecosystem: ecosystem, Name: name, Version: version}, true
+}
@@ -0,0 +1,158 @@
+package vulns
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Severity ranks vulnerabilities.
+type Severity string
+
+const (
+	SeverityUnknown  Severity = "unknown"
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+	// SeverityNone as a fail-on threshold never fails.
+	SeverityNone Severity = "none"
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityLow:
+		return 1
+	case SeverityMedium:
+		return 2
+	case SeverityHigh:
+		return 3
+	case SeverityCritical:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// AtLeast reports whether s is as severe as threshold. Nothing reaches
+// SeverityNone, and unknown severities only reach unknown.
+func (s Severity) AtLeast(threshold Severity) bool {
+	if threshold == SeverityNone {
+		return false
+	}
+	return s.rank() >= threshold.rank()
+}
+
+// ParseSeverity validates a fail-on threshold.
+func ParseSeverity(value string) (Severity, error) {
+	switch severity := Severity(value); severity {
+	case SeverityUnknown, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical, SeverityNone:
+		return severity, nil
+	default:
+		return "", fmt.Errorf("invalid severity %q (want unknown, low, medium, high, critical or none)", value)
+	}
+}
+
+// normalizeSeverity maps the severity, priority and urgency labels used by
+// advisory sources to a Severity.
+func normalizeSeverity(label string) Severity {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "critical":
+		return SeverityCritical
+	case "high", "important":
+		return SeverityHigh
+	case "medium", "moderate":
+		return SeverityMedium
+	case "low", "negligible", "unimportant":
+		return SeverityLow
+	default:
+		return SeverityUnknown
+	}
+}
+
+// cvssSeverity rates a score with the CVSS v3 qualitative scale.
+func cvssSeverity(score float64) Severity {
+	switch {
+	case score >= 9:
+		return SeverityCritical
+	case score >= 7:
+		return SeverityHigh
+	case score >= 4:
+		return SeverityMedium
+	case score > 0:
+		return SeverityLow
+	default:
+		return SeverityUnknown
+	}
+}
+
+var cvssWeights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvss3Score computes the base score of a CVSS v3.x vector such as
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H".
+func cvss3Score(vector string) (float64, error) {
+	parts := strings.Split(vector, "/")
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, fmt.Errorf("not a CVSS v3 vector: %q", vector)
+	}
+	metrics := map[string]string{}
+	for _, part := range parts[1:] {
+		name, value, ok := strings.Cut(part, ":")
+		if !ok {
+			return 0, fmt.Errorf("invalid CVSS metric %q", part)
+		}
+		metrics[name] = value
+	}
+
+	changed := metrics["S"] == "C"
+	if metrics["S"] != "U" && !changed {
+		return 0, fmt.Errorf("invalid CVSS scope in %q", vector)
+	}
+	weight := map[string]float64{}
+	for name, values := range cvssWeights {
+		value, ok := values[metrics[name]]
+		if !ok {
+			return 0, fmt.Errorf("invalid CVSS metric %s in %q", name, vector)
+		}
+		weight[name] = value
+	}
+	privileges := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	if changed {
+		privileges = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}
+	}
+	privilege, ok := privileges[metrics["PR"]]
+	if !ok {
+		return 0, fmt.Errorf("invalid CVSS metric PR in %q", vector)
+	}
+
+	impactSubScore := 1 - (1-weight["C"])*(1-weight["I"])*(1-weight["A"])
+	impact := 6.42 * impactSubScore
+	if changed {
+		impact = 7.52*(impactSubScore-0.029) - 3.25*math.Pow(impactSubScore-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, nil
+	}
+	exploitability := 8.22 * weight["AV"] * weight["AC"] * privilege * weight["UI"]
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), nil
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), nil
+}
+
+// roundUp rounds up to one decimal as defined by CVSS v3.1, avoiding
+// floating point artefacts.
+func roundUp(value float64) float64 {
+	integer := int(math.Round(value * 100000))
+	if integer%10000 == 0 {
+		return float64(integer) / 100000
+	}
+	return (math.Floor(float64(integer)/10000) + 1) / 10
+}
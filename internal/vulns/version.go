@@ -0,0 +1,95 @@
+package vulns
+
+import "strings"
+
+// compareVersions orders distribution package versions with the Debian
+// algorithm: an optional epoch, then the upstream version and revision
+// compared in alternating non-digit and digit runs, where "~" sorts before
+// everything. Alpine's _alpha, _beta, _pre and _rc suffixes are treated
+// as "~" so they sort before the release, as apk does.
+func compareVersions(a, b string) int {
+	a, b = apkSuffixes.Replace(a), apkSuffixes.Replace(b)
+	aEpoch, aRest := splitEpoch(a)
+	bEpoch, bRest := splitEpoch(b)
+	if result := compareSegment(aEpoch, bEpoch); result != 0 {
+		return result
+	}
+	aUpstream, aRevision := splitRevision(aRest)
+	bUpstream, bRevision := splitRevision(bRest)
+	if result := compareSegment(aUpstream, bUpstream); result != 0 {
+		return result
+	}
+	return compareSegment(aRevision, bRevision)
+}
+
+var apkSuffixes = strings.NewReplacer("_alpha", "~alpha", "_beta", "~beta", "_pre", "~pre", "_rc", "~rc")
+
+func splitEpoch(version string) (string, string) {
+	if epoch, rest, ok := strings.Cut(version, ":"); ok {
+		return epoch, rest
+	}
+	return "0", version
+}
+
+func splitRevision(version string) (string, string) {
+	if index := strings.LastIndex(version, "-"); index != -1 {
+		return version[:index], version[index+1:]
+	}
+	return version, ""
+}
+
+// compareSegment implements dpkg's verrevcmp.
+func compareSegment(a, b string) int {
+	for a != "" || b != "" {
+		var aText, bText string
+		aText, a = splitPrefix(a, false)
+		bText, b = splitPrefix(b, false)
+		for i := 0; i < len(aText) || i < len(bText); i++ {
+			if result := orderOf(aText, i) - orderOf(bText, i); result != 0 {
+				if result < 0 {
+					return -1
+				}
+				return 1
+			}
+		}
+
+		var aDigits, bDigits string
+		aDigits, a = splitPrefix(a, true)
+		bDigits, b = splitPrefix(b, true)
+		aDigits, bDigits = strings.TrimLeft(aDigits, "0"), strings.TrimLeft(bDigits, "0")
+		if len(aDigits) != len(bDigits) {
+			if len(aDigits) < len(bDigits) {
+				return -1
+			}
+			return 1
+		}
+		if result := strings.Compare(aDigits, bDigits); result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+func splitPrefix(s string, digits bool) (string, string) {
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9') == digits {
+		end++
+	}
+	return s[:end], s[end:]
+}
+
+// orderOf returns the dpkg sort weight of s[i]: "~" before the end of the
+// string, before letters, before other characters.
+func orderOf(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	switch c := s[i]; {
+	case c == '~':
+		return -1
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
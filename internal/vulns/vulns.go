@@ -0,0 +1,148 @@
+// Package vulns matches the OS packages of a chart's images against a
+// local OSV advisory database, without contacting any vulnerability
+// service.
+package vulns
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Vulnerability is an advisory affecting an installed package.
+type Vulnerability struct {
+	ID       string   `yaml:"id" json:"id"`
+	Aliases  []string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	Package  string   `yaml:"package" json:"package"`
+	Version  string   `yaml:"version" json:"version"`
+	Fixed    string   `yaml:"fixed,omitempty" json:"fixed,omitempty"`
+	Severity Severity `yaml:"severity" json:"severity"`
+	Summary  string   `yaml:"summary,omitempty" json:"summary,omitempty"`
+}
+
+// ImageResult lists the vulnerabilities of one image. Source is where its
+// packages were read from, "layers" or "sbom"; Error records why the image
+// could not be checked.
+type ImageResult struct {
+	Image           string          `yaml:"image" json:"image"`
+	Source          string          `yaml:"source,omitempty" json:"source,omitempty"`
+	Ecosystem       string          `yaml:"ecosystem,omitempty" json:"ecosystem,omitempty"`
+	Packages        int             `yaml:"packages" json:"packages"`
+	Vulnerabilities []Vulnerability `yaml:"vulnerabilities" json:"vulnerabilities"`
+	Error           string          `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// Summary counts the distinct vulnerabilities across all images by
+// severity.
+type Summary struct {
+	Images          int              `yaml:"images" json:"images"`
+	Failed          int              `yaml:"failed" json:"failed"`
+	Vulnerabilities int              `yaml:"vulnerabilities" json:"vulnerabilities"`
+	BySeverity      map[Severity]int `yaml:"bySeverity" json:"bySeverity"`
+}
+
+// Report is the outcome of Check, per chart and per image.
+type Report struct {
+	Summary Summary       `yaml:"summary" json:"summary"`
+	Images  []ImageResult `yaml:"images" json:"images"`
+}
+
+// Options controls how image packages are found.
+type Options struct {
+	Database *Database
+	// Client pulls image layers.
+	Client *registry.Client
+	// Platform selects the image of a multi-platform index.
+	Platform registry.Platform
+	// SBOMs maps image names to SBOM files read instead of pulling the
+	// image.
+	SBOMs map[string]string
+	// NoPull skips images without an SBOM instead of pulling them.
+	NoPull bool
+}
+
+// Check matches the packages of every image against the database. Images
+// that cannot be read are recorded as failed rather than returned as
+// errors.
+func Check(ctx context.Context, images []scan.ImageFinding, options Options) *Report {
+	client := options.Client
+	if client == nil {
+		client = &registry.Client{}
+	}
+
+	report := &Report{Images: []ImageResult{}, Summary: Summary{BySeverity: map[Severity]int{}}}
+	distinct := map[string]Severity{}
+	for _, image := range images {
+		result := ImageResult{Image: image.Name, Vulnerabilities: []Vulnerability{}}
+		packages, err := imagePackages(ctx, client, image.Name, options, &result)
+		if err != nil {
+			result.Error = err.Error()
+			report.Summary.Failed++
+		}
+		result.Packages = len(packages)
+		if len(packages) > 0 {
+			result.Ecosystem = packages[0].Ecosystem
+		}
+		for _, pkg := range packages {
+			result.Vulnerabilities = append(result.Vulnerabilities, options.Database.Match(pkg)...)
+		}
+		sortVulnerabilities(result.Vulnerabilities)
+		for _, vulnerability := range result.Vulnerabilities {
+			distinct[vulnerability.ID] = vulnerability.Severity
+		}
+		report.Images = append(report.Images, result)
+		report.Summary.Images++
+	}
+
+	report.Summary.Vulnerabilities = len(distinct)
+	for _, severity := range distinct {
+		report.Summary.BySeverity[severity]++
+	}
+	return report
+}
+
+func imagePackages(ctx context.Context, client *registry.Client, name string, options Options, result *ImageResult) ([]Package, error) {
+	if path, ok := options.SBOMs[name]; ok {
+		result.Source = "sbom"
+		return ReadSBOM(path)
+	}
+	if options.NoPull {
+		return nil, fmt.Errorf("no SBOM given and pulling is disabled")
+	}
+	result.Source = "layers"
+	reference, err := registry.ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
+	return ImagePackages(ctx, client, reference, options.Platform)
+}
+
+// sortVulnerabilities orders vulnerabilities from most to least severe,
+// then by ID.
+func sortVulnerabilities(vulnerabilities []Vulnerability) {
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		a, b := vulnerabilities[i], vulnerabilities[j]
+		if a.Severity.rank() != b.Severity.rank() {
+			return a.Severity.rank() > b.Severity.rank()
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Package < b.Package
+	})
+}
+
+// Failing returns how many distinct vulnerabilities are at or above
+// threshold.
+func (r *Report) Failing(threshold Severity) int {
+	count := 0
+	for severity, n := range r.Summary.BySeverity {
+		if severity.AtLeast(threshold) {
+			count += n
+		}
+	}
+	return count
+}
@@ -0,0 +1,166 @@
+package vulns
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tonur/heft/internal/registry"
+	"github.com/tonur/heft/internal/registry/registrytest"
+	"github.com/tonur/heft/internal/scan"
+)
+
+const advisories = `[
+  {
+    "id": "ALPINE-CVE-2024-0001",
+    "aliases": ["CVE-2024-0001"],
+    "summary": "openssl overflow",
+    "severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}],
+    "affected": [{
+      "package": {"ecosystem": "Alpine:v3.19", "name": "openssl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.1.4-r1"}]}]
+    }]
+  },
+  {
+    "id": "ALPINE-CVE-2023-0002",
+    "affected": [{
+      "package": {"ecosystem": "Alpine:v3.19", "name": "openssl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.1.0-r0"}]}]
+    }]
+  },
+  {
+    "id": "DEBIAN-CVE-2024-0003",
+    "affected": [{
+      "package": {"ecosystem": "Debian:12", "name": "glibc"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "2.36-9+deb12u4"}]}],
+      "ecosystem_specific": {"urgency": "medium"}
+    }]
+  }
+]`
+
+func layer(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tarWriter.Write([]byte(content))
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	return buffer.Bytes()
+}
+
+func loadTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "osv.json")
+	if err := os.WriteFile(path, []byte(advisories), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	database, err := LoadDatabase(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("LoadDatabase() returned error: %v", err)
+	}
+	return database
+}
+
+// TestCheckMatchesPackagesFromImageLayers verifies that packages are read
+// from the apk database in the image's layers, with later layers replacing
+// earlier files, and matched against advisories by source package.
+func TestCheckMatchesPackagesFromImageLayers(t *testing.T) {
+	server := registrytest.New(t)
+	base := layer(t, map[string]string{
+		"etc/os-release":       "ID=alpine\nVERSION_ID=3.19.1\n",
+		"lib/apk/db/installed": "P:libssl3\nV:3.1.3-r0\no:openssl\n\n",
+	})
+	upgrade := layer(t, map[string]string{
+		"./lib/apk/db/installed": "P:libssl3\nV:3.1.4-r0\no:openssl\n\nP:busybox\nV:1.36.1-r15\n\n",
+	})
+	server.AddImage("org/app", "v1", []byte(`{}`), base, upgrade)
+
+	report := Check(context.Background(), []scan.ImageFinding{{Name: server.Host() + "/org/app:v1"}}, Options{
+		Database: loadTestDatabase(t),
+		Platform: registry.Platform{OS: "linux", Architecture: "amd64"},
+	})
+
+	image := report.Images[0]
+	if image.Error != "" {
+		t.Fatalf("unexpected error: %s", image.Error)
+	}
+	if image.Ecosystem != "Alpine:v3.19" || image.Packages != 2 || image.Source != "layers" {
+		t.Fatalf("unexpected image result: %+v", image)
+	}
+	if len(image.Vulnerabilities) != 1 {
+		t.Fatalf("expected one vulnerability, got %+v", image.Vulnerabilities)
+	}
+	vulnerability := image.Vulnerabilities[0]
+	if vulnerability.ID != "ALPINE-CVE-2024-0001" || vulnerability.Fixed != "3.1.4-r1" || vulnerability.Severity != SeverityCritical {
+		t.Fatalf("unexpected vulnerability: %+v", vulnerability)
+	}
+	if report.Failing(SeverityHigh) != 1 || report.Failing(SeverityNone) != 0 {
+		t.Fatalf("unexpected failing counts for %+v", report.Summary)
+	}
+}
+
+// TestCheckReadsSBOM verifies that an SBOM replaces pulling the image and
+// that deb packages are matched by their upstream source package.
+func TestCheckReadsSBOM(t *testing.T) {
+	sbom := filepath.Join(t.TempDir(), "sbom.json")
+	content := `{"bomFormat": "CycloneDX", "components": [
+	  {"purl": "pkg:deb/debian/libc6@2.36-9+deb12u3?arch=amd64&upstream=glibc&distro=debian-12"},
+	  {"purl": "pkg:npm/left-pad@1.3.0"}
+	]}`
+	if err := os.WriteFile(sbom, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := Check(context.Background(), []scan.ImageFinding{{Name: "registry.invalid/app:v1"}}, Options{
+		Database: loadTestDatabase(t),
+		SBOMs:    map[string]string{"registry.invalid/app:v1": sbom},
+		NoPull:   true,
+	})
+	image := report.Images[0]
+	if image.Source != "sbom" || image.Packages != 1 || len(image.Vulnerabilities) != 1 {
+		t.Fatalf("unexpected image result: %+v", image)
+	}
+	if got := image.Vulnerabilities[0]; got.ID != "DEBIAN-CVE-2024-0003" || got.Severity != SeverityMedium {
+		t.Fatalf("unexpected vulnerability: %+v", got)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		older, newer string
+	}{
+		{"3.1.4-r0", "3.1.4-r1"},
+		{"3.1.4-r9", "3.1.4-r10"},
+		{"1.2.3_rc1-r0", "1.2.3-r0"},
+		{"2.36-9+deb12u3", "2.36-9+deb12u4"},
+		{"1.0~beta1-1", "1.0-1"},
+		{"1:2.0-1", "2:1.0-1"},
+	} {
+		if compareVersions(test.older, test.newer) >= 0 || compareVersions(test.newer, test.older) <= 0 {
+			t.Errorf("expected %s < %s", test.older, test.newer)
+		}
+	}
+}
+
+func TestCVSS3Score(t *testing.T) {
+	for vector, want := range map[string]float64{
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H": 9.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N": 6.1,
+		"CVSS:3.0/AV:L/AC:L/PR:L/UI:N/S:U/C:N/I:N/A:N": 0,
+	} {
+		got, err := cvss3Score(vector)
+		if err != nil || got != want {
+			t.Errorf("cvss3Score(%q) = %v, %v; want %v", vector, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// Package heft finds the container images used by Helm charts, Kubernetes
+// manifests, Kustomize overlays and the releases declared by Argo CD, Flux
+// and helmfile, for use from Go programs. The heft CLI is built on it.
+//
+// The package follows semantic versioning: within a major version of the
+// module, exported identifiers are not removed or changed incompatibly,
+// and fields are only added to result types. Output fields keep their YAML
+// and JSON names.
+//
+// A Scanner is configured with functional options and can be reused:
+//
+//	scanner := heft.New(heft.WithMinConfidence(heft.ConfidenceMedium), heft.WithDigests())
+//	result, err := scanner.Scan(ctx, "oci://ghcr.io/org/charts/app:1.2.3")
+//	if errors.Is(err, heft.ErrNoImages) {
+//		// the chart uses no images
+//	}
+package heft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/tonur/heft/internal/helmfile"
+	"github.com/tonur/heft/internal/plugin"
+	"github.com/tonur/heft/internal/scan"
+)
+
+// Result types. They are shared with the CLI's YAML and JSON output.
+type (
+	// Result is the outcome of a scan: the images found and, when known,
+	// the chart and the releases they came from.
+	Result = scan.ScanResult
+	// Image is an image found by a scan.
+	Image = scan.ImageFinding
+	// Resource is the Kubernetes object and container an image was found
+	// in.
+	Resource = scan.Resource
+	// ChartMetadata is the name, version and appVersion of a chart.
+	ChartMetadata = scan.ChartMetadata
+	// ReleaseResult is the scan of one release.
+	ReleaseResult = scan.ReleaseResult
+	// Release is a chart deployed with its own values. Its Set entries are
+	// Helm flags, such as "--set=image.tag=1.0" or "--set-string=a=b".
+	Release = scan.Release
+	// Confidence ranks how an image was found.
+	Confidence = scan.Confidence
+	// Source tells which detector or input an image came from.
+	Source = scan.SourceKind
+	// Diagnostics reports how each detector fared on a chart.
+	Diagnostics = scan.Diagnostics
+	// DetectorDiagnostic is the outcome of one detector.
+	DetectorDiagnostic = scan.DetectorDiagnostic
+	// DetectorStatus is ok, failed or skipped.
+	DetectorStatus = scan.DetectorStatus
+	// Detector finds images in a chart.
+	Detector = scan.Detector
+	// Chart is a chart on local disk, as passed to a Detector.
+	Chart = scan.Chart
+)
+
+// DefaultConcurrency is how many detectors, subcharts and registry lookups
+// a Scanner runs at once by default.
+const DefaultConcurrency = scan.DefaultConcurrency
+
+// Confidences, from most to least certain.
+const (
+	// ConfidenceHigh images come from rendered charts or manifests.
+	ConfidenceHigh = scan.ConfidenceHigh
+	// ConfidenceMedium images are inferred from chart values and templates.
+	ConfidenceMedium = scan.ConfidenceMedium
+	// ConfidenceLow images are heuristic matches in chart files.
+	ConfidenceLow = scan.ConfidenceLow
+)
+
+// Sources of images.
+const (
+	SourceRendered  = scan.SourceRendered
+	SourceStatic    = scan.SourceStatic
+	SourceRegex     = scan.SourceRegex
+	SourceManifest  = scan.SourceManifest
+	SourceKustomize = scan.SourceKustomize
+)
+
+// Detector statuses.
+const (
+	DetectorOK      = scan.DetectorOK
+	DetectorFailed  = scan.DetectorFailed
+	DetectorSkipped = scan.DetectorSkipped
+)
+
+// Names of the built-in detectors.
+const (
+	DetectorRendered = scan.DetectorRendered
+	DetectorStatic   = scan.DetectorStatic
+	DetectorRegex    = scan.DetectorRegex
+)
+
+var (
+	// ErrNoImages is returned, wrapped, when a scan finds no images.
+	ErrNoImages = scan.ErrNoImages
+	// ErrInvalidOption is returned, wrapped, when a Scanner is configured
+	// with an invalid option value.
+	ErrInvalidOption = errors.New("invalid option")
+)
+
+// Scanner scans charts and other inputs for images. Its zero value is not
+// usable; create one with New. A Scanner is safe for concurrent use.
+type Scanner struct {
+	options scan.Options
+}
+
+// Option configures a Scanner.
+type Option func(*Scanner)
+
+// New returns a Scanner with options applied over the defaults: every
+// confidence is reported, helm is run from $PATH, and chart dependencies
+// are built when rendering needs them.
+func New(options ...Option) *Scanner {
+	scanner := &Scanner{options: scan.Options{
+		HelmBin:       "helm",
+		MinConfidence: ConfidenceLow,
+	}}
+	for _, option := range options {
+		option(scanner)
+	}
+	return scanner
+}
+
+// WithMinConfidence drops images found with less than confidence.
+func WithMinConfidence(confidence Confidence) Option {
+	return func(s *Scanner) { s.options.MinConfidence = confidence }
+}
+
+// WithSet sets chart values as "key=value" pairs, like helm --set.
+func WithSet(values ...string) Option {
+	return func(s *Scanner) {
+		for _, value := range values {
+			s.options.Values = append(s.options.Values, "--set="+value)
+		}
+	}
+}
+
+// WithSetString sets chart values as strings, like helm --set-string.
+func WithSetString(values ...string) Option {
+	return func(s *Scanner) {
+		for _, value := range values {
+			s.options.Values = append(s.options.Values, "--set-string="+value)
+		}
+	}
+}
+
+// WithValuesFiles adds values files, like helm --values. Later files take
+// precedence.
+func WithValuesFiles(paths ...string) Option {
+	return func(s *Scanner) {
+		for _, path := range paths {
+			s.options.ValuesFiles = append(s.options.ValuesFiles, "--values="+path)
+		}
+	}
+}
+
+// WithHelmBinary runs helm from path instead of $PATH.
+func WithHelmBinary(path string) Option {
+	return func(s *Scanner) { s.options.HelmBin = path }
+}
+
+// WithoutHelmDependencies disables the automatic 'helm dependency build'
+// when a chart's dependencies are missing.
+func WithoutHelmDependencies() Option {
+	return func(s *Scanner) { s.options.DisableHelmDeps = true }
+}
+
+// WithOptionalDependencies also scans subcharts that are only included
+// when their condition is enabled.
+func WithOptionalDependencies() Option {
+	return func(s *Scanner) { s.options.IncludeOptionalDeps = true }
+}
+
+// WithDigests resolves each image's tag to its manifest digest in the
+// registry.
+func WithDigests() Option {
+	return func(s *Scanner) { s.options.ResolveDigests = true }
+}
+
+// WithPlatforms lists the OS/architecture platforms each image supports.
+func WithPlatforms() Option {
+	return func(s *Scanner) { s.options.ResolvePlatforms = true }
+}
+
+// WithVerbose logs what the scan does to stderr, at debug level. It has no
+// effect with WithLogger.
+func WithVerbose() Option {
+	return func(s *Scanner) { s.options.Verbose = true }
+}
+
+// WithLogger sends the scan's log to logger instead of stderr. Records
+// carry attributes such as chart, subchart, detector, duration and error.
+// Without it, warnings are logged as text to stderr.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Scanner) { s.options.Logger = logger }
+}
+
+// WithDetectors replaces the detectors run on charts, in order. Start from
+// DefaultDetectors to add to, remove from or reorder the built-in ones.
+func WithDetectors(detectors ...Detector) Option {
+	return func(s *Scanner) { s.options.Detectors = slices.Clone(detectors) }
+}
+
+// WithConcurrency runs up to n detectors, subcharts and registry lookups
+// at once, instead of DefaultConcurrency. Results do not depend on it.
+// Zero means the default; a negative n is an invalid option.
+func WithConcurrency(n int) Option {
+	return func(s *Scanner) { s.options.Concurrency = n }
+}
+
+// DefaultDetectors returns the built-in detectors: rendered, static and
+// regex, in order of confidence.
+func DefaultDetectors() []Detector {
+	return scan.DefaultDetectors()
+}
+
+// RegisterDetector makes detector available by name, for LookupDetectors
+// and the CLI's --detectors flag. Names must be unique.
+func RegisterDetector(detector Detector) error {
+	return scan.RegisterDetector(detector)
+}
+
+// LookupDetectors returns the registered detectors with names, in order.
+func LookupDetectors(names ...string) ([]Detector, error) {
+	return scan.LookupDetectors(names)
+}
+
+// RegisteredDetectors returns the names of the registered detectors.
+func RegisteredDetectors() []string {
+	return scan.RegisteredDetectors()
+}
+
+// FindDetectorPlugins loads the heft-detector-* plugins on PATH and those
+// listed in the heft config file, as the CLI does. Plugins that fail to
+// load are returned as errors. Pass the detectors to WithDetectors or
+// RegisterDetector to use them.
+func FindDetectorPlugins(ctx context.Context) ([]Detector, []error) {
+	plugins, errs := plugin.Find(ctx, plugin.ConfigFile(), os.Getenv("PATH"))
+	detectors := make([]Detector, 0, len(plugins))
+	for _, detector := range plugins {
+		detectors = append(detectors, detector)
+	}
+	return detectors, errs
+}
+
+// Scan scans ref, which is a chart directory or archive, an HTTP(S) or
+// oci:// chart reference, a manifest file or directory, a Kustomize
+// directory, or "-" for manifests on stdin. Errors from ctx are returned
+// wrapped.
+func (s *Scanner) Scan(ctx context.Context, ref string) (*Result, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	options := s.options
+	options.ChartPath = ref
+	return scan.ScanContext(ctx, options)
+}
+
+// ScanReleases scans the chart of every release with the release's values
+// followed by the Scanner's. A release that fails is reported in its
+// ReleaseResult; an error is returned only if every release failed.
+func (s *Scanner) ScanReleases(ctx context.Context, releases []Release) (*Result, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return scan.ScanReleases(ctx, releases, s.options)
+}
+
+// Helmfile returns the releases of the helmfile at path for environment,
+// "" meaning "default", ready for ScanReleases, and warnings about the
+// parts of the helmfile that are not supported.
+func Helmfile(path, environment string) ([]Release, []string, error) {
+	loaded, err := helmfile.Load(path, environment)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loaded.Releases, loaded.Warnings, nil
+}
+
+func (s *Scanner) validate() error {
+	switch s.options.MinConfidence {
+	case ConfidenceHigh, ConfidenceMedium, ConfidenceLow:
+	default:
+		return fmt.Errorf("%w: confidence %q (want high, medium or low)", ErrInvalidOption, s.options.MinConfidence)
+	}
+	if s.options.Concurrency < 0 {
+		return fmt.Errorf("%w: concurrency %d", ErrInvalidOption, s.options.Concurrency)
+	}
+	if s.options.Detectors != nil && len(s.options.Detectors) == 0 {
+		return fmt.Errorf("%w: no detectors", ErrInvalidOption)
+	}
+	return nil
+}
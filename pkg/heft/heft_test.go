@@ -0,0 +1,81 @@
+package heft
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewAppliesOptions(t *testing.T) {
+	scanner := New(
+		WithMinConfidence(ConfidenceMedium),
+		WithSet("a=1"),
+		WithSetString("b=2"),
+		WithValuesFiles("one.yaml", "two.yaml"),
+		WithHelmBinary("/opt/helm"),
+		WithoutHelmDependencies(),
+		WithOptionalDependencies(),
+		WithDigests(),
+		WithPlatforms(),
+		WithConcurrency(8),
+	)
+	options := scanner.options
+	if options.MinConfidence != ConfidenceMedium || options.HelmBin != "/opt/helm" {
+		t.Fatalf("options = %+v", options)
+	}
+	if want := []string{"--set=a=1", "--set-string=b=2"}; !reflect.DeepEqual(options.Values, want) {
+		t.Errorf("Values = %v, want %v", options.Values, want)
+	}
+	if want := []string{"--values=one.yaml", "--values=two.yaml"}; !reflect.DeepEqual(options.ValuesFiles, want) {
+		t.Errorf("ValuesFiles = %v, want %v", options.ValuesFiles, want)
+	}
+	if !options.DisableHelmDeps || !options.IncludeOptionalDeps || !options.ResolveDigests || !options.ResolvePlatforms || options.Concurrency != 8 {
+		t.Errorf("flags not set: %+v", options)
+	}
+}
+
+func TestScanManifests(t *testing.T) {
+	directory := t.TempDir()
+	manifest := filepath.Join(directory, "pod.yaml")
+	if err := os.WriteFile(manifest, []byte("kind: Pod\nmetadata:\n  name: web\nspec:\n  containers:\n    - name: app\n      image: nginx:1.27\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := New(WithMinConfidence(ConfidenceHigh)).Scan(context.Background(), manifest)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(result.Images) != 1 {
+		t.Fatalf("images = %+v, want one", result.Images)
+	}
+	image := result.Images[0]
+	if image.Name != "nginx:1.27" || image.Source != SourceManifest || image.Confidence != ConfidenceHigh || image.Resource.Name != "web" {
+		t.Errorf("image = %+v", image)
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	directory := t.TempDir()
+	empty := filepath.Join(directory, "config.yaml")
+	if err := os.WriteFile(empty, []byte("kind: ConfigMap\nmetadata:\n  name: settings\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New().Scan(context.Background(), empty); !errors.Is(err, ErrNoImages) {
+		t.Errorf("Scan(no images) error = %v, want ErrNoImages", err)
+	}
+	if _, err := New(WithMinConfidence("certain")).Scan(context.Background(), empty); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("Scan(invalid confidence) error = %v, want ErrInvalidOption", err)
+	}
+	if _, err := New(WithConcurrency(-1)).Scan(context.Background(), empty); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("Scan(negative concurrency) error = %v, want ErrInvalidOption", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New().Scan(ctx, empty); !errors.Is(err, context.Canceled) {
+		t.Errorf("Scan(canceled) error = %v, want context.Canceled", err)
+	}
+}